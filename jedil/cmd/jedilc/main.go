@@ -0,0 +1,121 @@
+// Command jedilc compiles JEDIL source to .jbc bytecode images.
+//
+//	jedilc [-o out.jbc] prog.jedil   compile; output defaults to prog.jbc
+//	jedilc -check prog.jbc           validate and verify an image, print its summary
+//	jedilc -d prog.jedil|prog.jbc    print a disassembly
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"jedil/pkg/bytecode"
+	"jedil/pkg/compiler"
+	"jedil/pkg/vm"
+	"os"
+	"strings"
+)
+
+func main() {
+	out := flag.String("o", "", "output file (default: input with .jbc extension)")
+	check := flag.Bool("check", false, "validate and verify a .jbc file instead of compiling")
+	disasm := flag.Bool("d", false, "disassemble a .jedil or .jbc file instead of compiling")
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: jedilc [-o out.jbc] file.jedil\n       jedilc -check file.jbc\n       jedilc -d file.jedil|file.jbc\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if flag.NArg() != 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	var err error
+	switch {
+	case *check:
+		err = checkImage(flag.Arg(0))
+	case *disasm:
+		err = disassemble(flag.Arg(0))
+	default:
+		err = compile(flag.Arg(0), *out)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "jedilc: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func compile(path, out string) error {
+	source, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	program, err := compiler.CompileProgram(string(source))
+	if err != nil {
+		return fmt.Errorf("%s: %v", path, err)
+	}
+
+	data, err := bytecode.Encode(program)
+	if err != nil {
+		return err
+	}
+
+	if out == "" {
+		out = strings.TrimSuffix(path, ".jedil") + ".jbc"
+	}
+	return os.WriteFile(out, data, 0o644)
+}
+
+func checkImage(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	program, err := bytecode.Decode(data, vm.ResolveNative)
+	if err != nil {
+		return fmt.Errorf("%s: %v", path, err)
+	}
+	if err := vm.Verify(program); err != nil {
+		return fmt.Errorf("%s: %v", path, err)
+	}
+
+	fmt.Printf("%s: ok, format v%d, %d instructions\n", path, bytecode.Version, len(program.Code))
+	for _, in := range program.Inputs {
+		fmt.Printf("  input %s: %s\n", in.Name, in.Type)
+	}
+	for _, fn := range program.Functions {
+		fmt.Printf("  fn %s/%d -> %d @%d\n", fn.Name, fn.Params, fn.Returns, fn.Address)
+	}
+	for _, n := range program.Natives {
+		fmt.Printf("  native %s/%d\n", n.Name, n.Arity)
+	}
+	return nil
+}
+
+// disassemble prints the listing for a source file or, if it starts with the
+// .jbc magic, a compiled image
+func disassemble(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	var program *bytecode.Program
+	if bytes.HasPrefix(data, bytecode.Magic[:]) {
+		program, err = bytecode.Decode(data, vm.ResolveNative)
+	} else {
+		program, err = compiler.CompileProgram(string(data))
+	}
+	if err != nil {
+		return fmt.Errorf("%s: %v", path, err)
+	}
+
+	fmt.Print(bytecode.Disassemble(program))
+	if err := vm.Verify(program); err != nil {
+		return fmt.Errorf("%s: %v", path, err)
+	}
+	return nil
+}
@@ -0,0 +1,334 @@
+// Command jedildb runs a JEDIL program under the step debugger.
+//
+//	jedildb [-set name=value]... prog.jedil|prog.jbc
+//
+// Vec3 inputs are given as x,y,z. Type "h" at the prompt for commands.
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"flag"
+	"fmt"
+	"jedil/pkg/bytecode"
+	"jedil/pkg/compiler"
+	"jedil/pkg/types"
+	"jedil/pkg/vm"
+	"os"
+	"strconv"
+	"strings"
+)
+
+const help = `commands:
+  b <line> | b @<ip>   set a breakpoint on a source line or instruction
+  clear <ip>           remove the breakpoint at ip
+  bl                   list breakpoints
+  c                    continue
+  s                    step to the next line, entering calls
+  n                    step to the next line, over calls
+  o | finish           run until the current function returns
+  si                   execute one instruction
+  bt                   show the call stack
+  locals [frame]       show named variables in a frame (default 0)
+  p <name>             print a variable in the innermost frame
+  slots [frame]        show the raw stack slots of a frame
+  dis                  disassemble the program
+  r                    restart from the beginning
+  reload               recompile from disk and restart, keeping line breakpoints
+  h                    show this help
+  q                    quit`
+
+// inputFlags collects repeated -set name=value flags
+type inputFlags []string
+
+func (f *inputFlags) String() string     { return strings.Join(*f, " ") }
+func (f *inputFlags) Set(s string) error { *f = append(*f, s); return nil }
+
+type session struct {
+	path   string
+	inputs inputFlags
+	source []string
+	lines  map[int]bool // breakpoints set by line, re-applied on reload
+	d      *vm.Debugger
+}
+
+func main() {
+	var inputs inputFlags
+	flag.Var(&inputs, "set", "bind an input, as name=value (repeatable)")
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: jedildb [-set name=value]... file.jedil|file.jbc\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if flag.NArg() != 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	s := &session{path: flag.Arg(0), inputs: inputs, lines: make(map[int]bool)}
+	if err := s.load(); err != nil {
+		fmt.Fprintf(os.Stderr, "jedildb: %v\n", err)
+		os.Exit(1)
+	}
+	s.repl()
+}
+
+// load reads and compiles the program, binds inputs and starts a fresh
+// debugger, carrying over line breakpoints.
+func (s *session) load() error {
+	data, err := os.ReadFile(s.path)
+	if err != nil {
+		return err
+	}
+
+	var program *bytecode.Program
+	var source []string
+	if bytes.HasPrefix(data, bytecode.Magic[:]) {
+		program, err = bytecode.Decode(data, vm.ResolveNative)
+	} else {
+		source = strings.Split(string(data), "\n")
+		program, err = compiler.CompileProgram(string(data))
+	}
+	if err != nil {
+		return fmt.Errorf("%s: %v", s.path, err)
+	}
+	if err := vm.Verify(program); err != nil {
+		return fmt.Errorf("%s: %v", s.path, err)
+	}
+
+	d, err := vm.NewDebugger(program)
+	if err != nil {
+		return err
+	}
+	for _, in := range s.inputs {
+		if err := bindInput(d.VM(), in); err != nil {
+			return err
+		}
+	}
+	if err := d.Restart(); err != nil {
+		return err
+	}
+	for line := range s.lines {
+		if _, err := d.BreakAtLine(line); err != nil {
+			fmt.Printf("dropping breakpoint: %v\n", err)
+			delete(s.lines, line)
+		}
+	}
+	s.d, s.source = d, source
+	return nil
+}
+
+func bindInput(machine *vm.VM, assignment string) error {
+	name, text, ok := strings.Cut(assignment, "=")
+	if !ok {
+		return fmt.Errorf("bad input %q, want name=value", assignment)
+	}
+
+	var value vm.Value
+	switch parts := strings.Split(text, ","); len(parts) {
+	case 1:
+		f, err := strconv.ParseFloat(text, 64)
+		if err != nil {
+			return fmt.Errorf("input %s: %v", name, err)
+		}
+		value = vm.NewFloat(f)
+	case 3:
+		var xyz [3]float64
+		for i, p := range parts {
+			f, err := strconv.ParseFloat(strings.TrimSpace(p), 64)
+			if err != nil {
+				return fmt.Errorf("input %s: %v", name, err)
+			}
+			xyz[i] = f
+		}
+		value = vm.NewVec3(types.NewVec3(xyz[0], xyz[1], xyz[2]))
+	default:
+		return fmt.Errorf("input %s: want a number or x,y,z", name)
+	}
+	return machine.SetInput(name, value)
+}
+
+func (s *session) repl() {
+	fmt.Printf("%s: %d instructions, stopped at entry; h for help\n", s.path, len(s.d.Program().Code))
+	s.where()
+
+	in := bufio.NewScanner(os.Stdin)
+	for {
+		fmt.Print("(jedildb) ")
+		if !in.Scan() {
+			fmt.Println()
+			return
+		}
+		fields := strings.Fields(in.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		if fields[0] == "q" || fields[0] == "quit" {
+			return
+		}
+		if err := s.command(fields[0], fields[1:]); err != nil {
+			fmt.Printf("error: %v\n", err)
+		}
+	}
+}
+
+func (s *session) command(cmd string, args []string) error {
+	switch cmd {
+	case "b", "break":
+		if len(args) != 1 {
+			return fmt.Errorf("usage: b <line> | b @<ip>")
+		}
+		if ip, ok := strings.CutPrefix(args[0], "@"); ok {
+			n, err := strconv.Atoi(ip)
+			if err != nil {
+				return err
+			}
+			if err := s.d.BreakAtIP(n); err != nil {
+				return err
+			}
+			fmt.Printf("breakpoint at %04d\n", n)
+			return nil
+		}
+		line, err := strconv.Atoi(args[0])
+		if err != nil {
+			return err
+		}
+		ip, err := s.d.BreakAtLine(line)
+		if err != nil {
+			return err
+		}
+		s.lines[line] = true
+		fmt.Printf("breakpoint at %04d, line %d\n", ip, line)
+	case "clear":
+		if len(args) != 1 {
+			return fmt.Errorf("usage: clear <ip>")
+		}
+		ip, err := strconv.Atoi(strings.TrimPrefix(args[0], "@"))
+		if err != nil {
+			return err
+		}
+		s.d.ClearBreakpoint(ip)
+		line, _ := s.d.Program().Position(ip)
+		delete(s.lines, line)
+	case "bl":
+		for _, ip := range s.d.Breakpoints() {
+			line, _ := s.d.Program().Position(ip)
+			fmt.Printf("  %04d  line %d\n", ip, line)
+		}
+	case "c", "continue":
+		return s.run(s.d.Continue)
+	case "s", "step":
+		return s.run(s.d.StepInto)
+	case "n", "next":
+		return s.run(s.d.StepOver)
+	case "o", "finish":
+		return s.run(s.d.StepOut)
+	case "si":
+		return s.run(s.d.StepInstruction)
+	case "bt":
+		for i, f := range s.d.Frames() {
+			name := f.Function
+			if name == "" {
+				name = "<top level>"
+			}
+			fmt.Printf("  #%d %s at %04d, line %d\n", i, name, f.IP, f.Line)
+		}
+	case "locals":
+		frame, err := frameArg(args)
+		if err != nil {
+			return err
+		}
+		vars, err := s.d.Locals(frame)
+		if err != nil {
+			return err
+		}
+		for _, v := range vars {
+			fmt.Printf("  %s = %s  (slot %d)\n", v.Name, v.Value.String(), v.Slot)
+		}
+	case "p", "print":
+		if len(args) != 1 {
+			return fmt.Errorf("usage: p <name>")
+		}
+		v, err := s.d.Lookup(args[0])
+		if err != nil {
+			return err
+		}
+		fmt.Printf("%s = %s\n", args[0], v.String())
+	case "slots":
+		frame, err := frameArg(args)
+		if err != nil {
+			return err
+		}
+		values, err := s.d.Slots(frame)
+		if err != nil {
+			return err
+		}
+		for i, v := range values {
+			fmt.Printf("  [%d] %s\n", i, v.String())
+		}
+	case "dis":
+		fmt.Print(bytecode.Disassemble(s.d.Program()))
+	case "r", "restart":
+		if err := s.d.Restart(); err != nil {
+			return err
+		}
+		s.where()
+	case "reload":
+		if err := s.load(); err != nil {
+			return fmt.Errorf("%v; keeping the previous version", err)
+		}
+		fmt.Printf("reloaded %s\n", s.path)
+		s.where()
+	case "h", "help":
+		fmt.Println(help)
+	default:
+		return fmt.Errorf("unknown command %q; h for help", cmd)
+	}
+	return nil
+}
+
+func frameArg(args []string) (int, error) {
+	if len(args) == 0 {
+		return 0, nil
+	}
+	return strconv.Atoi(args[0])
+}
+
+// run resumes the program and reports where it stopped
+func (s *session) run(step func() (vm.StopReason, error)) error {
+	reason, err := step()
+	if err != nil && reason != vm.StopError {
+		return err
+	}
+
+	switch reason {
+	case vm.StopFinished:
+		result, err := s.d.VM().GetResult()
+		if err != nil {
+			fmt.Println("finished")
+		} else {
+			fmt.Printf("finished: %s\n", result.String())
+		}
+		return nil
+	case vm.StopError:
+		fmt.Printf("stopped on error: %v\n", err)
+	case vm.StopBreakpoint:
+		fmt.Println("breakpoint")
+	}
+	s.where()
+	return nil
+}
+
+// where prints the current location with its source line when available
+func (s *session) where() {
+	loc := s.d.Location()
+	name := loc.Function
+	if name == "" {
+		name = "<top level>"
+	}
+	fmt.Printf("%04d in %s, line %d\n", loc.IP, name, loc.Line)
+	if loc.Line > 0 && loc.Line <= len(s.source) {
+		fmt.Printf("  %4d | %s\n", loc.Line, s.source[loc.Line-1])
+	}
+}
@@ -0,0 +1,159 @@
+// Exercises the FFI from several threads at once: concurrent executes on one
+// handle, per-thread last errors, and a free racing executes in flight.
+#include <pthread.h>
+#include <stdio.h>
+#include <string.h>
+#include <unistd.h>
+#include "../../pkg/ffi/jedil.h"
+
+#define THREADS 8
+#define CALLS 2000
+
+static JedilProgram prog;
+static pthread_barrier_t barrier;
+static int failures;
+static pthread_mutex_t failures_mu = PTHREAD_MUTEX_INITIALIZER;
+
+static void fail(const char* what, long id) {
+    pthread_mutex_lock(&failures_mu);
+    failures++;
+    printf("  ❌ FAIL: thread %ld: %s\n", id, what);
+    pthread_mutex_unlock(&failures_mu);
+}
+
+static void run_threads(void* (*fn)(void*)) {
+    pthread_t threads[THREADS];
+    for (long i = 0; i < THREADS; i++) {
+        pthread_create(&threads[i], NULL, fn, (void*)i);
+    }
+    for (int i = 0; i < THREADS; i++) {
+        pthread_join(threads[i], NULL);
+    }
+}
+
+// Each thread passes its own input and must get its own result back
+static void* execute_worker(void* arg) {
+    long id = (long)arg;
+    for (int i = 0; i < CALLS; i++) {
+        double x = id * CALLS + i;
+        double result;
+        if (jedil_execute_float(prog, &x, sizeof x, &result) != JEDIL_OK) {
+            fail(jedil_get_last_error(), id);
+            break;
+        }
+        if (result != x * 2) {
+            fail("result belongs to another call", id);
+            break;
+        }
+    }
+    jedil_clear_error();
+    return NULL;
+}
+
+// Every thread fails with its own message, then checks nobody overwrote it
+static void* error_worker(void* arg) {
+    long id = (long)arg;
+    char name[32], want[64];
+    snprintf(name, sizeof name, "missing_%ld", id);
+    snprintf(want, sizeof want, "unknown function: %s", name);
+
+    JedilValue out;
+    if (jedil_call(prog, name, NULL, 0, &out, 1, NULL) != JEDIL_ERROR_UNKNOWN_FUNCTION) {
+        fail("expected JEDIL_ERROR_UNKNOWN_FUNCTION", id);
+    }
+    pthread_barrier_wait(&barrier);
+
+    // odd threads now succeed, which must clear only their own error
+    if (id % 2 == 1) {
+        double x = 1, result;
+        jedil_execute_float(prog, &x, sizeof x, &result);
+    }
+    pthread_barrier_wait(&barrier);
+
+    const char* got = jedil_get_last_error();
+    if (id % 2 == 1 ? got[0] != '\0' : strcmp(got, want) != 0) {
+        fail(got[0] ? got : "error was cleared by another thread", id);
+    }
+
+    jedil_clear_error();
+    return NULL;
+}
+
+// Executes until the handle is freed under it; calls must either succeed or
+// report the invalid handle, and never succeed again once one has failed
+static void* free_worker(void* arg) {
+    long id = (long)arg;
+    pthread_barrier_wait(&barrier);
+    for (long i = 0;; i++) {
+        double x = i, result;
+        int rc = jedil_execute_float(prog, &x, sizeof x, &result);
+        if (rc == JEDIL_ERROR_NULL_POINTER) {
+            break;
+        }
+        if (rc != JEDIL_OK) {
+            fail(jedil_get_last_error(), id);
+            break;
+        }
+        if (result != x * 2) {
+            fail("wrong result while freeing", id);
+            break;
+        }
+        if (i == 100000000) {
+            fail("handle was never freed", id);
+            break;
+        }
+    }
+
+    double x = 1, result;
+    if (jedil_execute_float(prog, &x, sizeof x, &result) == JEDIL_OK) {
+        fail("call succeeded after the handle was freed", id);
+    }
+    jedil_clear_error();
+    return NULL;
+}
+
+static void* free_program(void* arg) {
+    (void)arg;
+    pthread_barrier_wait(&barrier);
+    usleep(1000);
+    jedil_free_program(prog);
+    return NULL;
+}
+
+int main() {
+    printf("=== JEDIL Thread-Safety Test ===\n\n");
+
+    prog = jedil_compile_source("input x: float\nreturn x * 2");
+    if (prog == NULL) {
+        printf("  ❌ FAIL: Compilation failed: %s\n", jedil_get_last_error());
+        return 1;
+    }
+
+    printf("Test 1: %d threads executing one handle\n", THREADS);
+    run_threads(execute_worker);
+    if (failures == 0) printf("  ✓ PASS\n\n");
+
+    printf("Test 2: last error is per thread\n");
+    int before = failures;
+    pthread_barrier_init(&barrier, NULL, THREADS);
+    run_threads(error_worker);
+    pthread_barrier_destroy(&barrier);
+    if (failures == before) printf("  ✓ PASS\n\n");
+
+    printf("Test 3: free racing executes\n");
+    before = failures;
+    pthread_t freer;
+    pthread_barrier_init(&barrier, NULL, THREADS + 1);
+    pthread_create(&freer, NULL, free_program, NULL);
+    run_threads(free_worker);
+    pthread_join(freer, NULL);
+    pthread_barrier_destroy(&barrier);
+    if (failures == before) printf("  ✓ PASS\n\n");
+
+    if (failures > 0) {
+        printf("%d failure(s)\n", failures);
+        return 1;
+    }
+    printf("All thread-safety tests passed\n");
+    return 0;
+}
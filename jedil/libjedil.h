@@ -27,6 +27,65 @@ extern const char *_GoStringPtr(_GoString_ s);
 #include <stdint.h>
 #include <string.h>
 
+// Must match JedilValue and JedilNativeFn in jedil.h
+typedef struct {
+    int type;
+    double x;
+    double y;
+    double z;
+} JedilValue;
+
+typedef int (*JedilNativeFn)(const JedilValue* args, size_t nargs, JedilValue* result, void* user_data);
+
+// Must match JedilReloadFn in jedil.h
+typedef void (*JedilReloadFn)(void* program, int status, const char* message, void* user_data);
+
+// Must match JedilErrorInfo and JedilStackFrame in jedil.h
+typedef struct {
+    int kind;
+    int line;
+    int column;
+    int opcode;
+    char opcode_name[24];
+    int ip;
+    int frame_count;
+} JedilErrorInfo;
+
+typedef struct {
+    char function[64];
+    int ip;
+    int line;
+    int column;
+} JedilStackFrame;
+
+// Per-thread last error: the message jedil_get_last_error hands out and a
+// cgo.Handle to the Go error behind it, for jedil_get_error_info
+static _Thread_local char* jedil_error_message;
+static _Thread_local uintptr_t jedil_error_value;
+
+static inline const char* jedil_last_message(void) {
+    return jedil_error_message ? jedil_error_message : "";
+}
+
+static inline uintptr_t jedil_last_value(void) {
+    return jedil_error_value;
+}
+
+static inline void jedil_store_error(char* message, uintptr_t value) {
+    free(jedil_error_message);
+    jedil_error_message = message;
+    jedil_error_value = value;
+}
+
+// Go can't call C function pointers directly
+static inline int jedil_invoke_native(JedilNativeFn fn, const JedilValue* args, size_t nargs, JedilValue* result, void* user_data) {
+    return fn(args, nargs, result, user_data);
+}
+
+static inline void jedil_invoke_reload(JedilReloadFn fn, void* program, int status, const char* message, void* user_data) {
+    fn(program, status, message, user_data);
+}
+
 #line 1 "cgo-generated-wrapper"
 
 
@@ -90,12 +149,26 @@ extern "C" {
 #endif
 
 extern char* jedil_get_last_error(void);
+extern void jedil_clear_error(void);
+extern int jedil_get_error_info(JedilErrorInfo* info);
+extern int jedil_get_error_frame(size_t index, JedilStackFrame* frame);
 extern void* jedil_create_program(uint8_t* bytecode_data, size_t length);
+extern void* jedil_load_file(char* filepath);
 extern void* jedil_compile_file(char* filepath);
 extern void* jedil_compile_source(char* sourceStr);
 extern void jedil_free_program(void* program);
+extern void* jedil_watch_file(char* filepath, JedilReloadFn callback, void* user_data);
 extern int jedil_execute_vec3(void* program, void* input_data, size_t input_len, double* result_x, double* result_y, double* result_z);
 extern int jedil_execute_float(void* program, void* input_data, size_t input_len, double* result);
+extern int jedil_input_count(void* program);
+extern int jedil_input_index(void* program, char* name);
+extern int jedil_set_float(void* program, char* name, double value);
+extern int jedil_set_vec3(void* program, char* name, double x, double y, double z);
+extern int jedil_set_float_at(void* program, int index, double value);
+extern int jedil_set_vec3_at(void* program, int index, double x, double y, double z);
+extern int jedil_call(void* program, char* name, JedilValue* args, size_t nargs, JedilValue* results, size_t max_results, size_t* nresults);
+extern int jedil_register_native(char* name, int arity, JedilNativeFn fn, void* user_data);
+extern int jedil_set_instruction_budget(void* program, int64_t max_instructions);
 extern void jedil_vec3_add(double ax, double ay, double az, double bx, double by, double bz, double* result_x, double* result_y, double* result_z);
 extern void jedil_batch_add(double* a_xs, double* a_ys, double* a_zs, double* b_xs, double* b_ys, double* b_zs, double* result_xs, double* result_ys, double* result_zs);
 
@@ -0,0 +1,82 @@
+package bytecode
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Disassemble renders a program as one instruction per line:
+//
+//	0004    3 OP_LOAD            slot 0
+//	0005    | OP_PUSH            0.5
+//
+// The columns are address, source line ("|" when unchanged from the
+// previous instruction) and opcode with its decoded argument. Function entry
+// points from the function table are labelled.
+func Disassemble(p *Program) string {
+	var sb strings.Builder
+
+	entries := make(map[int]Function, len(p.Functions))
+	for _, fn := range p.Functions {
+		entries[fn.Address] = fn
+	}
+
+	prevLine := -1
+	for addr, inst := range p.Code {
+		if fn, ok := entries[addr]; ok {
+			fmt.Fprintf(&sb, "%s(%d) -> %d:\n", fn.Name, fn.Params, fn.Returns)
+			prevLine = -1
+		}
+
+		line := "    "
+		if addr < len(p.Lines) && p.Lines[addr] != 0 {
+			if p.Lines[addr] == prevLine {
+				line = "   |"
+			} else {
+				line = fmt.Sprintf("%4d", p.Lines[addr])
+			}
+			prevLine = p.Lines[addr]
+		}
+
+		fmt.Fprintf(&sb, "%04d %s %s\n", addr, line, strings.TrimRight(fmt.Sprintf("%-18s %s", inst.Op, operand(p, inst)), " "))
+	}
+	return sb.String()
+}
+
+// operand formats an instruction's argument according to its opcode, or
+// returns "" for opcodes that ignore it.
+func operand(p *Program, inst Instruction) string {
+	switch inst.Op {
+	case OP_PUSH:
+		return fmt.Sprintf("%g", inst.Args)
+	case OP_PUSH_BOOL:
+		return fmt.Sprintf("%t", inst.Args != 0)
+	case OP_LOAD, OP_STORE:
+		return fmt.Sprintf("slot %d", int(inst.Args))
+	case OP_RET:
+		return fmt.Sprintf("returns %d", int(inst.Args))
+	case OP_JMP, OP_JMP_IF_FALSE:
+		return fmt.Sprintf("-> %04d", int(inst.Args))
+	case OP_CALL:
+		for _, fn := range p.Functions {
+			if fn.Address == int(inst.Args) {
+				return fmt.Sprintf("-> %04d (%s)", fn.Address, fn.Name)
+			}
+		}
+		return fmt.Sprintf("-> %04d", int(inst.Args))
+	case OP_LOAD_INPUT:
+		if index := int(inst.Args); index < len(p.Inputs) {
+			return fmt.Sprintf("input %d (%s)", index, p.Inputs[index].Name)
+		}
+		return fmt.Sprintf("input %d", int(inst.Args))
+	case OP_CALL_NATIVE:
+		for _, n := range p.Natives {
+			if n.Index == int(inst.Args) {
+				return fmt.Sprintf("#%d (%s/%d)", n.Index, n.Name, n.Arity)
+			}
+		}
+		return fmt.Sprintf("#%d", int(inst.Args))
+	default:
+		return ""
+	}
+}
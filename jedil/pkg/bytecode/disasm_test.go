@@ -0,0 +1,31 @@
+package bytecode
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDisassemble(t *testing.T) {
+	got := Disassemble(sampleProgram())
+	want := `0000    1 OP_JMP             -> 0005
+half(1) -> 1:
+0001    2 OP_LOAD            slot 0
+0002    | OP_PUSH            0.5
+0003    | OP_MUL
+0004    | OP_RET             returns 1
+0005    4 OP_PUSH            0.5
+0006    | OP_CALL_NATIVE     #7 (sqrt/1)
+0007    | OP_HALT
+`
+	if got != want {
+		t.Fatalf("unexpected listing:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestOpCodeNames(t *testing.T) {
+	for op := OpCode(0); op.Valid(); op++ {
+		if name := op.String(); !strings.HasPrefix(name, "OP_") {
+			t.Errorf("opcode %d has no name (got %q)", op, name)
+		}
+	}
+}
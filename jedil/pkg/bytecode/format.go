@@ -0,0 +1,414 @@
+package bytecode
+
+import (
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"math"
+)
+
+// .jbc file layout (all integers little-endian):
+//
+//	header     magic "JBC\x00", version u16, flags u16 (reserved, 0)
+//	constants  count u32, then count float64s
+//	natives    count u32, then per native: name, arity u16
+//	inputs     count u32, then per input: name, type u8
+//	functions  count u32, then per function: name, address u32, params u16, returns u16
+//	code       count u32, then per instruction: opcode u8, operand u32
+//	positions  count u32, then per run: first instruction u32, line u32, column u32
+//	checksum   CRC-32 (IEEE) of everything before it, u32
+//
+// Names are a u16 length followed by that many bytes. OP_PUSH operands index
+// the constant pool and OP_CALL_NATIVE operands index the native table; every
+// other operand is the instruction's integer argument.
+
+// Magic identifies a .jbc file.
+var Magic = [4]byte{'J', 'B', 'C', 0}
+
+// Version is the .jbc format version this build reads and writes.
+const Version = 1
+
+// NativeResolver maps a native referenced by a .jbc file to its
+// OP_CALL_NATIVE index in this process, or fails if it isn't available.
+type NativeResolver func(name string, arity int) (int, error)
+
+// Encode serialises p to the .jbc format.
+func Encode(p *Program) ([]byte, error) {
+	w := &writer{}
+	w.bytes(Magic[:])
+	w.u16(Version)
+	w.u16(0)
+
+	// constant pool, deduplicated by bit pattern
+	var constants []float64
+	constIndex := make(map[uint64]int)
+	// native table, keyed by in-process index
+	nativeSlot := make(map[int]int, len(p.Natives))
+	for i, n := range p.Natives {
+		nativeSlot[n.Index] = i
+	}
+
+	operands := make([]uint32, len(p.Code))
+	for i, inst := range p.Code {
+		if !inst.Op.Valid() {
+			return nil, fmt.Errorf("jbc: instruction %d: unknown opcode %d", i, inst.Op)
+		}
+		switch inst.Op {
+		case OP_PUSH:
+			bits := math.Float64bits(inst.Args)
+			index, ok := constIndex[bits]
+			if !ok {
+				index = len(constants)
+				constIndex[bits] = index
+				constants = append(constants, inst.Args)
+			}
+			operands[i] = uint32(index)
+		case OP_CALL_NATIVE:
+			slot, ok := nativeSlot[int(inst.Args)]
+			if !ok {
+				return nil, fmt.Errorf("jbc: instruction %d: native %d missing from the program's native table", i, int(inst.Args))
+			}
+			operands[i] = uint32(slot)
+		default:
+			operand, err := integerOperand(inst.Args)
+			if err != nil {
+				return nil, fmt.Errorf("jbc: instruction %d (%s): %v", i, inst.Op, err)
+			}
+			operands[i] = operand
+		}
+	}
+
+	w.u32(uint32(len(constants)))
+	for _, c := range constants {
+		w.u64(math.Float64bits(c))
+	}
+
+	w.u32(uint32(len(p.Natives)))
+	for _, n := range p.Natives {
+		if err := w.name(n.Name); err != nil {
+			return nil, err
+		}
+		w.u16(uint16(n.Arity))
+	}
+
+	w.u32(uint32(len(p.Inputs)))
+	for _, in := range p.Inputs {
+		if err := w.name(in.Name); err != nil {
+			return nil, err
+		}
+		w.u8(uint8(in.Type))
+	}
+
+	w.u32(uint32(len(p.Functions)))
+	for _, fn := range p.Functions {
+		if err := w.name(fn.Name); err != nil {
+			return nil, err
+		}
+		w.u32(uint32(fn.Address))
+		w.u16(uint16(fn.Params))
+		w.u16(uint16(fn.Returns))
+	}
+
+	w.u32(uint32(len(p.Code)))
+	for i, inst := range p.Code {
+		w.u8(uint8(inst.Op))
+		w.u32(operands[i])
+	}
+
+	// run-length encode the source map; an expression's operands and
+	// operator often share a position
+	type run struct{ start, line, column int }
+	var runs []run
+	for i := range p.Lines {
+		line, column := p.Position(i)
+		if len(runs) == 0 || runs[len(runs)-1].line != line || runs[len(runs)-1].column != column {
+			runs = append(runs, run{i, line, column})
+		}
+	}
+	w.u32(uint32(len(runs)))
+	for _, r := range runs {
+		w.u32(uint32(r.start))
+		w.u32(uint32(r.line))
+		w.u32(uint32(r.column))
+	}
+
+	w.u32(crc32.ChecksumIEEE(w.buf))
+	return w.buf, nil
+}
+
+func integerOperand(arg float64) (uint32, error) {
+	if arg < 0 || arg > math.MaxUint32 || arg != math.Trunc(arg) {
+		return 0, fmt.Errorf("operand %g is not a non-negative integer", arg)
+	}
+	return uint32(arg), nil
+}
+
+// Decode parses and validates a .jbc file. Natives it references are relinked
+// through resolve, which may be nil if the program calls none.
+func Decode(data []byte, resolve NativeResolver) (*Program, error) {
+	if len(data) < len(Magic)+8 {
+		return nil, fmt.Errorf("jbc: file is %d bytes, too short for a header and checksum", len(data))
+	}
+	if [4]byte(data[:4]) != Magic {
+		return nil, fmt.Errorf("jbc: bad magic % x (not a .jbc file)", data[:4])
+	}
+
+	// check the checksum first so corruption is reported as such rather than
+	// as whatever garbage it happens to decode to
+	body := data[:len(data)-4]
+	want := binary.LittleEndian.Uint32(data[len(data)-4:])
+	if got := crc32.ChecksumIEEE(body); got != want {
+		return nil, fmt.Errorf("jbc: checksum mismatch (file says %08x, content hashes to %08x); file is corrupt or truncated", want, got)
+	}
+
+	r := &reader{buf: body, pos: 4}
+	r.section = "header"
+	if version := r.u16(); r.err == nil && version != Version {
+		return nil, fmt.Errorf("jbc: unsupported format version %d (this build reads %d)", version, Version)
+	}
+	if flags := r.u16(); r.err == nil && flags != 0 {
+		return nil, fmt.Errorf("jbc: unknown header flags %#x", flags)
+	}
+
+	p := &Program{}
+
+	r.section = "constants"
+	constants := make([]float64, r.count(8))
+	for i := range constants {
+		constants[i] = math.Float64frombits(r.u64())
+	}
+
+	r.section = "natives"
+	p.Natives = make([]Native, r.count(4))
+	for i := range p.Natives {
+		p.Natives[i] = Native{Name: r.name(), Arity: int(r.u16())}
+	}
+
+	r.section = "inputs"
+	p.Inputs = make([]Input, r.count(3))
+	for i := range p.Inputs {
+		p.Inputs[i] = Input{Name: r.name(), Type: InputType(r.u8())}
+		if r.err == nil && p.Inputs[i].Type > INPUT_VEC3 {
+			return nil, fmt.Errorf("jbc: input %s has unknown type %d", p.Inputs[i].Name, p.Inputs[i].Type)
+		}
+	}
+
+	r.section = "functions"
+	p.Functions = make([]Function, r.count(10))
+	for i := range p.Functions {
+		p.Functions[i] = Function{Name: r.name(), Address: int(r.u32()), Params: int(r.u16()), Returns: int(r.u16())}
+	}
+
+	r.section = "code"
+	p.Code = make([]Instruction, r.count(5))
+	for i := range p.Code {
+		op := OpCode(r.u8())
+		operand := r.u32()
+		if r.err != nil {
+			break
+		}
+		if !op.Valid() {
+			return nil, fmt.Errorf("jbc: instruction %d: unknown opcode %d", i, op)
+		}
+
+		var arg float64
+		switch op {
+		case OP_PUSH:
+			if int(operand) >= len(constants) {
+				return nil, fmt.Errorf("jbc: instruction %d: constant %d out of range (pool has %d)", i, operand, len(constants))
+			}
+			arg = constants[operand]
+		case OP_CALL_NATIVE:
+			if int(operand) >= len(p.Natives) {
+				return nil, fmt.Errorf("jbc: instruction %d: native %d out of range (table has %d)", i, operand, len(p.Natives))
+			}
+			arg = float64(operand) // relinked below
+		default:
+			arg = float64(operand)
+		}
+		p.Code[i] = Instruction{Op: op, Args: arg}
+	}
+
+	r.section = "positions"
+	runs := r.count(12)
+	if runs > 0 && r.err == nil {
+		p.Lines = make([]int, len(p.Code))
+		p.Columns = make([]int, len(p.Code))
+		prevStart := -1
+		var line, column int
+		for i := 0; i < runs; i++ {
+			start := int(r.u32())
+			if r.err != nil {
+				break
+			}
+			if start <= prevStart || start >= len(p.Code) {
+				return nil, fmt.Errorf("jbc: source map run %d starts at instruction %d (previous %d, code length %d)", i, start, prevStart, len(p.Code))
+			}
+			// the previous run ends where this one starts
+			fillRun(p, max(prevStart, 0), start, line, column)
+			line, column = int(r.u32()), int(r.u32())
+			prevStart = start
+		}
+		if r.err == nil {
+			fillRun(p, prevStart, len(p.Code), line, column)
+		}
+	}
+
+	if r.err != nil {
+		return nil, r.err
+	}
+	if r.pos != len(body) {
+		return nil, fmt.Errorf("jbc: %d unexpected bytes after the source map", len(body)-r.pos)
+	}
+
+	if err := validate(p); err != nil {
+		return nil, err
+	}
+	if err := link(p, resolve); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// fillRun attributes instructions [from, to) to one source position.
+func fillRun(p *Program, from, to, line, column int) {
+	for j := from; j < to; j++ {
+		p.Lines[j] = line
+		p.Columns[j] = column
+	}
+}
+
+// validate checks that every address in the program points inside the code.
+func validate(p *Program) error {
+	for i, inst := range p.Code {
+		switch inst.Op {
+		case OP_JMP, OP_JMP_IF_FALSE:
+			// jumping to len(code) ends the program
+			if int(inst.Args) > len(p.Code) {
+				return fmt.Errorf("jbc: instruction %d: %s target %d outside code (length %d)", i, inst.Op, int(inst.Args), len(p.Code))
+			}
+		case OP_CALL:
+			if int(inst.Args) >= len(p.Code) {
+				return fmt.Errorf("jbc: instruction %d: call target %d outside code (length %d)", i, int(inst.Args), len(p.Code))
+			}
+		}
+	}
+	for _, fn := range p.Functions {
+		if fn.Address >= len(p.Code) {
+			return fmt.Errorf("jbc: function %s at address %d outside code (length %d)", fn.Name, fn.Address, len(p.Code))
+		}
+	}
+	return nil
+}
+
+// link resolves the file's native table against this process and rewrites
+// OP_CALL_NATIVE operands from table slots to in-process indices.
+func link(p *Program, resolve NativeResolver) error {
+	if len(p.Natives) == 0 {
+		return nil
+	}
+	if resolve == nil {
+		return fmt.Errorf("jbc: program calls native %s but no resolver was given", p.Natives[0].Name)
+	}
+
+	for i := range p.Natives {
+		index, err := resolve(p.Natives[i].Name, p.Natives[i].Arity)
+		if err != nil {
+			return fmt.Errorf("jbc: native %s/%d: %v", p.Natives[i].Name, p.Natives[i].Arity, err)
+		}
+		p.Natives[i].Index = index
+	}
+	for i, inst := range p.Code {
+		if inst.Op == OP_CALL_NATIVE {
+			p.Code[i].Args = float64(p.Natives[int(inst.Args)].Index)
+		}
+	}
+	return nil
+}
+
+type writer struct {
+	buf []byte
+}
+
+func (w *writer) bytes(b []byte) { w.buf = append(w.buf, b...) }
+func (w *writer) u8(v uint8)     { w.buf = append(w.buf, v) }
+func (w *writer) u16(v uint16)   { w.buf = binary.LittleEndian.AppendUint16(w.buf, v) }
+func (w *writer) u32(v uint32)   { w.buf = binary.LittleEndian.AppendUint32(w.buf, v) }
+func (w *writer) u64(v uint64)   { w.buf = binary.LittleEndian.AppendUint64(w.buf, v) }
+
+func (w *writer) name(s string) error {
+	if len(s) > math.MaxUint16 {
+		return fmt.Errorf("jbc: name %.20q... longer than %d bytes", s, math.MaxUint16)
+	}
+	w.u16(uint16(len(s)))
+	w.bytes([]byte(s))
+	return nil
+}
+
+// reader decodes fields in order. The first short read sets err, naming the
+// section and offset, and every later read returns zero.
+type reader struct {
+	buf     []byte
+	pos     int
+	section string
+	err     error
+}
+
+func (r *reader) take(n int) []byte {
+	if r.err != nil {
+		return nil
+	}
+	if len(r.buf)-r.pos < n {
+		r.err = fmt.Errorf("jbc: truncated in %s section at offset %d (need %d bytes, %d left)",
+			r.section, r.pos, n, len(r.buf)-r.pos)
+		return nil
+	}
+	b := r.buf[r.pos : r.pos+n]
+	r.pos += n
+	return b
+}
+
+func (r *reader) u8() uint8 {
+	if b := r.take(1); b != nil {
+		return b[0]
+	}
+	return 0
+}
+
+func (r *reader) u16() uint16 {
+	if b := r.take(2); b != nil {
+		return binary.LittleEndian.Uint16(b)
+	}
+	return 0
+}
+
+func (r *reader) u32() uint32 {
+	if b := r.take(4); b != nil {
+		return binary.LittleEndian.Uint32(b)
+	}
+	return 0
+}
+
+func (r *reader) u64() uint64 {
+	if b := r.take(8); b != nil {
+		return binary.LittleEndian.Uint64(b)
+	}
+	return 0
+}
+
+func (r *reader) name() string {
+	return string(r.take(int(r.u16())))
+}
+
+// count reads an element count and rejects it up front if the remaining
+// bytes can't possibly hold that many elements of at least minSize bytes,
+// so a corrupt count can't trigger a huge allocation.
+func (r *reader) count(minSize int) int {
+	n := int(r.u32())
+	if r.err == nil && n > (len(r.buf)-r.pos)/minSize {
+		r.err = fmt.Errorf("jbc: %s section claims %d entries at offset %d but only %d bytes remain",
+			r.section, n, r.pos-4, len(r.buf)-r.pos)
+		return 0
+	}
+	return n
+}
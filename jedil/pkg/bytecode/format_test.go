@@ -0,0 +1,142 @@
+package bytecode
+
+import (
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func sampleProgram() *Program {
+	return &Program{
+		Code: []Instruction{
+			{Op: OP_JMP, Args: 5},
+			{Op: OP_LOAD, Args: 0}, // 1: fn half(x)
+			{Op: OP_PUSH, Args: 0.5},
+			{Op: OP_MUL},
+			{Op: OP_RET, Args: 1},
+			{Op: OP_PUSH, Args: 0.5}, // 5
+			{Op: OP_CALL_NATIVE, Args: 7},
+			{Op: OP_HALT},
+		},
+		Inputs:    []Input{{Name: "x", Type: INPUT_FLOAT}, {Name: "r", Type: INPUT_VEC3}},
+		Functions: []Function{{Name: "half", Address: 1, Params: 1, Returns: 1}},
+		Natives:   []Native{{Name: "sqrt", Arity: 1, Index: 7}},
+		Lines:     []int{1, 2, 2, 2, 2, 4, 4, 4},
+		Columns:   []int{1, 5, 5, 7, 5, 8, 8, 1},
+	}
+}
+
+func resolveAt(index int) NativeResolver {
+	return func(name string, arity int) (int, error) {
+		if name != "sqrt" || arity != 1 {
+			return -1, fmt.Errorf("unknown native function: %s", name)
+		}
+		return index, nil
+	}
+}
+
+// reseal recomputes the trailing checksum after a test edits the body
+func reseal(data []byte) {
+	body := data[:len(data)-4]
+	binary.LittleEndian.PutUint32(data[len(data)-4:], crc32.ChecksumIEEE(body))
+}
+
+func TestEncodeDecodeRoundTrip(t *testing.T) {
+	p := sampleProgram()
+	data, err := Encode(p)
+	if err != nil {
+		t.Fatalf("encode failed: %v", err)
+	}
+
+	got, err := Decode(data, resolveAt(7))
+	if err != nil {
+		t.Fatalf("decode failed: %v", err)
+	}
+	if !reflect.DeepEqual(got, p) {
+		t.Fatalf("round trip mismatch:\n got  %+v\n want %+v", got, p)
+	}
+}
+
+func TestDecodeRelinksNatives(t *testing.T) {
+	data, err := Encode(sampleProgram())
+	if err != nil {
+		t.Fatalf("encode failed: %v", err)
+	}
+
+	got, err := Decode(data, resolveAt(3))
+	if err != nil {
+		t.Fatalf("decode failed: %v", err)
+	}
+	if got.Code[6].Args != 3 || got.Natives[0].Index != 3 {
+		t.Fatalf("native not relinked: %+v %+v", got.Code[6], got.Natives[0])
+	}
+
+	if _, err := Decode(data, nil); err == nil || !strings.Contains(err.Error(), "no resolver") {
+		t.Fatalf("expected missing resolver error, got %v", err)
+	}
+}
+
+func TestEncodeErrors(t *testing.T) {
+	p := sampleProgram()
+	p.Code[1].Args = 1.5
+	if _, err := Encode(p); err == nil || !strings.Contains(err.Error(), "instruction 1") {
+		t.Errorf("expected non-integral operand error, got %v", err)
+	}
+
+	p = sampleProgram()
+	p.Code[6].Args = 9
+	if _, err := Encode(p); err == nil || !strings.Contains(err.Error(), "native 9") {
+		t.Errorf("expected missing native error, got %v", err)
+	}
+}
+
+func TestDecodeErrors(t *testing.T) {
+	good, err := Encode(sampleProgram())
+	if err != nil {
+		t.Fatalf("encode failed: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		mangle func([]byte) []byte
+		want   string
+	}{
+		{"empty", func(b []byte) []byte { return nil }, "too short"},
+		{"bad magic", func(b []byte) []byte { b[0] = 'X'; return b }, "bad magic"},
+		{"flipped bit", func(b []byte) []byte { b[20] ^= 1; return b }, "checksum mismatch"},
+		{"truncated", func(b []byte) []byte { return b[:len(b)-10] }, "checksum mismatch"},
+		{"version", func(b []byte) []byte { b[4] = 9; reseal(b); return b }, "unsupported format version 9"},
+		{"truncated section", func(b []byte) []byte {
+			b = append(b[:30:30], 0, 0, 0, 0)
+			reseal(b)
+			return b
+		}, "truncated in"},
+		{"unknown opcode", func(b []byte) []byte {
+			// the last instruction (OP_HALT) sits just before the source
+			// map (4-byte count + 6 runs of 12 bytes) and the checksum
+			b[len(b)-4-76-5] = 0xEE
+			reseal(b)
+			return b
+		}, "instruction 7: unknown opcode 238"},
+		{"jump target", func(b []byte) []byte {
+			// OP_JMP is the first instruction; its operand follows the opcode
+			at := strings.Index(string(b), string([]byte{byte(OP_JMP), 5, 0, 0, 0}))
+			binary.LittleEndian.PutUint32(b[at+1:], 99)
+			reseal(b)
+			return b
+		}, "OP_JMP target 99 outside code"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := tt.mangle(append([]byte(nil), good...))
+			_, err := Decode(data, resolveAt(7))
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("expected error containing %q, got %v", tt.want, err)
+			}
+		})
+	}
+}
@@ -12,7 +12,7 @@ const (
 	// Function calls
 	OP_CALL // Call a function (Args = funtion bytecode address)
 	OP_RET // Return from a function (Args = return value count)
-	OP_STORE // Store a value to the stack offset (Args = offset) -- optional for now
+	OP_STORE // Pop a value and store it to the stack offset (Args = offset)
 
 	// Arithmetic operations
 	OP_ADD // pop 2 values, add them, push results
@@ -39,8 +39,32 @@ const (
 	// Control flow operations
 	OP_JMP  // Unconditional jump (Args = target address)
 	OP_HALT // stop execution
+
+	// Comparison and logic operations
+	OP_PUSH_BOOL     // push a bool constant (Args = 0 or 1)
+	OP_EQ            // pop 2 values, push a == b
+	OP_NE            // pop 2 values, push a != b
+	OP_LT            // pop 2 floats, push a < b
+	OP_LE            // pop 2 floats, push a <= b
+	OP_GT            // pop 2 floats, push a > b
+	OP_GE            // pop 2 floats, push a >= b
+	OP_NOT           // pop a bool, push its negation
+	OP_JMP_IF_FALSE  // pop a bool, jump if false (Args = target address)
+
+	// Native functions
+	OP_CALL_NATIVE // Pop the native's args, call it, push the result (Args = native table index)
+
+	// Host inputs
+	OP_LOAD_INPUT // Push the value bound to a host input (Args = input index)
+
+	opCount // number of opcodes -- keep last
 )
 
+// Valid reports whether op is a defined opcode
+func (op OpCode) Valid() bool {
+	return op < opCount
+}
+
 // Instruction represents a complete bytecode instruction
 // Some instructions may require an argument (e.g., OP_PUSH)
 type Instruction struct {
@@ -74,29 +98,53 @@ func (op OpCode) String() string {
 	case OP_HALT:
 		return "OP_HALT"
 	case OP_VADD:
-		return "VADD"
+		return "OP_VADD"
 	case OP_VSUB:
-		return "VSUB"
+		return "OP_VSUB"
 	case OP_VMUL:
-		return "VMUL" // Dot product
+		return "OP_VMUL" // Dot product
 	case OP_VSCALE:
-		return "VSCALE"
+		return "OP_VSCALE"
 	case OP_VCROSS:
-		return "VCROSS"
+		return "OP_VCROSS"
 	case OP_VMAG:
-		return "VMAG"
+		return "OP_VMAG"
+	case OP_VEC3:
+		return "OP_VEC3"
 	case OP_BATCH_PACK:
-		return "BATCH_PACK"
+		return "OP_BATCH_PACK"
 	case OP_BATCH_VADD:
-		return "BATCH_VADD"
+		return "OP_BATCH_VADD"
 	case OP_BATCH_VSUB:
-		return "BATCH_VSUB"
+		return "OP_BATCH_VSUB"
 	case OP_BATCH_VMUL:
-		return "BATCH_VMUL"
+		return "OP_BATCH_VMUL"
 	case OP_BATCH_VSCALE:
-		return "BATCH_VSCALE"
+		return "OP_BATCH_VSCALE"
 	case OP_JMP:
 		return "OP_JMP"
+	case OP_PUSH_BOOL:
+		return "OP_PUSH_BOOL"
+	case OP_EQ:
+		return "OP_EQ"
+	case OP_NE:
+		return "OP_NE"
+	case OP_LT:
+		return "OP_LT"
+	case OP_LE:
+		return "OP_LE"
+	case OP_GT:
+		return "OP_GT"
+	case OP_GE:
+		return "OP_GE"
+	case OP_NOT:
+		return "OP_NOT"
+	case OP_JMP_IF_FALSE:
+		return "OP_JMP_IF_FALSE"
+	case OP_CALL_NATIVE:
+		return "OP_CALL_NATIVE"
+	case OP_LOAD_INPUT:
+		return "OP_LOAD_INPUT"
 	default:
 		return "UNKNOWN_OPCODE"
 	}
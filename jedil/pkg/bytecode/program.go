@@ -0,0 +1,91 @@
+package bytecode
+
+// InputType is the declared type of a host-supplied input.
+type InputType uint8
+
+const (
+	INPUT_FLOAT InputType = iota // input x: float
+	INPUT_VEC3                   // input r: vec3
+)
+
+// String returns the type name as written in source
+func (t InputType) String() string {
+	switch t {
+	case INPUT_FLOAT:
+		return "float"
+	case INPUT_VEC3:
+		return "vec3"
+	default:
+		return "unknown"
+	}
+}
+
+// Input describes one `input name: type` declaration. Inputs occupy the
+// first top-level stack slots in declaration order, and the VM seeds them
+// before execution starts.
+type Input struct {
+	Name string
+	Type InputType
+}
+
+// Function is an entry in a program's function table. Calling it means
+// pushing Params arguments and entering at Address; it leaves Returns values.
+type Function struct {
+	Name    string
+	Address int
+	Params  int
+	Returns int
+}
+
+// Native is a native function a program calls. Index is the OP_CALL_NATIVE
+// operand for it in this process; the name and arity let a loader relink it
+// in another.
+type Native struct {
+	Name  string
+	Arity int
+	Index int
+}
+
+// Local is debug info for a named variable: while Start <= ip < End it
+// lives in Slot of the running frame (top-level slots are absolute, function
+// slots relative to the frame base).
+type Local struct {
+	Name  string
+	Slot  int
+	Start int
+	End   int
+}
+
+// Program is a compiled JEDIL program: its bytecode plus the metadata a host
+// needs to drive it.
+type Program struct {
+	Code      []Instruction
+	Inputs    []Input
+	Functions []Function
+	Natives   []Native
+	Lines     []int   // source line per instruction, 0 if unknown; may be nil
+	Columns   []int   // source column per instruction, parallel to Lines
+	Locals    []Local // variable debug info; not saved in .jbc images
+}
+
+// Position returns the source line and column instruction ip was compiled
+// from, or zeros if the program has no source map.
+func (p *Program) Position(ip int) (line, column int) {
+	if ip >= 0 && ip < len(p.Lines) {
+		line = p.Lines[ip]
+	}
+	if ip >= 0 && ip < len(p.Columns) {
+		column = p.Columns[ip]
+	}
+	return line, column
+}
+
+// Function looks up a function by name.
+func (p *Program) Function(name string) (Function, bool) {
+	for _, fn := range p.Functions {
+		if fn.Name == name {
+			return fn, true
+		}
+	}
+	return Function{}, false
+}
@@ -12,39 +12,68 @@ type Node interface {
 type Expr interface {
 	Node
 	expr()
+	Position() Pos
 }
 
 // NumberLiteral represents a numeric constant
 type NumberLiteral struct {
+	Pos
 	Value float64
 }
 
+// BoolLiteral represents true or false
+type BoolLiteral struct {
+	Pos
+	Value bool
+}
+
 // Identifier represents a variable reference
 type Identifier struct {
+	Pos
 	Name string
 }
 
 // BinaryOp represents a binary operation (a + b, a * b, etc.)
 type BinaryOp struct {
+	Pos
 	Left  Expr
 	Op    TokenType // TOKEN_PLUS, TOKEN_MINUS, etc.
 	Right Expr
 }
 
-// UnaryOp represents a unary operation (-x)
+// UnaryOp represents a unary operation (-x, not x)
 type UnaryOp struct {
-	Op   TokenType // TOKEN_MINUS
+	Pos
+	Op   TokenType // TOKEN_MINUS, TOKEN_NOT
 	Expr Expr
 }
 
+// LogicalOp represents a short-circuiting a and b / a or b
+type LogicalOp struct {
+	Pos
+	Left  Expr
+	Op    TokenType // TOKEN_AND, TOKEN_OR
+	Right Expr
+}
+
+// IfExpr represents: if cond { a } else { b }
+type IfExpr struct {
+	Pos
+	Cond Expr
+	Then Expr
+	Else Expr
+}
+
 // CallExpr represents a function call
 type CallExpr struct {
+	Pos
 	Callee string // Function name
 	Args   []Expr
 }
 
 // Vec3Literal represents vec3(x, y, z)
 type Vec3Literal struct {
+	Pos
 	X Expr
 	Y Expr
 	Z Expr
@@ -55,21 +84,86 @@ type Vec3Literal struct {
 type Stmt interface {
 	Node
 	stmt()
+	Position() Pos
 }
 
+// Pos is a location in the source. Every node embeds it; the parser fills
+// it in from the node's first token, or its operator for binary operations.
+type Pos struct {
+	Line   int
+	Column int
+}
+
+// Position returns the location of the node
+func (p Pos) Position() Pos { return p }
+
+func (p *Pos) setPos(pos Pos) { *p = pos }
+
 // VarDecl represents: let x = expr
 type VarDecl struct {
+	Pos
 	Name  string
 	Value Expr
 }
 
-// ReturnStmt represents: return expr
-type ReturnStmt struct {
+// InputDecl represents: input name: type
+// Type is the type name as written ("float" or "vec3").
+type InputDecl struct {
+	Pos
+	Name string
+	Type string
+}
+
+// AssignStmt represents: x = expr
+type AssignStmt struct {
+	Pos
+	Name  string
 	Value Expr
 }
 
+// MultiVarDecl represents: let a, b = f(...)
+// binding each value returned by a multi-value function
+type MultiVarDecl struct {
+	Pos
+	Names []string
+	Value Expr
+}
+
+// ReturnStmt represents: return expr, or return a, b for multiple values
+type ReturnStmt struct {
+	Pos
+	Values []Expr
+}
+
+// IfStmt represents: if cond { ... } else { ... }
+// Else is nil when there is no else branch; else-if chains nest an IfStmt.
+type IfStmt struct {
+	Pos
+	Cond Expr
+	Then []Stmt
+	Else []Stmt
+}
+
+// WhileStmt represents: while cond { ... }
+type WhileStmt struct {
+	Pos
+	Cond Expr
+	Body []Stmt
+}
+
+// ForStmt represents: for i in start..end { ... }
+// The range is half-open: i takes start, start+1, ... while i < end.
+type ForStmt struct {
+	Pos
+	Var   string
+	Start Expr
+	End   Expr
+	Body  []Stmt
+}
+
 // FnDecl represents a function declaration
 type FnDecl struct {
+	Pos
 	Name   string
 	Params []string
 	Body   []Stmt
@@ -83,12 +177,18 @@ type Program struct {
 // Implement the marker interfaces
 func (NumberLiteral) node() {}
 func (NumberLiteral) expr()  {}
+func (BoolLiteral) node()    {}
+func (BoolLiteral) expr()     {}
 func (Identifier) node()     {}
 func (Identifier) expr()      {}
 func (BinaryOp) node()       {}
 func (BinaryOp) expr()        {}
 func (UnaryOp) node()        {}
 func (UnaryOp) expr()         {}
+func (LogicalOp) node()      {}
+func (LogicalOp) expr()       {}
+func (IfExpr) node()         {}
+func (IfExpr) expr()          {}
 func (CallExpr) node()       {}
 func (CallExpr) expr()        {}
 func (Vec3Literal) node()    {}
@@ -96,8 +196,20 @@ func (Vec3Literal) expr()     {}
 
 func (VarDecl) node()    {}
 func (VarDecl) stmt()     {}
+func (InputDecl) node()  {}
+func (InputDecl) stmt()   {}
+func (AssignStmt) node() {}
+func (AssignStmt) stmt()  {}
+func (MultiVarDecl) node() {}
+func (MultiVarDecl) stmt()  {}
 func (ReturnStmt) node() {}
 func (ReturnStmt) stmt()  {}
+func (IfStmt) node()     {}
+func (IfStmt) stmt()      {}
+func (WhileStmt) node()  {}
+func (WhileStmt) stmt()   {}
+func (ForStmt) node()    {}
+func (ForStmt) stmt()     {}
 func (FnDecl) node()     {}
 func (FnDecl) stmt()      {}
 func (Program) node()    {}
@@ -3,6 +3,11 @@ package compiler
 import (
 	"fmt"
 	"jedil/pkg/bytecode"
+	"jedil/pkg/vm"
+	"maps"
+	"math"
+	"slices"
+	"strings"
 )
 
 type FunctionMetadata struct {
@@ -13,6 +18,23 @@ type FunctionMetadata struct {
 	localCount int // total local vars (params + locals)
 }
 
+// callSite is an emitted OP_CALL and the function it calls. A callee
+// declared further down has no address yet when the call is compiled.
+type callSite struct {
+	at int
+	fn *FunctionMetadata
+}
+
+// constants are names the compiler folds to literals. Variables of the same
+// name shadow them. Astrodynamic values are in km and seconds.
+var constants = map[string]float64{
+	"PI":       math.Pi,
+	"TAU":      2 * math.Pi,
+	"MU_EARTH": 398600.4418,      // km^3/s^2
+	"MU_SUN":   1.32712440018e11, // km^3/s^2
+	"R_EARTH":  6378.1363,        // km, equatorial
+}
+
 // Compiler converts AST to bytecode instructions
 type Compiler struct {
 	instructions []bytecode.Instruction
@@ -24,6 +46,17 @@ type Compiler struct {
 	currentFunction *FunctionMetadata // currently compiling
 	localVars map[string]int // local scope vars
 	inFunction bool // inside func?
+	calls []callSite // OP_CALLs, patched once every function has an address
+
+	inputs []bytecode.Input // host-supplied inputs, in slot order
+	natives []bytecode.Native // natives called by the program
+
+	// debug info
+	pos     Pos   // source position of the node being compiled
+	lines   []int // source line of each emitted instruction
+	columns []int // source column of each emitted instruction
+	locals  []bytecode.Local // every named variable and where it is live
+	open    []int            // indices into locals still in scope, innermost last
 }
 
 // NewCompiler creates a new compiler
@@ -39,18 +72,29 @@ func NewCompiler() *Compiler {
 
 // Compile compiles a program to bytecode
 func (c *Compiler) Compile(program *Program) ([]bytecode.Instruction, error) {
-	// PASS 1: Collect function declarations
+	// PASS 1: Collect function and input declarations
 	var functions []*FnDecl
 	var mainCode []Stmt
 
 	for _, stmt := range program.Statements {
 		if fnDecl, ok := stmt.(*FnDecl); ok {
+			if _, dup := c.functions[fnDecl.Name]; dup {
+				return nil, locate(fmt.Errorf("duplicate function: %s", fnDecl.Name), fnDecl.Pos)
+			}
+			returnCount, err := countReturns(fnDecl.Name, fnDecl.Body)
+			if err != nil {
+				return nil, locate(err, fnDecl.Pos)
+			}
 			functions = append(functions, fnDecl)
 			c.functions[fnDecl.Name] = &FunctionMetadata{
 				name:        fnDecl.Name,
 				address:     -1, // set in pass 2
 				paramCount:  len(fnDecl.Params),
-				returnCount: 1, // default is single return -- extended later
+				returnCount: returnCount,
+			}
+		} else if input, ok := stmt.(*InputDecl); ok {
+			if err := c.declareInput(input); err != nil {
+				return nil, locate(err, input.Pos)
 			}
 		} else {
 			mainCode = append(mainCode, stmt)
@@ -80,20 +124,48 @@ func (c *Compiler) Compile(program *Program) ([]bytecode.Instruction, error) {
 
 	// Add HALT at the end
 	c.emit(bytecode.OP_HALT, 0)
+	c.closeLocals(0)
+
+	// Every function is compiled now, so point each call at its callee
+	for _, call := range c.calls {
+		c.instructions[call.at].Args = float64(call.fn.address)
+	}
 
 	return c.instructions, nil
 }
 
 // Statement compilation
 
-func (c *Compiler) compileStmt(stmt Stmt) error {
+func (c *Compiler) compileStmt(stmt Stmt) (err error) {
+	// attribute emitted instructions to this statement, then back to the
+	// enclosing one (for the jumps that follow a nested block)
+	outer := c.pos
+	c.pos = stmt.Position()
+	defer func() {
+		c.pos = outer
+		err = locate(err, stmt.Position())
+	}()
+
 	switch s := stmt.(type) {
 	case *VarDecl:
 		return c.compileVarDecl(s)
+	case *MultiVarDecl:
+		return c.compileMultiVarDecl(s)
+	case *AssignStmt:
+		return c.compileAssignStmt(s)
+	case *InputDecl:
+		// top-level inputs are collected in pass 1
+		return fmt.Errorf("input %s must be declared at top level", s.Name)
 	case *ReturnStmt:
 		return c.compileReturnStmt(s)
 	case *FnDecl:
 		return c.compileFnDecl(s)
+	case *IfStmt:
+		return c.compileIfStmt(s)
+	case *WhileStmt:
+		return c.compileWhileStmt(s)
+	case *ForStmt:
+		return c.compileForStmt(s)
 	default:
 		return fmt.Errorf("unknown statement type")
 	}
@@ -115,11 +187,15 @@ func (c *Compiler) compileFnDecl(stmt *FnDecl) error {
     // Parameters are already on stack (pushed by caller)
     // They start at position 0 within the function's frame
     // The basePointer at runtime will point to where args begin
+    // Top-level variables aren't visible in here, so set their debug info
+    // aside too
+    outerLocals := c.open
+    c.open = nil
+
     c.stackDepth = 0
-    for i, paramName := range stmt.Params {
-        c.localVars[paramName] = i
+    for _, paramName := range stmt.Params {
+        c.declareVar(paramName)
     }
-    c.stackDepth = len(stmt.Params)
 
     // Compile function body
     for _, bodyStmt := range stmt.Body {
@@ -134,10 +210,14 @@ func (c *Compiler) compileFnDecl(stmt *FnDecl) error {
         _, lastIsReturn = stmt.Body[len(stmt.Body)-1].(*ReturnStmt)
     }
     if !lastIsReturn {
-        // Implicit return: push nil/zero and return
-        c.emit(bytecode.OP_PUSH, 0)
+        // Implicit return: push a zero per return value and return
+        for i := 0; i < fnMeta.returnCount; i++ {
+            c.emit(bytecode.OP_PUSH, 0)
+        }
         c.emit(bytecode.OP_RET, float64(fnMeta.returnCount))
     }
+    c.closeLocals(0)
+    c.open = outerLocals
 
     // Exit function scope
     c.inFunction = false
@@ -148,21 +228,94 @@ func (c *Compiler) compileFnDecl(stmt *FnDecl) error {
 }
 
 func (c *Compiler) compileReturnStmt(stmt *ReturnStmt) error {
-    // Compile return value expression
-    if err := c.compileExpr(stmt.Value); err != nil {
-        return err
+    if !c.inFunction && len(stmt.Values) > 1 {
+        return fmt.Errorf("top-level return takes a single value, got %d", len(stmt.Values))
+    }
+
+    // Compile return value expressions, left to right
+    for _, value := range stmt.Values {
+        if err := c.compileExpr(value); err != nil {
+            return err
+        }
     }
 
     // Only emit OP_RET if we're inside a function
     if c.inFunction {
         // Emit RET with return count
         c.emit(bytecode.OP_RET, float64(c.currentFunction.returnCount))
+    } else {
+        // Top-level returns leave the value on the stack and stop, so a
+        // return inside an if branch doesn't fall through to later code
+        c.emit(bytecode.OP_HALT, 0)
     }
-    // Top-level returns just leave the value on the stack
 
     return nil
 }
 
+// countReturns works out how many values a function returns from the return
+// statements in its body, which must all agree. Functions without any return
+// yield a single zero.
+func countReturns(name string, body []Stmt) (int, error) {
+	count := 0
+	var walk func(stmts []Stmt) error
+	walk = func(stmts []Stmt) error {
+		for _, stmt := range stmts {
+			var err error
+			switch s := stmt.(type) {
+			case *ReturnStmt:
+				if count != 0 && len(s.Values) != count {
+					return fmt.Errorf("function %s returns %d values in one place and %d in another",
+						name, count, len(s.Values))
+				}
+				count = len(s.Values)
+			case *IfStmt:
+				if err = walk(s.Then); err == nil {
+					err = walk(s.Else)
+				}
+			case *WhileStmt:
+				err = walk(s.Body)
+			case *ForStmt:
+				err = walk(s.Body)
+			}
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	if err := walk(body); err != nil {
+		return 0, err
+	}
+	return max(count, 1), nil
+}
+
+func (c *Compiler) compileMultiVarDecl(stmt *MultiVarDecl) error {
+	call, ok := stmt.Value.(*CallExpr)
+	if !ok {
+		return fmt.Errorf("let %s: binding several names needs a function call on the right",
+			strings.Join(stmt.Names, ", "))
+	}
+	fnMeta, ok := c.functions[call.Callee]
+	if !ok {
+		return fmt.Errorf("let %s: %s is not a user-defined function",
+			strings.Join(stmt.Names, ", "), call.Callee)
+	}
+	if fnMeta.returnCount != len(stmt.Names) {
+		return fmt.Errorf("function %s returns %d values, but %d names are bound",
+			call.Callee, fnMeta.returnCount, len(stmt.Names))
+	}
+
+	// The return values land in consecutive slots, in order
+	if err := c.compileUserCall(call, fnMeta); err != nil {
+		return err
+	}
+	for _, name := range stmt.Names {
+		c.declareVar(name)
+	}
+	return nil
+}
+
 func (c *Compiler) compileVarDecl(stmt *VarDecl) error {
     // Compile the value expression
     if err := c.compileExpr(stmt.Value); err != nil {
@@ -170,24 +323,298 @@ func (c *Compiler) compileVarDecl(stmt *VarDecl) error {
     }
 
     // Store variable in appropriate scope
-    if c.inFunction {
-        // Local variable
-        c.localVars[stmt.Name] = c.stackDepth
-    } else {
-        // Global variable
-        c.variables[stmt.Name] = c.stackDepth
-    }
-    c.stackDepth++
+    c.declareVar(stmt.Name)
 
     return nil
 }
 
+// declareInput reserves the next top-level slot for a host-supplied input.
+// The VM pushes inputs before running, so they sit below every let.
+func (c *Compiler) declareInput(decl *InputDecl) error {
+	for _, in := range c.inputs {
+		if in.Name == decl.Name {
+			return fmt.Errorf("duplicate input: %s", decl.Name)
+		}
+	}
+
+	var inputType bytecode.InputType
+	switch decl.Type {
+	case "float":
+		inputType = bytecode.INPUT_FLOAT
+	case "vec3":
+		inputType = bytecode.INPUT_VEC3
+	default:
+		return fmt.Errorf("input %s has unknown type %s", decl.Name, decl.Type)
+	}
+
+	c.inputs = append(c.inputs, bytecode.Input{Name: decl.Name, Type: inputType})
+	c.declareVar(decl.Name)
+	return nil
+}
+
+// Functions returns the function table of the last compiled program, in
+// address order, so hosts can call functions by name.
+func (c *Compiler) Functions() []bytecode.Function {
+	table := make([]bytecode.Function, 0, len(c.functions))
+	for _, fn := range c.functions {
+		table = append(table, bytecode.Function{
+			Name:    fn.name,
+			Address: fn.address,
+			Params:  fn.paramCount,
+			Returns: fn.returnCount,
+		})
+	}
+	slices.SortFunc(table, func(a, b bytecode.Function) int {
+		return a.Address - b.Address
+	})
+	return table
+}
+
+// useNative records that the program calls a native, so it can be relinked
+// by name when the bytecode is loaded elsewhere.
+func (c *Compiler) useNative(index int, native vm.Native) {
+	for _, n := range c.natives {
+		if n.Index == index {
+			return
+		}
+	}
+	c.natives = append(c.natives, bytecode.Native{Name: native.Name, Arity: native.Arity, Index: index})
+}
+
+// Natives returns the natives the last compiled program calls.
+func (c *Compiler) Natives() []bytecode.Native {
+	return c.natives
+}
+
+// Lines returns the source line each instruction was compiled from (0 for
+// compiler-generated code outside any statement).
+func (c *Compiler) Lines() []int {
+	return c.lines
+}
+
+// Locals returns debug info for every named variable: its slot and the
+// range of instructions over which it holds a value.
+func (c *Compiler) Locals() []bytecode.Local {
+	return c.locals
+}
+
+// Columns returns the source column each instruction was compiled from,
+// parallel to Lines.
+func (c *Compiler) Columns() []int {
+	return c.columns
+}
+
+// Inputs returns the inputs declared by the last compiled program, in slot
+// order.
+func (c *Compiler) Inputs() []bytecode.Input {
+	return c.inputs
+}
+
+// inputIndex returns the slot of the named input, or -1 if there is none.
+func (c *Compiler) inputIndex(name string) int {
+	for i, in := range c.inputs {
+		if in.Name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+func (c *Compiler) compileAssignStmt(stmt *AssignStmt) error {
+	// Functions are compiled before top-level code, so inside a function
+	// only its own params and locals are visible
+	scope := c.variables
+	if c.inFunction {
+		scope = c.localVars
+	}
+	offset, ok := scope[stmt.Name]
+	// Inputs hold what the host bound, wherever they're read from, so they
+	// can't be assigned; they sit in the first top-level slots
+	if (!ok && c.inputIndex(stmt.Name) >= 0) || (ok && !c.inFunction && offset < len(c.inputs)) {
+		return fmt.Errorf("cannot assign to input: %s", stmt.Name)
+	}
+	if !ok {
+		return fmt.Errorf("assignment to undeclared variable: %s", stmt.Name)
+	}
+
+	if err := c.compileExpr(stmt.Value); err != nil {
+		return err
+	}
+
+	c.emit(bytecode.OP_STORE, float64(offset))
+	return nil
+}
+
+func (c *Compiler) compileIfStmt(stmt *IfStmt) error {
+	if err := c.compileExpr(stmt.Cond); err != nil {
+		return err
+	}
+	elseJump := c.emitJump(bytecode.OP_JMP_IF_FALSE)
+
+	if err := c.compileBlock(stmt.Then); err != nil {
+		return err
+	}
+
+	if stmt.Else == nil {
+		c.patchJump(elseJump)
+		return nil
+	}
+
+	endJump := c.emitJump(bytecode.OP_JMP)
+	c.patchJump(elseJump)
+	if err := c.compileBlock(stmt.Else); err != nil {
+		return err
+	}
+	c.patchJump(endJump)
+
+	return nil
+}
+
+// compileBlock compiles a nested statement list in its own scope.
+func (c *Compiler) compileBlock(stmts []Stmt) error {
+	scope := c.beginScope()
+
+	for _, stmt := range stmts {
+		if err := c.compileStmt(stmt); err != nil {
+			return err
+		}
+	}
+
+	c.endScope(scope)
+	return nil
+}
+
+func (c *Compiler) compileWhileStmt(stmt *WhileStmt) error {
+	loopStart := len(c.instructions)
+
+	if err := c.compileExpr(stmt.Cond); err != nil {
+		return err
+	}
+	exitJump := c.emitJump(bytecode.OP_JMP_IF_FALSE)
+
+	if err := c.compileBlock(stmt.Body); err != nil {
+		return err
+	}
+	c.emit(bytecode.OP_JMP, float64(loopStart))
+
+	c.patchJump(exitJump)
+	return nil
+}
+
+func (c *Compiler) compileForStmt(stmt *ForStmt) error {
+	scope := c.beginScope()
+
+	// Frame layout: [start, end, i]. Start and end are evaluated once, in
+	// source order; i sits on top so that once the body's own locals are
+	// popped it can be incremented in place with PUSH 1, ADD.
+	startSlot := c.stackDepth
+	if err := c.compileExpr(stmt.Start); err != nil {
+		return err
+	}
+	c.stackDepth++
+
+	endSlot := c.stackDepth
+	if err := c.compileExpr(stmt.End); err != nil {
+		return err
+	}
+	c.stackDepth++
+
+	c.emit(bytecode.OP_LOAD, float64(startSlot))
+	counterSlot := c.declareVar(stmt.Var)
+
+	loopStart := len(c.instructions)
+	c.emit(bytecode.OP_LOAD, float64(counterSlot))
+	c.emit(bytecode.OP_LOAD, float64(endSlot))
+	c.emit(bytecode.OP_LT, 0)
+	exitJump := c.emitJump(bytecode.OP_JMP_IF_FALSE)
+
+	if err := c.compileBlock(stmt.Body); err != nil {
+		return err
+	}
+	c.emit(bytecode.OP_PUSH, 1)
+	c.emit(bytecode.OP_ADD, 0)
+	c.emit(bytecode.OP_JMP, float64(loopStart))
+
+	c.patchJump(exitJump)
+	c.endScope(scope)
+	return nil
+}
+
+// scope is a snapshot taken by beginScope and restored by endScope
+type scope struct {
+	vars  map[string]int
+	depth int
+}
+
+func (c *Compiler) beginScope() scope {
+	vars := c.variables
+	if c.inFunction {
+		vars = c.localVars
+	}
+	return scope{vars: maps.Clone(vars), depth: c.stackDepth}
+}
+
+// endScope pops every slot declared since beginScope, so every path through
+// a branch or loop body leaves the stack at the depth it started with, and
+// forgets the names bound to them.
+func (c *Compiler) endScope(s scope) {
+	c.closeLocals(s.depth)
+	for i := s.depth; i < c.stackDepth; i++ {
+		c.emit(bytecode.OP_POP, 0)
+	}
+	c.stackDepth = s.depth
+
+	if c.inFunction {
+		c.localVars = s.vars
+	} else {
+		c.variables = s.vars
+	}
+}
+
+// declareVar binds name to the slot at the current stack depth, which the
+// value just compiled occupies, and returns that slot.
+func (c *Compiler) declareVar(name string) int {
+	slot := c.stackDepth
+	if c.inFunction {
+		// Local variable
+		c.localVars[name] = slot
+	} else {
+		// Global variable
+		c.variables[name] = slot
+	}
+	c.stackDepth++
+
+	// live from the next instruction: the value is already in place
+	c.open = append(c.open, len(c.locals))
+	c.locals = append(c.locals, bytecode.Local{Name: name, Slot: slot, Start: len(c.instructions)})
+	return slot
+}
+
+// closeLocals ends the live range of the open variables in slots >= depth
+// at the next instruction to be emitted.
+func (c *Compiler) closeLocals(depth int) {
+	for len(c.open) > 0 && c.locals[c.open[len(c.open)-1]].Slot >= depth {
+		c.locals[c.open[len(c.open)-1]].End = len(c.instructions)
+		c.open = c.open[:len(c.open)-1]
+	}
+}
+
 // Expression compilation
 
-func (c *Compiler) compileExpr(expr Expr) error {
+func (c *Compiler) compileExpr(expr Expr) (err error) {
+	// as for statements, so an operator's instruction maps to the operator
+	outer := c.pos
+	c.pos = expr.Position()
+	defer func() {
+		c.pos = outer
+		err = locate(err, expr.Position())
+	}()
+
 	switch e := expr.(type) {
 	case *NumberLiteral:
 		return c.compileNumber(e)
+	case *BoolLiteral:
+		return c.compileBool(e)
 	case *Identifier:
 		return c.compileIdentifier(e)
 	case *BinaryOp:
@@ -198,6 +625,10 @@ func (c *Compiler) compileExpr(expr Expr) error {
 		return c.compileVec3Literal(e)
 	case *CallExpr:
 		return c.compileCallExpr(e)
+	case *LogicalOp:
+		return c.compileLogicalOp(e)
+	case *IfExpr:
+		return c.compileIfExpr(e)
 	default:
 		return fmt.Errorf("unknown expression type")
 	}
@@ -208,18 +639,37 @@ func (c *Compiler) compileNumber(expr *NumberLiteral) error {
 	return nil
 }
 
+func (c *Compiler) compileBool(expr *BoolLiteral) error {
+	if expr.Value {
+		c.emit(bytecode.OP_PUSH_BOOL, 1)
+	} else {
+		c.emit(bytecode.OP_PUSH_BOOL, 0)
+	}
+	return nil
+}
+
 func (c *Compiler) compileIdentifier(expr *Identifier) error {
-	// Check local variables first (if in function)
-    if c.inFunction {
-        if offset, ok := c.localVars[expr.Name]; ok {
-            c.emit(bytecode.OP_LOAD, float64(offset))
-            return nil
-        }
-    }
-	
+	// As with assignment, a function sees only its own params and locals:
+	// top-level slots are absolute but LOAD is relative to the function's
+	// frame
+	scope := c.variables
+	if c.inFunction {
+		scope = c.localVars
+	}
+
 	// Look up the variable
-	offset, ok := c.variables[expr.Name]
+	offset, ok := scope[expr.Name]
 	if !ok {
+		// Inputs are read from the bound values instead, so functions see
+		// them too, even when called directly without top-level code
+		if index := c.inputIndex(expr.Name); index >= 0 {
+			c.emit(bytecode.OP_LOAD_INPUT, float64(index))
+			return nil
+		}
+		if value, isConst := constants[expr.Name]; isConst {
+			c.emit(bytecode.OP_PUSH, value)
+			return nil
+		}
 		return fmt.Errorf("undefined variable: %s", expr.Name)
 	}
 
@@ -251,6 +701,18 @@ func (c *Compiler) compileBinaryOp(expr *BinaryOp) error {
 		c.emit(bytecode.OP_MUL, 0)
 	case TOKEN_SLASH:
 		c.emit(bytecode.OP_DIV, 0)
+	case TOKEN_EQUAL_EQUAL:
+		c.emit(bytecode.OP_EQ, 0)
+	case TOKEN_BANG_EQUAL:
+		c.emit(bytecode.OP_NE, 0)
+	case TOKEN_LESS:
+		c.emit(bytecode.OP_LT, 0)
+	case TOKEN_LESS_EQUAL:
+		c.emit(bytecode.OP_LE, 0)
+	case TOKEN_GREATER:
+		c.emit(bytecode.OP_GT, 0)
+	case TOKEN_GREATER_EQUAL:
+		c.emit(bytecode.OP_GE, 0)
 	default:
 		return fmt.Errorf("unknown binary operator: %v", expr.Op)
 	}
@@ -270,6 +732,8 @@ func (c *Compiler) compileUnaryOp(expr *UnaryOp) error {
 		// Negate: multiply by -1
 		c.emit(bytecode.OP_PUSH, -1.0)
 		c.emit(bytecode.OP_MUL, 0)
+	case TOKEN_NOT:
+		c.emit(bytecode.OP_NOT, 0)
 	default:
 		return fmt.Errorf("unknown unary operator: %v", expr.Op)
 	}
@@ -277,6 +741,61 @@ func (c *Compiler) compileUnaryOp(expr *UnaryOp) error {
 	return nil
 }
 
+func (c *Compiler) compileLogicalOp(expr *LogicalOp) error {
+	if err := c.compileExpr(expr.Left); err != nil {
+		return err
+	}
+
+	// JMP_IF_FALSE consumes the condition, so the short-circuit path has to
+	// push the result back itself
+	switch expr.Op {
+	case TOKEN_AND:
+		// false and _ -> false, true and b -> b
+		shortJump := c.emitJump(bytecode.OP_JMP_IF_FALSE)
+		if err := c.compileExpr(expr.Right); err != nil {
+			return err
+		}
+		endJump := c.emitJump(bytecode.OP_JMP)
+		c.patchJump(shortJump)
+		c.emit(bytecode.OP_PUSH_BOOL, 0)
+		c.patchJump(endJump)
+	case TOKEN_OR:
+		// true or _ -> true, false or b -> b
+		rightJump := c.emitJump(bytecode.OP_JMP_IF_FALSE)
+		c.emit(bytecode.OP_PUSH_BOOL, 1)
+		endJump := c.emitJump(bytecode.OP_JMP)
+		c.patchJump(rightJump)
+		if err := c.compileExpr(expr.Right); err != nil {
+			return err
+		}
+		c.patchJump(endJump)
+	default:
+		return fmt.Errorf("unknown logical operator: %v", expr.Op)
+	}
+
+	return nil
+}
+
+func (c *Compiler) compileIfExpr(expr *IfExpr) error {
+	if err := c.compileExpr(expr.Cond); err != nil {
+		return err
+	}
+	elseJump := c.emitJump(bytecode.OP_JMP_IF_FALSE)
+
+	if err := c.compileExpr(expr.Then); err != nil {
+		return err
+	}
+	endJump := c.emitJump(bytecode.OP_JMP)
+
+	c.patchJump(elseJump)
+	if err := c.compileExpr(expr.Else); err != nil {
+		return err
+	}
+	c.patchJump(endJump)
+
+	return nil
+}
+
 func (c *Compiler) compileVec3Literal(expr *Vec3Literal) error {
 	// Compile x, y, z components
 	if err := c.compileExpr(expr.X); err != nil {
@@ -298,29 +817,12 @@ func (c *Compiler) compileVec3Literal(expr *Vec3Literal) error {
 func (c *Compiler) compileCallExpr(expr *CallExpr) error {
 	// Check if it's a user-defined function
     if fnMeta, ok := c.functions[expr.Callee]; ok {
-        // Validate parameter count
-        if len(expr.Args) != fnMeta.paramCount {
-            return fmt.Errorf("function %s expects %d arguments, got %d",
-                expr.Callee, fnMeta.paramCount, len(expr.Args))
-        }
-
-        // Compile arguments (left to right, pushed onto stack)
-        for _, arg := range expr.Args {
-            if err := c.compileExpr(arg); err != nil {
-                return err
-            }
+        // An expression has room for exactly one value
+        if fnMeta.returnCount != 1 {
+            return fmt.Errorf("function %s returns %d values; bind them with let a, b = %s(...)",
+                expr.Callee, fnMeta.returnCount, expr.Callee)
         }
-
-        // Push parameter count before CALL so VM knows where basePointer should be
-        c.emit(bytecode.OP_PUSH, float64(len(expr.Args)))
-
-        // Emit CALL instruction
-        c.emit(bytecode.OP_CALL, float64(fnMeta.address))
-
-        // Note: Return values are left on stack as temporary expression results
-        // stackDepth is only incremented when stored to a variable in compileVarDecl
-
-        return nil
+        return c.compileUserCall(expr, fnMeta)
     }
 	
 	// Handle built-in functions
@@ -360,10 +862,51 @@ func (c *Compiler) compileCallExpr(expr *CallExpr) error {
 		}
 		c.emit(bytecode.OP_VMAG, 0)
 		return nil
+	}
 
-	default:
-		return fmt.Errorf("unknown function: %s", expr.Callee)
+	// Native function table (math library and host-registered natives)
+	if index, native, ok := vm.LookupNative(expr.Callee); ok {
+		if len(expr.Args) != native.Arity {
+			return fmt.Errorf("%s() expects %d arguments, got %d", expr.Callee, native.Arity, len(expr.Args))
+		}
+		for _, arg := range expr.Args {
+			if err := c.compileExpr(arg); err != nil {
+				return err
+			}
+		}
+		c.useNative(index, native)
+		c.emit(bytecode.OP_CALL_NATIVE, float64(index))
+		return nil
 	}
+
+	return fmt.Errorf("unknown function: %s", expr.Callee)
+}
+
+func (c *Compiler) compileUserCall(expr *CallExpr, fnMeta *FunctionMetadata) error {
+    // Validate parameter count
+    if len(expr.Args) != fnMeta.paramCount {
+        return fmt.Errorf("function %s expects %d arguments, got %d",
+            expr.Callee, fnMeta.paramCount, len(expr.Args))
+    }
+
+    // Compile arguments (left to right, pushed onto stack)
+    for _, arg := range expr.Args {
+        if err := c.compileExpr(arg); err != nil {
+            return err
+        }
+    }
+
+    // Push parameter count before CALL so VM knows where basePointer should be
+    c.emit(bytecode.OP_PUSH, float64(len(expr.Args)))
+
+    // Emit CALL instruction; the address is filled in at the end of Compile
+    c.calls = append(c.calls, callSite{at: len(c.instructions), fn: fnMeta})
+    c.emit(bytecode.OP_CALL, float64(fnMeta.address))
+
+    // Note: Return values are left on stack as temporary expression results
+    // stackDepth is only incremented when stored to a variable in compileVarDecl
+
+    return nil
 }
 
 // Helper to emit an instruction
@@ -372,6 +915,20 @@ func (c *Compiler) emit(op bytecode.OpCode, args float64) {
 		Op:   op,
 		Args: args,
 	})
+	c.lines = append(c.lines, c.pos.Line)
+	c.columns = append(c.columns, c.pos.Column)
+}
+
+// emitJump emits a jump with a placeholder target and returns its index for
+// patchJump
+func (c *Compiler) emitJump(op bytecode.OpCode) int {
+	c.emit(op, 0)
+	return len(c.instructions) - 1
+}
+
+// patchJump points the jump at index to the next instruction to be emitted
+func (c *Compiler) patchJump(index int) {
+	c.instructions[index].Args = float64(len(c.instructions))
 }
 
 // CompileSource is a convenience function that lexes, parses, and compiles in one go
@@ -387,3 +944,30 @@ func CompileSource(source string) ([]bytecode.Instruction, error) {
 	compiler := NewCompiler()
 	return compiler.Compile(program)
 }
+
+// CompileProgram is like CompileSource but also returns the metadata (declared
+// inputs, the function table, natives and source positions) a host needs to drive,
+// save or debug the program.
+func CompileProgram(source string) (*bytecode.Program, error) {
+	parser := NewParser(source)
+	program, err := parser.Parse()
+	if err != nil {
+		return nil, err
+	}
+
+	compiler := NewCompiler()
+	code, err := compiler.Compile(program)
+	if err != nil {
+		return nil, err
+	}
+
+	return &bytecode.Program{
+		Code:      code,
+		Inputs:    compiler.Inputs(),
+		Functions: compiler.Functions(),
+		Natives:   compiler.Natives(),
+		Lines:     compiler.Lines(),
+		Columns:   compiler.Columns(),
+		Locals:    compiler.Locals(),
+	}, nil
+}
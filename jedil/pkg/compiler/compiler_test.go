@@ -0,0 +1,796 @@
+package compiler
+
+import (
+	"errors"
+	"jedil/pkg/bytecode"
+	"jedil/pkg/types"
+	"jedil/pkg/vm"
+	"math"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// run compiles and executes source, returning the value left on the stack.
+func run(t *testing.T, source string) vm.Value {
+	t.Helper()
+
+	program, err := CompileProgram(source)
+	if err != nil {
+		t.Fatalf("compile failed: %v", err)
+	}
+	if err := vm.Verify(program); err != nil {
+		t.Fatalf("compiled code failed verification: %v\n%s", err, bytecode.Disassemble(program))
+	}
+
+	machine := vm.New(program.Code)
+	if err := machine.Run(); err != nil {
+		t.Fatalf("run failed: %v", err)
+	}
+
+	result, err := machine.GetResult()
+	if err != nil {
+		t.Fatalf("no result: %v", err)
+	}
+	return result
+}
+
+func expectFloat(t *testing.T, source string, want float64) {
+	t.Helper()
+	got := run(t, source)
+	if !got.IsFloat() || got.AsFloat() != want {
+		t.Fatalf("expected %g, got %s", want, got.String())
+	}
+}
+
+func expectBool(t *testing.T, source string, want bool) {
+	t.Helper()
+	got := run(t, source)
+	if !got.IsBool() || got.AsBool() != want {
+		t.Fatalf("expected %v, got %s", want, got.String())
+	}
+}
+
+func TestComparisons(t *testing.T) {
+	cases := []struct {
+		source string
+		want   bool
+	}{
+		{"return 1 < 2", true},
+		{"return 2 <= 2", true},
+		{"return 3 > 4", false},
+		{"return 4 >= 5", false},
+		{"return 1 + 1 == 2", true},
+		{"return 1 != 1", false},
+		{"return vec3(1, 2, 3) == vec3(1, 2, 3)", true},
+		{"return vec3(1, 2, 3) != vec3(1, 2, 4)", true},
+		{"return true == not false", true},
+	}
+	for _, tc := range cases {
+		expectBool(t, tc.source, tc.want)
+	}
+}
+
+func TestLogicShortCircuits(t *testing.T) {
+	// the right-hand side would fail at runtime (division by zero) if evaluated
+	expectBool(t, "return false and 1 / 0 > 0", false)
+	expectBool(t, "return true or 1 / 0 > 0", true)
+	expectBool(t, "return 1 < 2 and 2 < 3", true)
+	expectBool(t, "return 1 > 2 or not (2 > 3)", true)
+}
+
+func TestIfStatement(t *testing.T) {
+	source := `
+fn sign(x) {
+    if x < 0 {
+        return -1
+    } else if x == 0 {
+        return 0
+    }
+    return 1
+}
+let a = sign(-5)
+let b = sign(0)
+let c = sign(7)
+return a * 100 + b * 10 + c`
+	expectFloat(t, source, -99)
+}
+
+func TestIfBlockScope(t *testing.T) {
+	// lets inside a branch are popped so later slots line up on both paths
+	source := `
+let a = 1
+if a > 0 {
+    let tmp = 10
+    let tmp2 = tmp * 2
+} else {
+    let other = 3
+}
+let b = 5
+return a + b`
+	expectFloat(t, source, 6)
+}
+
+func TestTopLevelReturnInsideIf(t *testing.T) {
+	expectFloat(t, "if 1 < 2 { return 1 }\nreturn 2", 1)
+	expectFloat(t, "if 1 > 2 { return 1 }\nreturn 2", 2)
+}
+
+func TestIfExpression(t *testing.T) {
+	source := `
+fn clampUnit(x) {
+    return if x < 0 { 0 } else if x > 1 { 1 } else { x }
+}
+let lo = clampUnit(-3)
+let mid = clampUnit(0.25)
+let hi = clampUnit(8)
+return lo + mid + hi`
+	expectFloat(t, source, 1.25)
+}
+
+func TestConditionMustBeBool(t *testing.T) {
+	instructions, err := CompileSource("if 1 { return 1 }\nreturn 2")
+	if err != nil {
+		t.Fatalf("compile failed: %v", err)
+	}
+	err = vm.New(instructions).Run()
+	if err == nil || !strings.Contains(err.Error(), "expected bool") {
+		t.Fatalf("expected a bool condition error, got %v", err)
+	}
+}
+
+func TestIfExpressionRequiresElse(t *testing.T) {
+	_, err := CompileSource("let x = if 1 < 2 { 1 }\nreturn x")
+	if err == nil || !strings.Contains(err.Error(), "Expected 'else'") {
+		t.Fatalf("expected missing else error, got %v", err)
+	}
+}
+
+func TestForRange(t *testing.T) {
+	// first i in [0, 20) with i*i > 50
+	expectFloat(t, "for i in 0..20 {\n    if i * i > 50 { return i }\n}\nreturn -1", 8)
+
+	// empty and reversed ranges never run the body
+	expectFloat(t, "for i in 5..5 { return i }\nreturn -1", -1)
+	expectFloat(t, "for i in 5..0 { return i }\nreturn -1", -1)
+}
+
+func TestForRangeInFunction(t *testing.T) {
+	source := `
+fn firstSquareAbove(k, from, to) {
+    for i in from..to {
+        let sq = i * i
+        if sq > k {
+            return i
+        }
+    }
+    return -1
+}
+let a = firstSquareAbove(50, 0, 20)
+let b = firstSquareAbove(1000, 0, 20)
+return a * 10 + b`
+	expectFloat(t, source, 79)
+}
+
+func TestLoopBodyLocalsArePopped(t *testing.T) {
+	// each iteration pushes two locals; without popping them the 256-slot
+	// stack would overflow long before the loop finishes
+	source := `
+let base = 2
+for i in 0..1000 {
+    let a = i * base
+    let b = a + 1
+}
+return base`
+	expectFloat(t, source, 2)
+}
+
+func TestWhileFalseSkipsBody(t *testing.T) {
+	expectFloat(t, "while 1 > 2 { return 1 }\nreturn 2", 2)
+}
+
+func TestInfiniteLoopHitsBudget(t *testing.T) {
+	instructions, err := CompileSource("while true { let x = 1 }\nreturn 0")
+	if err != nil {
+		t.Fatalf("compile failed: %v", err)
+	}
+
+	machine := vm.New(instructions)
+	machine.SetInstructionBudget(10000)
+	if err := machine.Run(); !errors.Is(err, vm.ErrBudgetExceeded) {
+		t.Fatalf("expected budget error, got %v", err)
+	}
+}
+
+func TestAssignmentAtTopLevel(t *testing.T) {
+	expectFloat(t, "let sum = 0\nfor i in 1..11 {\n    sum = sum + i\n}\nreturn sum", 55)
+}
+
+func TestAssignmentToParamsAndLocals(t *testing.T) {
+	// Newton's method for sqrt(a), iterating until the step is tiny
+	source := `
+fn newtonSqrt(a) {
+    let x = a
+    let step = 1
+    let iter = 0
+    while (step > 0.000000001 or step < -0.000000001) and iter < 50 {
+        let next = (x + a / x) / 2
+        step = next - x
+        x = next
+        iter = iter + 1
+    }
+    return x
+}
+fn countdown(n) {
+    while n > 0 {
+        n = n - 1
+    }
+    return n
+}
+return newtonSqrt(2) + countdown(5)`
+	got := run(t, source)
+	if d := got.AsFloat() - 1.4142135623730951; d > 1e-12 || d < -1e-12 {
+		t.Fatalf("expected sqrt(2), got %s", got.String())
+	}
+}
+
+func TestAssignLoopCounter(t *testing.T) {
+	// skipping ahead inside the body advances the loop
+	expectFloat(t, "let n = 0\nfor i in 0..10 {\n    n = n + 1\n    i = i + 1\n}\nreturn n", 5)
+}
+
+func TestAssignmentErrors(t *testing.T) {
+	cases := []struct {
+		source string
+		want   string
+	}{
+		{"x = 1\nreturn x", "undeclared variable: x"},
+		{"let a = 1\nif a > 0 {\n    let b = 2\n}\nb = 3\nreturn a", "undeclared variable: b"},
+		{"let g = 1\nfn f(x) {\n    g = x\n    return x\n}\nreturn f(2)", "undeclared variable: g"},
+	}
+	for _, tc := range cases {
+		_, err := CompileSource(tc.source)
+		if err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Fatalf("%q: expected error containing %q, got %v", tc.source, tc.want, err)
+		}
+	}
+}
+
+func TestInputs(t *testing.T) {
+	program, err := CompileProgram(`
+input r: vec3
+input dt: float
+let scaled = r * dt
+return scaled + r`)
+	if err != nil {
+		t.Fatalf("compile failed: %v", err)
+	}
+	if len(program.Inputs) != 2 || program.Inputs[0].Name != "r" || program.Inputs[1].Type != bytecode.INPUT_FLOAT {
+		t.Fatalf("unexpected inputs: %+v", program.Inputs)
+	}
+
+	machine := vm.NewFromProgram(program)
+	if err := machine.SetInput("r", vm.NewVec3(types.NewVec3(1, 2, 3))); err != nil {
+		t.Fatal(err)
+	}
+
+	// one program, evaluated over several states
+	for _, dt := range []float64{0, 1, 0.5} {
+		if err := machine.SetInputAt(1, vm.NewFloat(dt)); err != nil {
+			t.Fatal(err)
+		}
+		machine.Reset()
+		if err := machine.Run(); err != nil {
+			t.Fatalf("run failed: %v", err)
+		}
+		result, _ := machine.GetResult()
+		want := types.NewVec3(1, 2, 3).Scale(1 + dt)
+		if result.AsVec3() != want {
+			t.Fatalf("dt=%g: expected %s, got %s", dt, want.String(), result.String())
+		}
+	}
+
+	if err := machine.SetInput("dt", vm.NewVec3(types.Vec3{})); err == nil {
+		t.Fatal("expected type mismatch binding a vec3 to a float input")
+	}
+	if err := machine.SetInput("missing", vm.NewFloat(1)); err == nil {
+		t.Fatal("expected error for unknown input")
+	}
+}
+
+func TestFunctionsReadInputs(t *testing.T) {
+	program, err := CompileProgram(`
+input dt: float
+input v: vec3
+fn step(x) {
+    return x * dt
+}
+fn drift(p) {
+    let dt = 2
+    return p + v * dt
+}
+return step(2)`)
+	if err != nil {
+		t.Fatalf("compile failed: %v", err)
+	}
+	if err := vm.Verify(program); err != nil {
+		t.Fatalf("compiled code failed verification: %v\n%s", err, bytecode.Disassemble(program))
+	}
+
+	machine := vm.NewFromProgram(program)
+	machine.SetInput("dt", vm.NewFloat(10))
+	machine.SetInput("v", vm.NewVec3(types.NewVec3(1, 0, 0)))
+	if err := machine.Run(); err != nil {
+		t.Fatalf("run failed: %v", err)
+	}
+	if result, _ := machine.GetResult(); result.AsFloat() != 20 {
+		t.Fatalf("expected 20, got %s", result.String())
+	}
+
+	// called directly, with no top-level code to seed the input slots; a
+	// local shadows the input of the same name
+	results, err := machine.CallFunction("drift", vm.NewVec3(types.NewVec3(0, 1, 0)))
+	if err != nil || results[0].AsVec3() != types.NewVec3(2, 1, 0) {
+		t.Fatalf("expected (2, 1, 0), got %v (%v)", results, err)
+	}
+}
+
+func TestInputDeclarationErrors(t *testing.T) {
+	cases := []struct {
+		source string
+		want   string
+	}{
+		{"input x: float\ninput x: vec3\nreturn x", "duplicate input: x"},
+		{"fn f(a) {\n    input x: float\n    return a\n}\nreturn f(1)", "must be declared at top level"},
+		{"input x: bool\nreturn x", "Expected input type"},
+		{"input dt: float\ndt = 1\nreturn dt", "cannot assign to input: dt"},
+		{"input dt: float\nfn f(x) {\n    dt = x\n    return x\n}\nreturn f(2)", "cannot assign to input: dt"},
+	}
+	for _, tc := range cases {
+		_, err := CompileProgram(tc.source)
+		if err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Fatalf("%q: expected error containing %q, got %v", tc.source, tc.want, err)
+		}
+	}
+}
+
+func TestMultipleReturnValues(t *testing.T) {
+	source := `
+fn divmod(a, b) {
+    let q = 0
+    while a >= b {
+        a = a - b
+        q = q + 1
+    }
+    return q, a
+}
+let q, r = divmod(17, 5)
+return q * 10 + r`
+	expectFloat(t, source, 32)
+}
+
+func TestCallFunctionDeclaredLater(t *testing.T) {
+	source := `
+fn hypot(a, b) {
+    let s, d = sumdiff(a * a, b * b)
+    return sqrt(s)
+}
+fn sumdiff(x, y) {
+    return x + y, x - y
+}
+return hypot(3, 4)`
+	expectFloat(t, source, 5)
+
+	program, err := CompileProgram(source)
+	if err != nil {
+		t.Fatalf("compile failed: %v", err)
+	}
+	results, err := vm.NewFromProgram(program).CallFunction("hypot", vm.NewFloat(6), vm.NewFloat(8))
+	if err != nil || results[0].AsFloat() != 10 {
+		t.Fatalf("expected 10, got %v (%v)", results, err)
+	}
+}
+
+func TestMultipleReturnErrors(t *testing.T) {
+	cases := []struct {
+		source string
+		want   string
+	}{
+		{"fn f(x) {\n    if x > 0 { return x, x }\n    return x\n}\nreturn 1", "returns 2 values in one place and 1"},
+		{"fn f(x) {\n    return x, x\n}\nreturn f(1) + 1", "bind them with let"},
+		{"fn f(x) {\n    return x, x\n}\nlet a, b, c = f(1)\nreturn a", "returns 2 values, but 3 names"},
+		{"let a, b = 1\nreturn a", "needs a function call"},
+		{"return 1, 2", "top-level return takes a single value"},
+		{"fn f(x) {\n    return x\n}\nfn f(y) {\n    return y\n}\nreturn f(1)", "duplicate function: f"},
+	}
+	for _, tc := range cases {
+		_, err := CompileSource(tc.source)
+		if err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Fatalf("%q: expected error containing %q, got %v", tc.source, tc.want, err)
+		}
+	}
+}
+
+func TestCallFunction(t *testing.T) {
+	program, err := CompileProgram(`
+fn toPolar(v) {
+    return mag(v), dot(v, vec3(1, 0, 0)) / mag(v)
+}
+fn scale(v, k) {
+    return v * k
+}
+fn noReturn(x) {
+    let y = x
+}
+return 0`)
+	if err != nil {
+		t.Fatalf("compile failed: %v", err)
+	}
+
+	fn, ok := program.Function("toPolar")
+	if !ok || fn.Params != 1 || fn.Returns != 2 {
+		t.Fatalf("unexpected function table entry: %+v", fn)
+	}
+
+	machine := vm.NewFromProgram(program)
+	results, err := machine.CallFunction("toPolar", vm.NewVec3(types.NewVec3(3, 4, 0)))
+	if err != nil {
+		t.Fatalf("call failed: %v", err)
+	}
+	if len(results) != 2 || results[0].AsFloat() != 5 || results[1].AsFloat() != 0.6 {
+		t.Fatalf("unexpected results: %v", results)
+	}
+
+	// calls don't disturb each other or top-level execution
+	results, err = machine.CallFunction("scale", vm.NewVec3(types.NewVec3(1, 2, 3)), vm.NewFloat(2))
+	if err != nil || results[0].AsVec3() != types.NewVec3(2, 4, 6) {
+		t.Fatalf("unexpected scale result: %v (%v)", results, err)
+	}
+	results, err = machine.CallFunction("noReturn", vm.NewFloat(5))
+	if err != nil || len(results) != 1 || results[0].AsFloat() != 0 {
+		t.Fatalf("expected implicit zero return, got %v (%v)", results, err)
+	}
+	machine.Reset()
+	if err := machine.Run(); err != nil {
+		t.Fatalf("run failed: %v", err)
+	}
+
+	if _, err := machine.CallFunction("scale", vm.NewFloat(1)); err == nil {
+		t.Fatal("expected arity error")
+	}
+	if _, err := machine.CallFunction("missing"); err == nil {
+		t.Fatal("expected unknown function error")
+	}
+}
+
+func TestMathLibrary(t *testing.T) {
+	cases := []struct {
+		source string
+		want   float64
+	}{
+		{"return sqrt(16)", 4},
+		{"return sin(PI / 2)", 1},
+		{"return cos(0)", 1},
+		{"return atan2(1, 1) * 4", math.Pi},
+		{"return exp(log(5))", 5},
+		{"return pow(2, 10)", 1024},
+		{"return abs(-3) + floor(2.7)", 5},
+		{"return min(3, 7) * 10 + max(3, 7)", 37},
+		{"return clamp(12, 0, 10) + clamp(-4, 0, 10)", 10},
+		{"return acos(1) + asin(0) + tan(0)", 0},
+		{"return TAU / PI", 2},
+		// variables shadow constants
+		{"let PI = 3\nreturn PI", 3},
+	}
+	for _, tc := range cases {
+		got := run(t, tc.source)
+		if math.Abs(got.AsFloat()-tc.want) > 1e-12 {
+			t.Fatalf("%q: expected %g, got %s", tc.source, tc.want, got.String())
+		}
+	}
+}
+
+func TestKeplerSolver(t *testing.T) {
+	// Newton-Raphson on E - e sin E = M
+	source := `
+fn kepler(M, e) {
+    let E = M
+    for i in 0..30 {
+        let dE = (E - e * sin(E) - M) / (1 - e * cos(E))
+        E = E - dE
+        if abs(dE) < 0.000000000001 {
+            return E
+        }
+    }
+    return E
+}
+let E = kepler(1, 0.3)
+return E - 0.3 * sin(E)`
+	got := run(t, source)
+	if math.Abs(got.AsFloat()-1) > 1e-12 {
+		t.Fatalf("expected M = 1 back, got %s", got.String())
+	}
+
+	// circular orbit speed at 7000 km: sqrt(mu / r)
+	got = run(t, "return sqrt(MU_EARTH / 7000)")
+	if math.Abs(got.AsFloat()-7.5460533) > 1e-6 {
+		t.Fatalf("unexpected circular speed %s", got.String())
+	}
+}
+
+func TestNativeErrors(t *testing.T) {
+	if _, err := CompileSource("return atan2(1)"); err == nil || !strings.Contains(err.Error(), "atan2() expects 2 arguments, got 1") {
+		t.Fatalf("expected arity error, got %v", err)
+	}
+
+	instructions, err := CompileSource("return sqrt(-1)")
+	if err != nil {
+		t.Fatalf("compile failed: %v", err)
+	}
+	if err := vm.New(instructions).Run(); err == nil || !strings.Contains(err.Error(), "sqrt: square root of negative") {
+		t.Fatalf("expected domain error, got %v", err)
+	}
+}
+
+func TestRegisterNative(t *testing.T) {
+	scaleHeight := 8.5
+	density := func(args []vm.Value) (vm.Value, error) {
+		return vm.NewFloat(1.225 * math.Exp(-args[0].AsFloat()/scaleHeight)), nil
+	}
+	if err := vm.RegisterNative("test_density", 1, density); err != nil {
+		t.Fatal(err)
+	}
+
+	expectFloat(t, "return test_density(0)", 1.225)
+	if _, err := CompileSource("return test_density(1, 2)"); err == nil || !strings.Contains(err.Error(), "expects 1 arguments, got 2") {
+		t.Fatalf("expected arity error, got %v", err)
+	}
+
+	// replacing keeps the index, so already compiled code picks it up
+	instructions, err := CompileSource("return test_density(0)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := vm.RegisterNative("test_density", 1, func(args []vm.Value) (vm.Value, error) {
+		return vm.NewFloat(2), nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	machine := vm.New(instructions)
+	if err := machine.Run(); err != nil {
+		t.Fatal(err)
+	}
+	if result, _ := machine.GetResult(); result.AsFloat() != 2 {
+		t.Fatalf("expected replaced native to run, got %s", result.String())
+	}
+
+	// script functions shadow natives
+	expectFloat(t, "fn test_density(h) {\n    return h\n}\nreturn test_density(7)", 7)
+
+	for _, bad := range []struct {
+		name  string
+		arity int
+	}{
+		{"test_density", 2}, // arity change
+		{"sqrt", 1},         // standard library
+		{"dot", 2},          // compiled to its own opcode
+		{"", 1},
+	} {
+		if err := vm.RegisterNative(bad.name, bad.arity, density); err == nil {
+			t.Fatalf("expected RegisterNative(%q, %d) to fail", bad.name, bad.arity)
+		}
+	}
+}
+
+func TestBytecodeImageRoundTrip(t *testing.T) {
+	source := `
+input x: float
+fn twice(v) {
+    return 2 * v
+}
+return twice(sqrt(x))`
+	program, err := CompileProgram(source)
+	if err != nil {
+		t.Fatalf("compile failed: %v", err)
+	}
+
+	data, err := bytecode.Encode(program)
+	if err != nil {
+		t.Fatalf("encode failed: %v", err)
+	}
+	loaded, err := bytecode.Decode(data, vm.ResolveNative)
+	if err != nil {
+		t.Fatalf("decode failed: %v", err)
+	}
+
+	machine := vm.NewFromProgram(loaded)
+	if err := machine.SetInput("x", vm.NewFloat(16)); err != nil {
+		t.Fatal(err)
+	}
+	if err := machine.Run(); err != nil {
+		t.Fatalf("run failed: %v", err)
+	}
+	got, err := machine.GetResult()
+	if err != nil || got.AsFloat() != 8 {
+		t.Fatalf("expected 8, got %s (%v)", got.String(), err)
+	}
+	if !slices.Equal(loaded.Lines, program.Lines) {
+		t.Fatalf("line map not preserved: %v, want %v", loaded.Lines, program.Lines)
+	}
+}
+
+func TestErrorPositions(t *testing.T) {
+	cases := []struct {
+		source       string
+		line, column int
+		msg          string
+	}{
+		{"let x = 1\nlet y = x + foo(2)", 2, 13, "unknown function: foo"},
+		{"let x = 1\n  x = y", 2, 7, "undefined variable: y"},
+		{"let x = (1 +\n", 2, 1, "Parse error"},
+		{"fn f() {\n    return 1\n}\nfn f() {\n    return 2\n}", 4, 1, "duplicate function"},
+	}
+	for _, tc := range cases {
+		_, err := CompileProgram(tc.source)
+		var located *Error
+		if !errors.As(err, &located) {
+			t.Errorf("%q: expected a located error, got %v", tc.source, err)
+			continue
+		}
+		if located.Line != tc.line || located.Column != tc.column || !strings.Contains(located.Msg, tc.msg) {
+			t.Errorf("%q: expected %d:%d %q, got %v", tc.source, tc.line, tc.column, tc.msg, err)
+		}
+	}
+}
+
+func TestRuntimeErrorTrace(t *testing.T) {
+	source := `fn inner(a) {
+    return a + true
+}
+fn outer(a) {
+    let b = inner(a)
+    return b
+}
+return outer(1)`
+	program, err := CompileProgram(source)
+	if err != nil {
+		t.Fatalf("compile failed: %v", err)
+	}
+
+	err = vm.NewFromProgram(program).Run()
+	var rt *vm.RuntimeError
+	if !errors.As(err, &rt) {
+		t.Fatalf("expected a RuntimeError, got %v", err)
+	}
+	if rt.Op != bytecode.OP_ADD || rt.Line != 2 || rt.Column != 14 {
+		t.Fatalf("expected OP_ADD at 2:14, got %s at %d:%d", rt.Op, rt.Line, rt.Column)
+	}
+
+	want := []struct {
+		function string
+		line     int
+	}{{"inner", 2}, {"outer", 5}, {"", 8}}
+	if len(rt.Trace) != len(want) {
+		t.Fatalf("expected %d frames, got %+v", len(want), rt.Trace)
+	}
+	for i, w := range want {
+		if f := rt.Trace[i]; f.Function != w.function || f.Line != w.line {
+			t.Errorf("frame %d: expected %q line %d, got %+v", i, w.function, w.line, f)
+		}
+	}
+	if !strings.Contains(err.Error(), "[in inner, called from line 5 in outer, called from line 8]") {
+		t.Errorf("unexpected message: %v", err)
+	}
+}
+
+func TestDebugger(t *testing.T) {
+	source := `fn square(v) {
+    let sq = v * v
+    return sq
+}
+let total = 0
+for i in 0..3 {
+    total = total + square(i)
+}
+return total`
+	program, err := CompileProgram(source)
+	if err != nil {
+		t.Fatalf("compile failed: %v", err)
+	}
+	d, err := vm.NewDebugger(program)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := d.BreakAtLine(3); err != nil {
+		t.Fatal(err)
+	}
+	if reason, err := d.Continue(); reason != vm.StopBreakpoint || err != nil {
+		t.Fatalf("expected breakpoint, got %s (%v)", reason, err)
+	}
+
+	frames := d.Frames()
+	if len(frames) != 2 || frames[0].Function != "square" || frames[0].Line != 3 || frames[1].Line != 7 {
+		t.Fatalf("unexpected frames: %+v", frames)
+	}
+	if sq, err := d.Lookup("sq"); err != nil || sq.AsFloat() != 0 {
+		t.Fatalf("expected sq = 0, got %v (%v)", sq, err)
+	}
+	outer, err := d.Locals(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, v := range outer {
+		names = append(names, v.Name)
+	}
+	if !slices.Equal(names, []string{"total", "i"}) {
+		t.Fatalf("unexpected caller locals: %v", names)
+	}
+
+	// second trip round the loop: i = 1
+	d.Continue()
+	if sq, _ := d.Lookup("sq"); sq.AsFloat() != 1 {
+		t.Fatalf("expected sq = 1, got %s", sq.String())
+	}
+
+	// step out lands back in the loop body, mid-line 7
+	if reason, err := d.StepOut(); reason != vm.StopStep || err != nil {
+		t.Fatalf("step out: %s (%v)", reason, err)
+	}
+	if loc := d.Location(); loc.Function != "" || loc.Line != 7 {
+		t.Fatalf("expected top level line 7, got %+v", loc)
+	}
+
+	// step over the next call without stopping inside it
+	d.ClearBreakpoint(d.Breakpoints()[0])
+	for d.Location().Line == 7 {
+		d.StepOver()
+	}
+	if loc := d.Location(); loc.Function != "" {
+		t.Fatalf("step over entered a function: %+v", loc)
+	}
+
+	if reason, err := d.Continue(); reason != vm.StopFinished || err != nil {
+		t.Fatalf("expected finish, got %s (%v)", reason, err)
+	}
+	if result, _ := d.VM().GetResult(); result.AsFloat() != 5 {
+		t.Fatalf("expected 0+1+4 = 5, got %s", result.String())
+	}
+	if _, err := d.StepInto(); err == nil {
+		t.Fatal("expected stepping a finished program to fail")
+	}
+
+	// from the top, step into enters square on line 2
+	d.Restart()
+	for d.Location().Function == "" {
+		if _, err := d.StepInto(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if loc := d.Location(); loc.Function != "square" || loc.Line != 2 {
+		t.Fatalf("expected square line 2, got %+v", loc)
+	}
+}
+
+func TestDebuggerStopsOnError(t *testing.T) {
+	program, err := CompileProgram("let a = 1\nlet b = a + true\nreturn b")
+	if err != nil {
+		t.Fatalf("compile failed: %v", err)
+	}
+	d, err := vm.NewDebugger(program)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	reason, err := d.Continue()
+	if reason != vm.StopError || err == nil || d.Err() == nil {
+		t.Fatalf("expected error stop, got %s (%v)", reason, err)
+	}
+	if loc := d.Location(); loc.Line != 2 {
+		t.Fatalf("expected line 2, got %+v", loc)
+	}
+	if a, err := d.Lookup("a"); err != nil || a.AsFloat() != 1 {
+		t.Fatalf("expected a = 1 after the error, got %v (%v)", a, err)
+	}
+}
@@ -0,0 +1,26 @@
+package compiler
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Error is a parse or compile error located in the source.
+type Error struct {
+	Pos
+	Msg string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("line %d, column %d: %s", e.Line, e.Column, e.Msg)
+}
+
+// locate attaches pos to err unless it is already located, so the innermost
+// node that failed is the one reported.
+func locate(err error, pos Pos) error {
+	var located *Error
+	if err == nil || pos.Line == 0 || errors.As(err, &located) {
+		return err
+	}
+	return &Error{Pos: pos, Msg: err.Error()}
+}
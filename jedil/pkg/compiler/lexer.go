@@ -7,10 +7,11 @@ import (
 
 // Lexer tokenizes JEDIL source code
 type Lexer struct {
-	source  string
-	start   int // Start of current token
-	current int // Current position
-	line    int // Current line number
+	source    string
+	start     int // Start of current token
+	current   int // Current position
+	line      int // Current line number
+	lineStart int // Offset where the current line begins
 }
 
 // NewLexer creates a new lexer for the given source code
@@ -57,6 +58,13 @@ func (l *Lexer) ScanToken() Token {
 		return l.makeToken(TOKEN_RBRACE)
 	case ',':
 		return l.makeToken(TOKEN_COMMA)
+	case ':':
+		return l.makeToken(TOKEN_COLON)
+	case '.':
+		if l.match('.') {
+			return l.makeToken(TOKEN_DOT_DOT)
+		}
+		return l.errorToken("Expected '..'")
 	case '+':
 		return l.makeToken(TOKEN_PLUS)
 	case '-':
@@ -74,7 +82,25 @@ func (l *Lexer) ScanToken() Token {
 		}
 		return l.makeToken(TOKEN_SLASH)
 	case '=':
+		if l.match('=') {
+			return l.makeToken(TOKEN_EQUAL_EQUAL)
+		}
 		return l.makeToken(TOKEN_EQUAL)
+	case '!':
+		if l.match('=') {
+			return l.makeToken(TOKEN_BANG_EQUAL)
+		}
+		return l.errorToken("Expected '=' after '!' (use 'not' for negation)")
+	case '<':
+		if l.match('=') {
+			return l.makeToken(TOKEN_LESS_EQUAL)
+		}
+		return l.makeToken(TOKEN_LESS)
+	case '>':
+		if l.match('=') {
+			return l.makeToken(TOKEN_GREATER_EQUAL)
+		}
+		return l.makeToken(TOKEN_GREATER)
 	}
 
 	return l.errorToken("Unexpected character")
@@ -128,6 +154,7 @@ func (l *Lexer) skipWhitespace() {
 		case '\n':
 			l.line++
 			l.advance()
+			l.lineStart = l.current
 		default:
 			return
 		}
@@ -181,6 +208,28 @@ func (l *Lexer) identifierType(text string) TokenType {
 		return TOKEN_RETURN
 	case "vec3":
 		return TOKEN_VEC3
+	case "if":
+		return TOKEN_IF
+	case "else":
+		return TOKEN_ELSE
+	case "and":
+		return TOKEN_AND
+	case "or":
+		return TOKEN_OR
+	case "not":
+		return TOKEN_NOT
+	case "true":
+		return TOKEN_TRUE
+	case "false":
+		return TOKEN_FALSE
+	case "while":
+		return TOKEN_WHILE
+	case "for":
+		return TOKEN_FOR
+	case "in":
+		return TOKEN_IN
+	case "input":
+		return TOKEN_INPUT
 	default:
 		return TOKEN_IDENTIFIER
 	}
@@ -191,6 +240,7 @@ func (l *Lexer) makeToken(tokenType TokenType) Token {
 		Type:   tokenType,
 		Lexeme: l.source[l.start:l.current],
 		Line:   l.line,
+		Column: l.column(),
 	}
 }
 
@@ -199,5 +249,11 @@ func (l *Lexer) errorToken(message string) Token {
 		Type:   TOKEN_ERROR,
 		Lexeme: message,
 		Line:   l.line,
+		Column: l.column(),
 	}
 }
+
+// column is the 1-based byte column where the current token starts
+func (l *Lexer) column() int {
+	return l.start - l.lineStart + 1
+}
@@ -42,15 +42,41 @@ func (p *Parser) Parse() (*Program, error) {
 // Statement parsing
 
 func (p *Parser) statement() (Stmt, error) {
+	pos := posOf(p.current)
+
+	stmt, err := p.parseStatement()
+	if err != nil {
+		return nil, err
+	}
+	stmt.(interface{ setPos(Pos) }).setPos(pos)
+	return stmt, nil
+}
+
+func (p *Parser) parseStatement() (Stmt, error) {
 	if p.match(TOKEN_LET) {
 		return p.varDecl()
 	}
 	if p.match(TOKEN_FN) {
 		return p.fnDecl()
 	}
+	if p.match(TOKEN_INPUT) {
+		return p.inputDecl()
+	}
 	if p.match(TOKEN_RETURN) {
 		return p.returnStmt()
 	}
+	if p.match(TOKEN_IF) {
+		return p.ifStmt()
+	}
+	if p.match(TOKEN_WHILE) {
+		return p.whileStmt()
+	}
+	if p.match(TOKEN_FOR) {
+		return p.forStmt()
+	}
+	if p.check(TOKEN_IDENTIFIER) && p.peek.Type == TOKEN_EQUAL {
+		return p.assignStmt()
+	}
 
 	return nil, p.error("Expected statement")
 }
@@ -62,6 +88,16 @@ func (p *Parser) varDecl() (Stmt, error) {
 	name := p.current.Lexeme
 	p.advance()
 
+	// let a, b = f(...)
+	names := []string{name}
+	for p.match(TOKEN_COMMA) {
+		if !p.check(TOKEN_IDENTIFIER) {
+			return nil, p.error("Expected variable name after ','")
+		}
+		names = append(names, p.current.Lexeme)
+		p.advance()
+	}
+
 	if !p.match(TOKEN_EQUAL) {
 		return nil, p.error("Expected '=' after variable name")
 	}
@@ -71,9 +107,46 @@ func (p *Parser) varDecl() (Stmt, error) {
 		return nil, err
 	}
 
+	if len(names) > 1 {
+		return &MultiVarDecl{Names: names, Value: value}, nil
+	}
 	return &VarDecl{Name: name, Value: value}, nil
 }
 
+func (p *Parser) inputDecl() (Stmt, error) {
+	if !p.check(TOKEN_IDENTIFIER) {
+		return nil, p.error("Expected input name")
+	}
+	name := p.current.Lexeme
+	p.advance()
+
+	if !p.match(TOKEN_COLON) {
+		return nil, p.error("Expected ':' after input name")
+	}
+
+	// vec3 is a keyword, float is a plain identifier
+	if !p.check(TOKEN_VEC3) && !(p.check(TOKEN_IDENTIFIER) && p.current.Lexeme == "float") {
+		return nil, p.error("Expected input type 'float' or 'vec3'")
+	}
+	typeName := p.current.Lexeme
+	p.advance()
+
+	return &InputDecl{Name: name, Type: typeName}, nil
+}
+
+func (p *Parser) assignStmt() (Stmt, error) {
+	name := p.current.Lexeme
+	p.advance() // name
+	p.advance() // =
+
+	value, err := p.expression()
+	if err != nil {
+		return nil, err
+	}
+
+	return &AssignStmt{Name: name, Value: value}, nil
+}
+
 func (p *Parser) fnDecl() (Stmt, error) {
 	if !p.check(TOKEN_IDENTIFIER) {
 		return nil, p.error("Expected function name")
@@ -127,17 +200,198 @@ func (p *Parser) fnDecl() (Stmt, error) {
 }
 
 func (p *Parser) returnStmt() (Stmt, error) {
-	value, err := p.expression()
+	var values []Expr
+	for {
+		value, err := p.expression()
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, value)
+
+		if !p.match(TOKEN_COMMA) {
+			break
+		}
+	}
+	return &ReturnStmt{Values: values}, nil
+}
+
+func (p *Parser) ifStmt() (Stmt, error) {
+	cond, err := p.expression()
 	if err != nil {
 		return nil, err
 	}
-	return &ReturnStmt{Value: value}, nil
+
+	then, err := p.block("if")
+	if err != nil {
+		return nil, err
+	}
+
+	stmt := &IfStmt{Cond: cond, Then: then}
+	if !p.match(TOKEN_ELSE) {
+		return stmt, nil
+	}
+
+	// else if: nest the chained if as the sole statement of the else branch
+	if p.match(TOKEN_IF) {
+		nested, err := p.ifStmt()
+		if err != nil {
+			return nil, err
+		}
+		stmt.Else = []Stmt{nested}
+		return stmt, nil
+	}
+
+	stmt.Else, err = p.block("else")
+	if err != nil {
+		return nil, err
+	}
+	return stmt, nil
+}
+
+func (p *Parser) whileStmt() (Stmt, error) {
+	cond, err := p.expression()
+	if err != nil {
+		return nil, err
+	}
+
+	body, err := p.block("while")
+	if err != nil {
+		return nil, err
+	}
+
+	return &WhileStmt{Cond: cond, Body: body}, nil
+}
+
+func (p *Parser) forStmt() (Stmt, error) {
+	if !p.check(TOKEN_IDENTIFIER) {
+		return nil, p.error("Expected loop variable name after 'for'")
+	}
+	name := p.current.Lexeme
+	p.advance()
+
+	if !p.match(TOKEN_IN) {
+		return nil, p.error("Expected 'in' after loop variable")
+	}
+
+	start, err := p.expression()
+	if err != nil {
+		return nil, err
+	}
+
+	if !p.match(TOKEN_DOT_DOT) {
+		return nil, p.error("Expected '..' in for range")
+	}
+
+	end, err := p.expression()
+	if err != nil {
+		return nil, err
+	}
+
+	body, err := p.block("for")
+	if err != nil {
+		return nil, err
+	}
+
+	return &ForStmt{Var: name, Start: start, End: end, Body: body}, nil
+}
+
+// block parses { stmt* }
+func (p *Parser) block(context string) ([]Stmt, error) {
+	if !p.match(TOKEN_LBRACE) {
+		return nil, p.error(fmt.Sprintf("Expected '{' after %s", context))
+	}
+
+	var body []Stmt
+	for !p.check(TOKEN_RBRACE) && !p.check(TOKEN_EOF) {
+		stmt, err := p.statement()
+		if err != nil {
+			return nil, err
+		}
+		body = append(body, stmt)
+	}
+
+	if !p.match(TOKEN_RBRACE) {
+		return nil, p.error(fmt.Sprintf("Expected '}' to close %s block", context))
+	}
+	return body, nil
 }
 
 // Expression parsing (precedence climbing)
 
 func (p *Parser) expression() (Expr, error) {
-	return p.addition()
+	return p.or()
+}
+
+func (p *Parser) or() (Expr, error) {
+	expr, err := p.and()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.match(TOKEN_OR) {
+		pos := posOf(p.previous())
+		right, err := p.and()
+		if err != nil {
+			return nil, err
+		}
+		expr = &LogicalOp{Pos: pos, Left: expr, Op: TOKEN_OR, Right: right}
+	}
+
+	return expr, nil
+}
+
+func (p *Parser) and() (Expr, error) {
+	expr, err := p.equality()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.match(TOKEN_AND) {
+		pos := posOf(p.previous())
+		right, err := p.equality()
+		if err != nil {
+			return nil, err
+		}
+		expr = &LogicalOp{Pos: pos, Left: expr, Op: TOKEN_AND, Right: right}
+	}
+
+	return expr, nil
+}
+
+func (p *Parser) equality() (Expr, error) {
+	expr, err := p.comparison()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.match(TOKEN_EQUAL_EQUAL, TOKEN_BANG_EQUAL) {
+		op := p.previous()
+		right, err := p.comparison()
+		if err != nil {
+			return nil, err
+		}
+		expr = &BinaryOp{Pos: posOf(op), Left: expr, Op: op.Type, Right: right}
+	}
+
+	return expr, nil
+}
+
+func (p *Parser) comparison() (Expr, error) {
+	expr, err := p.addition()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.match(TOKEN_LESS, TOKEN_LESS_EQUAL, TOKEN_GREATER, TOKEN_GREATER_EQUAL) {
+		op := p.previous()
+		right, err := p.addition()
+		if err != nil {
+			return nil, err
+		}
+		expr = &BinaryOp{Pos: posOf(op), Left: expr, Op: op.Type, Right: right}
+	}
+
+	return expr, nil
 }
 
 func (p *Parser) addition() (Expr, error) {
@@ -147,12 +401,12 @@ func (p *Parser) addition() (Expr, error) {
 	}
 
 	for p.match(TOKEN_PLUS, TOKEN_MINUS) {
-		op := p.previous().Type
+		op := p.previous()
 		right, err := p.multiplication()
 		if err != nil {
 			return nil, err
 		}
-		expr = &BinaryOp{Left: expr, Op: op, Right: right}
+		expr = &BinaryOp{Pos: posOf(op), Left: expr, Op: op.Type, Right: right}
 	}
 
 	return expr, nil
@@ -165,12 +419,12 @@ func (p *Parser) multiplication() (Expr, error) {
 	}
 
 	for p.match(TOKEN_STAR, TOKEN_SLASH) {
-		op := p.previous().Type
+		op := p.previous()
 		right, err := p.unary()
 		if err != nil {
 			return nil, err
 		}
-		expr = &BinaryOp{Left: expr, Op: op, Right: right}
+		expr = &BinaryOp{Pos: posOf(op), Left: expr, Op: op.Type, Right: right}
 	}
 
 	return expr, nil
@@ -178,11 +432,21 @@ func (p *Parser) multiplication() (Expr, error) {
 
 func (p *Parser) unary() (Expr, error) {
 	if p.match(TOKEN_MINUS) {
+		pos := posOf(p.previous())
 		expr, err := p.unary()
 		if err != nil {
 			return nil, err
 		}
-		return &UnaryOp{Op: TOKEN_MINUS, Expr: expr}, nil
+		return &UnaryOp{Pos: pos, Op: TOKEN_MINUS, Expr: expr}, nil
+	}
+
+	if p.match(TOKEN_NOT) {
+		pos := posOf(p.previous())
+		expr, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		return &UnaryOp{Pos: pos, Op: TOKEN_NOT, Expr: expr}, nil
 	}
 
 	return p.call()
@@ -205,7 +469,7 @@ func (p *Parser) call() (Expr, error) {
 			if !p.match(TOKEN_RPAREN) {
 				return nil, p.error("Expected ')' after arguments")
 			}
-			return &CallExpr{Callee: ident.Name, Args: args}, nil
+			return &CallExpr{Pos: ident.Pos, Callee: ident.Name, Args: args}, nil
 		}
 		return nil, p.error("Only identifiers can be called")
 	}
@@ -237,14 +501,27 @@ func (p *Parser) arguments() ([]Expr, error) {
 
 func (p *Parser) primary() (Expr, error) {
 	if p.match(TOKEN_NUMBER) {
-		return &NumberLiteral{Value: p.previous().Literal}, nil
+		return &NumberLiteral{Pos: posOf(p.previous()), Value: p.previous().Literal}, nil
+	}
+
+	if p.match(TOKEN_TRUE) {
+		return &BoolLiteral{Pos: posOf(p.previous()), Value: true}, nil
+	}
+
+	if p.match(TOKEN_FALSE) {
+		return &BoolLiteral{Pos: posOf(p.previous()), Value: false}, nil
 	}
 
 	if p.match(TOKEN_IDENTIFIER) {
-		return &Identifier{Name: p.previous().Lexeme}, nil
+		return &Identifier{Pos: posOf(p.previous()), Name: p.previous().Lexeme}, nil
+	}
+
+	if p.match(TOKEN_IF) {
+		return p.ifExpr()
 	}
 
 	if p.match(TOKEN_VEC3) {
+		pos := posOf(p.previous())
 		if !p.match(TOKEN_LPAREN) {
 			return nil, p.error("Expected '(' after 'vec3'")
 		}
@@ -276,7 +553,7 @@ func (p *Parser) primary() (Expr, error) {
 			return nil, p.error("Expected ')' after z component")
 		}
 
-		return &Vec3Literal{X: x, Y: y, Z: z}, nil
+		return &Vec3Literal{Pos: pos, X: x, Y: y, Z: z}, nil
 	}
 
 	if p.match(TOKEN_LPAREN) {
@@ -293,6 +570,51 @@ func (p *Parser) primary() (Expr, error) {
 	return nil, p.error(fmt.Sprintf("Unexpected token: %s", p.current.Type))
 }
 
+// ifExpr parses if cond { expr } else { expr }; the else branch is required
+// so the expression always has a value.
+func (p *Parser) ifExpr() (Expr, error) {
+	pos := posOf(p.previous())
+	cond, err := p.expression()
+	if err != nil {
+		return nil, err
+	}
+
+	then, err := p.branchExpr("if")
+	if err != nil {
+		return nil, err
+	}
+
+	if !p.match(TOKEN_ELSE) {
+		return nil, p.error("Expected 'else' in if expression")
+	}
+
+	var els Expr
+	if p.match(TOKEN_IF) {
+		els, err = p.ifExpr()
+	} else {
+		els, err = p.branchExpr("else")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &IfExpr{Pos: pos, Cond: cond, Then: then, Else: els}, nil
+}
+
+func (p *Parser) branchExpr(context string) (Expr, error) {
+	if !p.match(TOKEN_LBRACE) {
+		return nil, p.error(fmt.Sprintf("Expected '{' after %s", context))
+	}
+	expr, err := p.expression()
+	if err != nil {
+		return nil, err
+	}
+	if !p.match(TOKEN_RBRACE) {
+		return nil, p.error(fmt.Sprintf("Expected '}' to close %s branch", context))
+	}
+	return expr, nil
+}
+
 // Helper functions
 
 func (p *Parser) match(types ...TokenType) bool {
@@ -320,6 +642,12 @@ func (p *Parser) previous() Token {
 }
 
 func (p *Parser) error(message string) error {
-	return fmt.Errorf("Parse error at line %d: %s (token: %s '%s')",
-		p.current.Line, message, p.current.Type, p.current.Lexeme)
+	return &Error{
+		Pos: posOf(p.current),
+		Msg: fmt.Sprintf("Parse error: %s (token: %s '%s')", message, p.current.Type, p.current.Lexeme),
+	}
+}
+
+func posOf(t Token) Pos {
+	return Pos{Line: t.Line, Column: t.Column}
 }
@@ -17,6 +17,17 @@ const (
 	TOKEN_FN     // fn
 	TOKEN_RETURN // return
 	TOKEN_VEC3   // vec3
+	TOKEN_IF     // if
+	TOKEN_ELSE   // else
+	TOKEN_AND    // and
+	TOKEN_OR     // or
+	TOKEN_NOT    // not
+	TOKEN_TRUE   // true
+	TOKEN_FALSE  // false
+	TOKEN_WHILE  // while
+	TOKEN_FOR    // for
+	TOKEN_IN     // in
+	TOKEN_INPUT  // input
 
 	// Operators
 	TOKEN_PLUS  // +
@@ -25,12 +36,22 @@ const (
 	TOKEN_SLASH // /
 	TOKEN_EQUAL // =
 
+	// Comparison operators
+	TOKEN_EQUAL_EQUAL   // ==
+	TOKEN_BANG_EQUAL    // !=
+	TOKEN_LESS          // <
+	TOKEN_LESS_EQUAL    // <=
+	TOKEN_GREATER       // >
+	TOKEN_GREATER_EQUAL // >=
+
 	// Delimiters
-	TOKEN_LPAREN // (
-	TOKEN_RPAREN // )
-	TOKEN_LBRACE // {
-	TOKEN_RBRACE // }
-	TOKEN_COMMA  // ,
+	TOKEN_LPAREN  // (
+	TOKEN_RPAREN  // )
+	TOKEN_LBRACE  // {
+	TOKEN_RBRACE  // }
+	TOKEN_COMMA   // ,
+	TOKEN_DOT_DOT // ..
+	TOKEN_COLON   // :
 )
 
 // Token represents a lexical token
@@ -39,6 +60,7 @@ type Token struct {
 	Lexeme  string  // Original text
 	Literal float64 // For numbers
 	Line    int     // Line number (for error reporting)
+	Column  int     // Column of the token's first byte, from 1
 }
 
 func (t TokenType) String() string {
@@ -59,6 +81,28 @@ func (t TokenType) String() string {
 		return "RETURN"
 	case TOKEN_VEC3:
 		return "VEC3"
+	case TOKEN_IF:
+		return "IF"
+	case TOKEN_ELSE:
+		return "ELSE"
+	case TOKEN_AND:
+		return "AND"
+	case TOKEN_OR:
+		return "OR"
+	case TOKEN_NOT:
+		return "NOT"
+	case TOKEN_TRUE:
+		return "TRUE"
+	case TOKEN_FALSE:
+		return "FALSE"
+	case TOKEN_WHILE:
+		return "WHILE"
+	case TOKEN_FOR:
+		return "FOR"
+	case TOKEN_IN:
+		return "IN"
+	case TOKEN_INPUT:
+		return "INPUT"
 	case TOKEN_PLUS:
 		return "PLUS"
 	case TOKEN_MINUS:
@@ -69,6 +113,18 @@ func (t TokenType) String() string {
 		return "SLASH"
 	case TOKEN_EQUAL:
 		return "EQUAL"
+	case TOKEN_EQUAL_EQUAL:
+		return "EQUAL_EQUAL"
+	case TOKEN_BANG_EQUAL:
+		return "BANG_EQUAL"
+	case TOKEN_LESS:
+		return "LESS"
+	case TOKEN_LESS_EQUAL:
+		return "LESS_EQUAL"
+	case TOKEN_GREATER:
+		return "GREATER"
+	case TOKEN_GREATER_EQUAL:
+		return "GREATER_EQUAL"
 	case TOKEN_LPAREN:
 		return "LPAREN"
 	case TOKEN_RPAREN:
@@ -79,6 +135,10 @@ func (t TokenType) String() string {
 		return "RBRACE"
 	case TOKEN_COMMA:
 		return "COMMA"
+	case TOKEN_DOT_DOT:
+		return "DOT_DOT"
+	case TOKEN_COLON:
+		return "COLON"
 	default:
 		return "UNKNOWN"
 	}
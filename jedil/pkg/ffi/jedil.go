@@ -4,60 +4,307 @@ package main
 #include <stdlib.h>
 #include <stdint.h>
 #include <string.h>
+
+// Must match JedilValue and JedilNativeFn in jedil.h
+typedef struct {
+    int type;
+    double x;
+    double y;
+    double z;
+} JedilValue;
+
+typedef int (*JedilNativeFn)(const JedilValue* args, size_t nargs, JedilValue* result, void* user_data);
+
+// Must match JedilReloadFn in jedil.h
+typedef void (*JedilReloadFn)(void* program, int status, const char* message, void* user_data);
+
+// Must match JedilErrorInfo and JedilStackFrame in jedil.h
+typedef struct {
+    int kind;
+    int line;
+    int column;
+    int opcode;
+    char opcode_name[24];
+    int ip;
+    int frame_count;
+} JedilErrorInfo;
+
+typedef struct {
+    char function[64];
+    int ip;
+    int line;
+    int column;
+} JedilStackFrame;
+
+// Per-thread last error: the message jedil_get_last_error hands out and a
+// cgo.Handle to the Go error behind it, for jedil_get_error_info
+static _Thread_local char* jedil_error_message;
+static _Thread_local uintptr_t jedil_error_value;
+
+static inline const char* jedil_last_message(void) {
+    return jedil_error_message ? jedil_error_message : "";
+}
+
+static inline uintptr_t jedil_last_value(void) {
+    return jedil_error_value;
+}
+
+static inline void jedil_store_error(char* message, uintptr_t value) {
+    free(jedil_error_message);
+    jedil_error_message = message;
+    jedil_error_value = value;
+}
+
+// Go can't call C function pointers directly
+static inline int jedil_invoke_native(JedilNativeFn fn, const JedilValue* args, size_t nargs, JedilValue* result, void* user_data) {
+    return fn(args, nargs, result, user_data);
+}
+
+static inline void jedil_invoke_reload(JedilReloadFn fn, void* program, int status, const char* message, void* user_data) {
+    fn(program, status, message, user_data);
+}
 */
 import "C"
 import (
+	"bytes"
 	"encoding/binary"
+	"errors"
 	"fmt"
 	"jedil/pkg/bytecode"
 	"jedil/pkg/compiler"
+	"jedil/pkg/hotreload"
 	"jedil/pkg/types"
 	"jedil/pkg/vm"
+	"math"
 	"os"
+	"runtime"
+	"runtime/cgo"
+	"sync"
+	"sync/atomic"
 	"unsafe"
 )
 
 // ============================================================================
-// VM Registry (to avoid passing Go pointers to C)
+// Program Registry (to avoid passing Go pointers to C)
 // ============================================================================
 
-var vmRegistry = make(map[int]*vm.VM)
-var nextVMHandle = 1
+// program is what a handle refers to. Its current version is a compiled
+// image that is never modified, with the inputs bound to it by jedil_set_*.
+// Reloading a watched file swaps in a new version; calls already running
+// finish on the one they started with. Each execution borrows its own VM
+// from the version's pool, so any number of threads can run a program at
+// once.
+type program struct {
+	current atomic.Pointer[version]
+
+	mu     sync.Mutex // guards budget, the current version's inputs and swaps
+	budget int
+
+	watcher *hotreload.Watcher // set for handles from jedil_watch_file
+}
+
+type version struct {
+	image    *bytecode.Program
+	inputs   []vm.Value // bound input values, in declaration order
+	contexts sync.Pool  // idle *vm.VM for image
+}
+
+func newProgram(image *bytecode.Program) *program {
+	p := &program{budget: vm.DEFAULT_INSTRUCTION_BUDGET}
+	p.current.Store(newVersion(image, nil))
+	return p
+}
 
-func registerVM(v *vm.VM) unsafe.Pointer {
-	handle := nextVMHandle
-	nextVMHandle++
-	vmRegistry[handle] = v
-	return unsafe.Pointer(uintptr(handle))
+// newVersion wraps image for execution. Inputs start at the zero value of
+// their type, or keep the value bound in previous to an input of the same
+// name and type.
+func newVersion(image *bytecode.Program, previous *version) *version {
+	ver := &version{image: image, inputs: make([]vm.Value, len(image.Inputs))}
+	ver.contexts.New = func() any { return vm.NewFromProgram(image) }
+
+	for i, in := range image.Inputs {
+		ver.inputs[i] = vm.NewFloat(0)
+		if in.Type == bytecode.INPUT_VEC3 {
+			ver.inputs[i] = vm.NewVec3(types.Vec3{})
+		}
+		if previous == nil {
+			continue
+		}
+		if j := inputIndex(previous.image, in.Name); j >= 0 && previous.image.Inputs[j].Type == in.Type {
+			ver.inputs[i] = previous.inputs[j]
+		}
+	}
+	return ver
 }
 
-func getVM(handle unsafe.Pointer) *vm.VM {
-	h := int(uintptr(handle))
-	return vmRegistry[h]
+// image returns the current version's program
+func (p *program) image() *bytecode.Program {
+	return p.current.Load().image
 }
 
-func unregisterVM(handle unsafe.Pointer) {
-	h := int(uintptr(handle))
-	delete(vmRegistry, h)
+// swap makes image the current version
+func (p *program) swap(image *bytecode.Program) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.current.Store(newVersion(image, p.current.Load()))
+}
+
+// acquire returns the current version and a VM for one execution of it,
+// loaded with the bound inputs and budget. Hand the VM back with release.
+func (p *program) acquire() (*version, *vm.VM) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	ver := p.current.Load()
+	v := ver.contexts.Get().(*vm.VM)
+	for i, val := range ver.inputs {
+		v.SetInputAt(i, val) // checked when bound
+	}
+	v.SetInstructionBudget(p.budget)
+	return ver, v
+}
+
+func (ver *version) release(v *vm.VM) {
+	ver.contexts.Put(v)
+}
+
+var (
+	registryMu sync.RWMutex
+	registry           = make(map[uintptr]*program)
+	nextHandle uintptr = 1
+)
+
+func registerProgram(image *bytecode.Program) unsafe.Pointer {
+	return register(newProgram(image))
+}
+
+func register(p *program) unsafe.Pointer {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	handle := nextHandle
+	nextHandle++
+	registry[handle] = p
+	return unsafe.Pointer(handle)
+}
+
+func getProgram(handle unsafe.Pointer) *program {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	return registry[uintptr(handle)]
+}
+
+func unregisterProgram(handle unsafe.Pointer) *program {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	p := registry[uintptr(handle)]
+	delete(registry, uintptr(handle))
+	return p
 }
 
 // ============================================================================
 // Error Handling
 // ============================================================================
 
-var lastError string
+// Error kinds reported by jedil_get_error_info (JedilErrorKind)
+const (
+	errorKindNone    = 0
+	errorKindOther   = 1
+	errorKindCompile = 2
+	errorKindRuntime = 3
+)
+
+// The last error is kept per C thread, so concurrent callers each see the
+// outcome of their own calls. A cgo call runs on the calling thread, which
+// makes C thread-local storage the place to keep it.
 
 //export jedil_get_last_error
 func jedil_get_last_error() *C.char {
-	return C.CString(lastError)
+	return C.jedil_last_message()
+}
+
+// C thread-local storage has no destructor we can hook from Go, so a thread
+// that exits holding an error leaks it unless the host clears it first.
+
+//export jedil_clear_error
+func jedil_clear_error() {
+	setError(nil)
 }
 
 func setError(err error) {
-	if err != nil {
-		lastError = err.Error()
-	} else {
-		lastError = ""
+	if old := C.jedil_last_value(); old != 0 {
+		cgo.Handle(old).Delete()
+	}
+	if err == nil {
+		C.jedil_store_error(nil, 0)
+		return
 	}
+	C.jedil_store_error(C.CString(err.Error()), C.uintptr_t(cgo.NewHandle(err)))
+}
+
+// lastError returns the error from this thread's last call, if it failed
+func lastError() error {
+	h := C.jedil_last_value()
+	if h == 0 {
+		return nil
+	}
+	return cgo.Handle(h).Value().(error)
+}
+
+//export jedil_get_error_info
+func jedil_get_error_info(info *C.JedilErrorInfo) C.int {
+	if info == nil {
+		return 1 // JEDIL_ERROR_NULL_POINTER
+	}
+
+	*info = C.JedilErrorInfo{kind: errorKindNone, opcode: -1, ip: -1}
+	lastErr := lastError()
+	var compileErr *compiler.Error
+	var runtimeErr *vm.RuntimeError
+	switch {
+	case lastErr == nil:
+	case errors.As(lastErr, &runtimeErr):
+		info.kind = errorKindRuntime
+		info.line = C.int(runtimeErr.Line)
+		info.column = C.int(runtimeErr.Column)
+		info.opcode = C.int(runtimeErr.Op)
+		copyCString(info.opcode_name[:], runtimeErr.Op.String())
+		info.ip = C.int(runtimeErr.IP)
+		info.frame_count = C.int(len(runtimeErr.Trace))
+	case errors.As(lastErr, &compileErr):
+		info.kind = errorKindCompile
+		info.line = C.int(compileErr.Line)
+		info.column = C.int(compileErr.Column)
+	default:
+		info.kind = errorKindOther
+	}
+	return 0
+}
+
+//export jedil_get_error_frame
+func jedil_get_error_frame(index C.size_t, frame *C.JedilStackFrame) C.int {
+	if frame == nil {
+		return 1 // JEDIL_ERROR_NULL_POINTER
+	}
+
+	var runtimeErr *vm.RuntimeError
+	if !errors.As(lastError(), &runtimeErr) || int(index) >= len(runtimeErr.Trace) {
+		return 7 // JEDIL_ERROR_INVALID_INPUT
+	}
+
+	f := runtimeErr.Trace[index]
+	*frame = C.JedilStackFrame{ip: C.int(f.IP), line: C.int(f.Line), column: C.int(f.Column)}
+	copyCString(frame.function[:], f.Function)
+	return 0
+}
+
+// copyCString copies s into a fixed-size C char array, truncating it to fit
+// and always NUL-terminating
+func copyCString(dst []C.char, s string) {
+	n := min(len(s), len(dst)-1)
+	for i := 0; i < n; i++ {
+		dst[i] = C.char(s[i])
+	}
+	dst[n] = 0
 }
 
 // ============================================================================
@@ -66,19 +313,34 @@ func setError(err error) {
 
 //export jedil_create_program
 func jedil_create_program(bytecode_data *C.uint8_t, length C.size_t) unsafe.Pointer {
+	if bytecode_data == nil {
+		setError(fmt.Errorf("bytecode pointer is NULL"))
+		return nil
+	}
+
 	// Convert C bytecode to Go bytecode
 	cBytes := C.GoBytes(unsafe.Pointer(bytecode_data), C.int(length))
 
+	// .jbc images carry their own metadata and are fully validated
+	if bytes.HasPrefix(cBytes, bytecode.Magic[:]) {
+		return loadImage(cBytes)
+	}
+
 	// Parse bytecode (simple format: each instruction is 9 bytes: 1 opcode + 8 arg)
+	if len(cBytes)%9 != 0 {
+		setError(fmt.Errorf("raw bytecode is %d bytes, not a whole number of 9-byte instructions", len(cBytes)))
+		return nil
+	}
 	var instructions []bytecode.Instruction
 	for i := 0; i < len(cBytes); i += 9 {
-		if i+9 > len(cBytes) {
-			break
-		}
 		op := bytecode.OpCode(cBytes[i])
+		if !op.Valid() {
+			setError(fmt.Errorf("instruction %d: unknown opcode %d", i/9, op))
+			return nil
+		}
 		// Decode float64 argument (little-endian)
 		arg := binary.LittleEndian.Uint64(cBytes[i+1 : i+9])
-		argFloat := *(*float64)(unsafe.Pointer(&arg))
+		argFloat := math.Float64frombits(arg)
 
 		instructions = append(instructions, bytecode.Instruction{
 			Op:   op,
@@ -86,11 +348,42 @@ func jedil_create_program(bytecode_data *C.uint8_t, length C.size_t) unsafe.Poin
 		})
 	}
 
-	// Create VM
-	v := vm.New(instructions)
+	// Raw bytecode is untrusted: check it before it can run
+	if err := vm.Verify(&bytecode.Program{Code: instructions}); err != nil {
+		setError(err)
+		return nil
+	}
+
+	setError(nil)
+	return registerProgram(&bytecode.Program{Code: instructions})
+}
+
+//export jedil_load_file
+func jedil_load_file(filepath *C.char) unsafe.Pointer {
+	path := C.GoString(filepath)
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		setError(fmt.Errorf("failed to read file %s: %v", path, err))
+		return nil
+	}
+	return loadImage(data)
+}
+
+// loadImage decodes a .jbc image, relinks its natives and registers it
+func loadImage(data []byte) unsafe.Pointer {
+	program, err := bytecode.Decode(data, vm.ResolveNative)
+	if err != nil {
+		setError(err)
+		return nil
+	}
+	if err := vm.Verify(program); err != nil {
+		setError(err)
+		return nil
+	}
 
-	// Register and return handle
-	return registerVM(v)
+	setError(nil)
+	return registerProgram(program)
 }
 
 //export jedil_compile_file
@@ -107,16 +400,14 @@ func jedil_compile_file(filepath *C.char) unsafe.Pointer {
 
 	// Compile the source
 	source := string(sourceBytes)
-	instructions, err := compiler.CompileSource(source)
+	program, err := compiler.CompileProgram(source)
 	if err != nil {
-		setError(fmt.Errorf("compilation failed: %v", err))
+		setError(fmt.Errorf("compilation failed: %w", err))
 		return nil
 	}
 
-	// Create VM
-	v := vm.New(instructions)
 	setError(nil)
-	return registerVM(v)
+	return registerProgram(program)
 }
 
 //export jedil_compile_source
@@ -125,21 +416,73 @@ func jedil_compile_source(sourceStr *C.char) unsafe.Pointer {
 	source := C.GoString(sourceStr)
 
 	// Compile the source
-	instructions, err := compiler.CompileSource(source)
+	program, err := compiler.CompileProgram(source)
 	if err != nil {
-		setError(fmt.Errorf("compilation failed: %v", err))
+		setError(fmt.Errorf("compilation failed: %w", err))
 		return nil
 	}
 
-	// Create VM
-	v := vm.New(instructions)
 	setError(nil)
-	return registerVM(v)
+	return registerProgram(program)
 }
 
 //export jedil_free_program
 func jedil_free_program(program unsafe.Pointer) {
-	unregisterVM(program)
+	if p := unregisterProgram(program); p != nil && p.watcher != nil {
+		p.watcher.Close()
+	}
+}
+
+// ============================================================================
+// Hot Reload
+// ============================================================================
+
+//export jedil_watch_file
+func jedil_watch_file(filepath *C.char, callback C.JedilReloadFn, user_data unsafe.Pointer) unsafe.Pointer {
+	path := C.GoString(filepath)
+
+	// reloads wait until the handle they report on exists
+	var handle unsafe.Pointer
+	ready := make(chan struct{})
+	w, err := hotreload.Watch(path, func(image *bytecode.Program, err error) {
+		<-ready
+		p := getProgram(handle)
+		if p == nil {
+			return // being freed
+		}
+		if err == nil {
+			p.swap(image)
+		}
+		if callback != nil {
+			notifyReload(callback, handle, err, user_data)
+		}
+	})
+	if err != nil {
+		setError(err)
+		return nil
+	}
+
+	p := newProgram(w.Program())
+	p.watcher = w
+	handle = register(p)
+	close(ready)
+
+	setError(nil)
+	return handle
+}
+
+// notifyReload runs the host's callback on the watcher's thread, with the
+// outcome as that thread's last error so the callback can inspect it.
+func notifyReload(callback C.JedilReloadFn, handle unsafe.Pointer, err error, user_data unsafe.Pointer) {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+
+	setError(err)
+	status := C.int(0) // JEDIL_OK
+	if err != nil {
+		status = 10 // JEDIL_ERROR_RELOAD_FAILED
+	}
+	C.jedil_invoke_reload(callback, handle, status, C.jedil_last_message(), user_data)
 }
 
 // ============================================================================
@@ -148,13 +491,23 @@ func jedil_free_program(program unsafe.Pointer) {
 
 //export jedil_execute_vec3
 func jedil_execute_vec3(program unsafe.Pointer, input_data unsafe.Pointer, input_len C.size_t, result_x *C.double, result_y *C.double, result_z *C.double) C.int {
-	v := getVM(program)
+	p := getProgram(program)
+	if p == nil {
+		setError(fmt.Errorf("invalid program handle"))
+		return 1 // JEDIL_ERROR_NULL_POINTER
+	}
+	ver, v := p.acquire()
+	defer ver.release(v)
+
+	if code := bindInputData(v, input_data, input_len); code != 0 {
+		return code
+	}
 
 	// Execute
 	err := v.Run()
 	if err != nil {
 		setError(err)
-		return 3 // JEDIL_ERROR_EXECUTION_FAILED
+		return runErrorCode(err)
 	}
 
 	// Get result
@@ -180,12 +533,22 @@ func jedil_execute_vec3(program unsafe.Pointer, input_data unsafe.Pointer, input
 
 //export jedil_execute_float
 func jedil_execute_float(program unsafe.Pointer, input_data unsafe.Pointer, input_len C.size_t, result *C.double) C.int {
-	v := getVM(program)
+	p := getProgram(program)
+	if p == nil {
+		setError(fmt.Errorf("invalid program handle"))
+		return 1 // JEDIL_ERROR_NULL_POINTER
+	}
+	ver, v := p.acquire()
+	defer ver.release(v)
+
+	if code := bindInputData(v, input_data, input_len); code != 0 {
+		return code
+	}
 
 	err := v.Run()
 	if err != nil {
 		setError(err)
-		return 3
+		return runErrorCode(err)
 	}
 
 	val, err := v.GetResult()
@@ -204,6 +567,305 @@ func jedil_execute_float(program unsafe.Pointer, input_data unsafe.Pointer, inpu
 	return 0
 }
 
+// bindInputData binds the caller's input buffer, if there is one, to this
+// execution only. The buffer holds doubles packed in declaration order: one
+// per float input, three (x, y, z) per vec3 input.
+func bindInputData(v *vm.VM, input_data unsafe.Pointer, input_len C.size_t) C.int {
+	if input_data == nil {
+		return 0
+	}
+
+	want := 0
+	for _, in := range v.Inputs() {
+		if in.Type == bytecode.INPUT_VEC3 {
+			want += 3
+		} else {
+			want++
+		}
+	}
+	if int(input_len) != want*8 {
+		setError(fmt.Errorf("input buffer is %d bytes, program inputs need %d (%d doubles)", input_len, want*8, want))
+		return 7 // JEDIL_ERROR_INVALID_INPUT
+	}
+
+	data := unsafe.Slice((*float64)(input_data), want)
+	for i, in := range v.Inputs() {
+		var val vm.Value
+		if in.Type == bytecode.INPUT_VEC3 {
+			val = vm.NewVec3(types.NewVec3(data[0], data[1], data[2]))
+			data = data[3:]
+		} else {
+			val = vm.NewFloat(data[0])
+			data = data[1:]
+		}
+		if err := v.SetInputAt(i, val); err != nil {
+			setError(err)
+			return 7
+		}
+	}
+	return 0
+}
+
+// ============================================================================
+// Inputs
+// ============================================================================
+
+//export jedil_input_count
+func jedil_input_count(program unsafe.Pointer) C.int {
+	p := getProgram(program)
+	if p == nil {
+		return -1
+	}
+	return C.int(len(p.image().Inputs))
+}
+
+//export jedil_input_index
+func jedil_input_index(program unsafe.Pointer, name *C.char) C.int {
+	p := getProgram(program)
+	if p == nil {
+		return -1
+	}
+	return C.int(inputIndex(p.image(), C.GoString(name)))
+}
+
+func inputIndex(image *bytecode.Program, name string) int {
+	for i, in := range image.Inputs {
+		if in.Name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+//export jedil_set_float
+func jedil_set_float(program unsafe.Pointer, name *C.char, value C.double) C.int {
+	return setInput(program, C.GoString(name), -1, vm.NewFloat(float64(value)))
+}
+
+//export jedil_set_vec3
+func jedil_set_vec3(program unsafe.Pointer, name *C.char, x, y, z C.double) C.int {
+	return setInput(program, C.GoString(name), -1, vm.NewVec3(types.NewVec3(float64(x), float64(y), float64(z))))
+}
+
+//export jedil_set_float_at
+func jedil_set_float_at(program unsafe.Pointer, index C.int, value C.double) C.int {
+	return setInput(program, "", int(index), vm.NewFloat(float64(value)))
+}
+
+//export jedil_set_vec3_at
+func jedil_set_vec3_at(program unsafe.Pointer, index C.int, x, y, z C.double) C.int {
+	return setInput(program, "", int(index), vm.NewVec3(types.NewVec3(float64(x), float64(y), float64(z))))
+}
+
+// setInput binds by name, or by index when index >= 0, for every later
+// execution of the program
+func setInput(program unsafe.Pointer, name string, index int, val vm.Value) C.int {
+	p := getProgram(program)
+	if p == nil {
+		setError(fmt.Errorf("invalid program handle"))
+		return 1 // JEDIL_ERROR_NULL_POINTER
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	ver := p.current.Load()
+
+	if index < 0 {
+		index = inputIndex(ver.image, name)
+		if index < 0 {
+			setError(fmt.Errorf("unknown input: %s", name))
+			return 7 // JEDIL_ERROR_INVALID_INPUT
+		}
+	}
+	if index >= len(ver.image.Inputs) {
+		setError(fmt.Errorf("input index %d out of range (program has %d inputs)", index, len(ver.image.Inputs)))
+		return 7
+	}
+
+	in := ver.image.Inputs[index]
+	if (in.Type == bytecode.INPUT_VEC3) != val.IsVec3() {
+		setError(fmt.Errorf("input %s expects %s, got %s", in.Name, in.Type, val.String()))
+		return 5 // JEDIL_ERROR_TYPE_MISMATCH
+	}
+	ver.inputs[index] = val
+
+	setError(nil)
+	return 0
+}
+
+// ============================================================================
+// Function Calls
+// ============================================================================
+
+// JedilValue.type tags, matching JedilValueType in jedil.h
+const (
+	valueFloat = 0
+	valueVec3  = 1
+	valueBool  = 2
+)
+
+//export jedil_call
+func jedil_call(program unsafe.Pointer, name *C.char, args *C.JedilValue, nargs C.size_t, results *C.JedilValue, max_results C.size_t, nresults *C.size_t) C.int {
+	p := getProgram(program)
+	if p == nil {
+		setError(fmt.Errorf("invalid program handle"))
+		return 1 // JEDIL_ERROR_NULL_POINTER
+	}
+	if args == nil && nargs > 0 {
+		setError(fmt.Errorf("argument buffer is NULL but nargs is %d", nargs))
+		return 1 // JEDIL_ERROR_NULL_POINTER
+	}
+	if results == nil && max_results > 0 {
+		setError(fmt.Errorf("result buffer is NULL but max_results is %d", max_results))
+		return 1
+	}
+	fnName := C.GoString(name)
+
+	ver, v := p.acquire()
+	defer ver.release(v)
+
+	fn, ok := ver.image.Function(fnName)
+	if !ok {
+		setError(fmt.Errorf("unknown function: %s", fnName))
+		return 8 // JEDIL_ERROR_UNKNOWN_FUNCTION
+	}
+	if int(nargs) != fn.Params {
+		setError(fmt.Errorf("function %s expects %d arguments, got %d", fnName, fn.Params, nargs))
+		return 9 // JEDIL_ERROR_INVALID_ARGUMENTS
+	}
+	if int(max_results) < fn.Returns {
+		setError(fmt.Errorf("function %s returns %d values, result buffer holds %d", fnName, fn.Returns, max_results))
+		return 9
+	}
+
+	goArgs := make([]vm.Value, nargs)
+	if nargs > 0 {
+		for i, a := range unsafe.Slice(args, nargs) {
+			val, err := valueFromC(a)
+			if err != nil {
+				setError(fmt.Errorf("argument %d: %v", i, err))
+				return 9
+			}
+			goArgs[i] = val
+		}
+	}
+
+	values, err := v.CallFunction(fnName, goArgs...)
+	if err != nil {
+		setError(err)
+		return runErrorCode(err)
+	}
+
+	out := unsafe.Slice(results, max_results)
+	for i, val := range values {
+		cval, err := valueToC(val)
+		if err != nil {
+			setError(fmt.Errorf("function %s: %v", fnName, err))
+			return 5 // JEDIL_ERROR_TYPE_MISMATCH
+		}
+		out[i] = cval
+	}
+	if nresults != nil {
+		*nresults = C.size_t(len(values))
+	}
+
+	setError(nil)
+	return 0
+}
+
+func valueFromC(a C.JedilValue) (vm.Value, error) {
+	switch a._type {
+	case valueFloat:
+		return vm.NewFloat(float64(a.x)), nil
+	case valueVec3:
+		return vm.NewVec3(types.NewVec3(float64(a.x), float64(a.y), float64(a.z))), nil
+	case valueBool:
+		return vm.NewBool(a.x != 0), nil
+	default:
+		return vm.Value{}, fmt.Errorf("unknown value type %d", int(a._type))
+	}
+}
+
+func valueToC(val vm.Value) (C.JedilValue, error) {
+	switch {
+	case val.IsFloat():
+		return C.JedilValue{_type: valueFloat, x: C.double(val.AsFloat())}, nil
+	case val.IsVec3():
+		vec := val.AsVec3()
+		return C.JedilValue{_type: valueVec3, x: C.double(vec.X), y: C.double(vec.Y), z: C.double(vec.Z)}, nil
+	case val.IsBool():
+		b := 0.0
+		if val.AsBool() {
+			b = 1
+		}
+		return C.JedilValue{_type: valueBool, x: C.double(b)}, nil
+	default:
+		return C.JedilValue{}, fmt.Errorf("unsupported value %s", val.String())
+	}
+}
+
+// ============================================================================
+// Native Functions
+// ============================================================================
+
+//export jedil_register_native
+func jedil_register_native(name *C.char, arity C.int, fn C.JedilNativeFn, user_data unsafe.Pointer) C.int {
+	if fn == nil {
+		setError(fmt.Errorf("native function pointer is NULL"))
+		return 1 // JEDIL_ERROR_NULL_POINTER
+	}
+	nativeName := C.GoString(name)
+
+	err := vm.RegisterNative(nativeName, int(arity), func(args []vm.Value) (vm.Value, error) {
+		// cArgs and result are Go memory, which cgo lets C use for the
+		// duration of the call because JedilValue holds no Go pointers
+		cArgs := make([]C.JedilValue, max(len(args), 1))
+		for i, arg := range args {
+			cval, err := valueToC(arg)
+			if err != nil {
+				return vm.Value{}, fmt.Errorf("argument %d: %v", i, err)
+			}
+			cArgs[i] = cval
+		}
+
+		var result C.JedilValue
+		code := C.jedil_invoke_native(fn, &cArgs[0], C.size_t(len(args)), &result, user_data)
+		if code != 0 {
+			return vm.Value{}, fmt.Errorf("native returned error code %d", int(code))
+		}
+		return valueFromC(result)
+	})
+	if err != nil {
+		setError(err)
+		return 9 // JEDIL_ERROR_INVALID_ARGUMENTS
+	}
+
+	setError(nil)
+	return 0
+}
+
+//export jedil_set_instruction_budget
+func jedil_set_instruction_budget(program unsafe.Pointer, max_instructions C.int64_t) C.int {
+	p := getProgram(program)
+	if p == nil {
+		setError(fmt.Errorf("invalid program handle"))
+		return 1 // JEDIL_ERROR_NULL_POINTER
+	}
+
+	p.mu.Lock()
+	p.budget = int(max_instructions)
+	p.mu.Unlock()
+	setError(nil)
+	return 0
+}
+
+func runErrorCode(err error) C.int {
+	if errors.Is(err, vm.ErrBudgetExceeded) {
+		return 6 // JEDIL_ERROR_BUDGET_EXCEEDED
+	}
+	return 3 // JEDIL_ERROR_EXECUTION_FAILED
+}
+
 // ============================================================================
 // Convenience Functions (No VM, Direct Calls)
 // ============================================================================
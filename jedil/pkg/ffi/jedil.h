@@ -12,7 +12,10 @@ extern "C" {
 // TYPES
 // ============================================================================
 
-// Opaque handle to a JEDIL program
+// Opaque handle to a JEDIL program. Every function may be called from any
+// thread. A handle can be executed or called by several threads at once:
+// the compiled program is never modified, and each call runs in its own
+// execution context.
 typedef void* JedilProgram;
 
 // 3D Vector (matches Go's types.Vec3)
@@ -29,6 +32,26 @@ typedef struct {
     double zs[4];
 } JedilVec3Batch;
 
+// Value passed to and returned from jedil_call
+typedef enum {
+    JEDIL_FLOAT = 0,
+    JEDIL_VEC3 = 1,
+    JEDIL_BOOL = 2,
+} JedilValueType;
+
+// Floats and bools use x (bools as 0/1); vec3s use x, y, z
+typedef struct {
+    int type;   // JedilValueType
+    double x;
+    double y;
+    double z;
+} JedilValue;
+
+// Host function callable from scripts. Receives exactly the registered
+// number of arguments; writes one value to result and returns JEDIL_OK, or
+// any other code to abort execution.
+typedef int (*JedilNativeFn)(const JedilValue* args, size_t nargs, JedilValue* result, void* user_data);
+
 // Error code
 typedef enum {
     JEDIL_OK = 0,
@@ -37,16 +60,33 @@ typedef enum {
     JEDIL_ERROR_EXECUTION_FAILED = 3,
     JEDIL_ERROR_STACK_UNDERFLOW = 4,
     JEDIL_ERROR_TYPE_MISMATCH = 5,
+    JEDIL_ERROR_BUDGET_EXCEEDED = 6,
+    JEDIL_ERROR_INVALID_INPUT = 7,
+    JEDIL_ERROR_UNKNOWN_FUNCTION = 8,
+    JEDIL_ERROR_INVALID_ARGUMENTS = 9,
+    JEDIL_ERROR_RELOAD_FAILED = 10,
 } JedilError;
 
+// Told the outcome of each reload of a watched file (see jedil_watch_file).
+// status is JEDIL_OK once the new version is live, or
+// JEDIL_ERROR_RELOAD_FAILED with the compile or verify error in message if
+// the previous version is still running.
+typedef void (*JedilReloadFn)(JedilProgram program, int status, const char* message, void* user_data);
+
 // ============================================================================
 // PROGRAM LIFECYCLE
 // ============================================================================
 
-// Create a program from bytecode array
-// Returns: Opaque program handle (NULL on error)
+// Create a program from bytecode array: either a .jbc image (detected by its
+// "JBC\0" magic) or raw 9-byte records (u8 opcode + little-endian double arg).
+// Both are statically verified (targets, stack balance, types) before use.
+// Returns: Opaque program handle (NULL on error; see jedil_get_last_error)
 JedilProgram jedil_create_program(const uint8_t* bytecode, size_t len);
 
+// Load a compiled .jbc file (produced by jedilc)
+// Returns: Opaque program handle (NULL on error; see jedil_get_last_error)
+JedilProgram jedil_load_file(const char* filepath);
+
 // Compile a .jedil source file to a program (HOT-RELOAD!)
 // Returns: Opaque program handle (NULL on error)
 JedilProgram jedil_compile_file(const char* filepath);
@@ -55,15 +95,64 @@ JedilProgram jedil_compile_file(const char* filepath);
 // Returns: Opaque program handle (NULL on error)
 JedilProgram jedil_compile_source(const char* source);
 
-// Free a program
+// Free a program. Calls already running on other threads finish normally.
+// For a watched file this also stops the watch; once it returns the reload
+// callback won't run again, so don't call it from inside the callback.
 void jedil_free_program(JedilProgram program);
 
+// ============================================================================
+// HOT RELOAD
+// ============================================================================
+
+// Load a .jedil script or .jbc image and keep it up to date: each time the
+// file is saved it is recompiled, verified and swapped in atomically behind
+// the same handle, so the host keeps calling the handle it already has.
+// Executions in flight finish on the version they started with, and inputs
+// bound with jedil_set_* carry over where the new version declares an input
+// of the same name and type. A save that fails to compile or verify leaves
+// the old version running.
+//
+// callback (may be NULL) runs after every reload attempt on a library
+// thread; there jedil_get_last_error and jedil_get_error_info describe the
+// failure. It should return promptly. user_data is passed through unchanged.
+// Returns: Opaque program handle (NULL if the first load fails; see
+// jedil_get_last_error). Linux only (inotify).
+JedilProgram jedil_watch_file(const char* filepath, JedilReloadFn callback, void* user_data);
+
+// ============================================================================
+// INPUTS
+// ============================================================================
+//
+// Scripts declare inputs with `input name: float` / `input name: vec3`.
+// Bound values persist across executions until set again; unset inputs are
+// zero. Bindings belong to the handle and are seen by every thread running
+// it; to give concurrent calls different inputs, pass them as input_data.
+
+// Number of declared inputs (-1 for an invalid handle)
+int jedil_input_count(JedilProgram program);
+
+// Index of the named input, or -1 if the program doesn't declare it
+int jedil_input_index(JedilProgram program, const char* name);
+
+// Bind an input by name
+JedilError jedil_set_float(JedilProgram program, const char* name, double value);
+JedilError jedil_set_vec3(JedilProgram program, const char* name, double x, double y, double z);
+
+// Bind an input by declaration index
+JedilError jedil_set_float_at(JedilProgram program, int index, double value);
+JedilError jedil_set_vec3_at(JedilProgram program, int index, double x, double y, double z);
+
 // ============================================================================
 // EXECUTION - VECTOR OPERATIONS
 // ============================================================================
+//
+// Every execute call runs the program from the start. input_data may be NULL
+// (use the values bound with jedil_set_*), or point to input_len bytes of
+// doubles packed in declaration order: one per float input, three (x, y, z)
+// per vec3 input. A buffer of the wrong size fails with
+// JEDIL_ERROR_INVALID_INPUT.
 
 // Execute program that returns a Vec3
-// Inputs: arbitrary data buffer (interpreted by bytecode)
 // Output: result vector
 JedilError jedil_execute_vec3(
     JedilProgram program,
@@ -90,6 +179,41 @@ JedilError jedil_execute_batch(
     JedilVec3Batch* result
 );
 
+// ============================================================================
+// FUNCTION CALLS
+// ============================================================================
+
+// Call a named `fn` from the program with nargs arguments. Up to max_results
+// return values are written to results and their count to nresults (which
+// may be NULL). args and results may be NULL only when their count is 0,
+// otherwise the call fails with JEDIL_ERROR_NULL_POINTER. Top-level code is
+// not run, so a script can be loaded once as a library of routines and any
+// of them called directly; they read the inputs bound with jedil_set_*.
+JedilError jedil_call(
+    JedilProgram program,
+    const char* name,
+    const JedilValue* args,
+    size_t nargs,
+    JedilValue* results,
+    size_t max_results,
+    size_t* nresults
+);
+
+// ============================================================================
+// NATIVE FUNCTIONS
+// ============================================================================
+
+// Make a C function callable from scripts as name(...) with arity arguments.
+// Register before compiling the scripts that use it: names are resolved and
+// argument counts checked at compile time. Registering a name again with
+// the same arity replaces the function. user_data is passed through
+// unchanged to every call.
+JedilError jedil_register_native(const char* name, int arity, JedilNativeFn fn, void* user_data);
+
+// Limit how many instructions a single execute call may run before it fails
+// with JEDIL_ERROR_BUDGET_EXCEEDED (default 10,000,000; 0 = unlimited)
+JedilError jedil_set_instruction_budget(JedilProgram program, int64_t max_instructions);
+
 // ============================================================================
 // CONVENIENCE - PRE-BUILT OPERATIONS
 // ============================================================================
@@ -112,9 +236,53 @@ void jedil_batch_add(
 // ERROR HANDLING
 // ============================================================================
 
-// Get last error message (thread-safe)
+// Get the error message from the calling thread's last JEDIL call, or "" if
+// it succeeded. The string belongs to the library and stays valid until this
+// thread's next call. Compile and runtime errors start with their source
+// position ("line 3, column 14: ..."); runtime errors inside functions end
+// with the call chain.
 const char* jedil_get_last_error();
 
+// Release the calling thread's last error. A failed call's error is held
+// until the thread's next JEDIL call, so a thread that may exit right after
+// a failure must call this (or any call that succeeds) first, or the error
+// leaks.
+void jedil_clear_error();
+
+typedef enum {
+    JEDIL_ERROR_KIND_NONE = 0,     // the last call succeeded
+    JEDIL_ERROR_KIND_OTHER = 1,    // no location (bad handle, I/O, ...)
+    JEDIL_ERROR_KIND_COMPILE = 2,  // parse or compile error
+    JEDIL_ERROR_KIND_RUNTIME = 3   // an instruction failed while running
+} JedilErrorKind;
+
+// Structured view of the last error
+typedef struct {
+    int kind;              // JedilErrorKind
+    int line;              // source position, 0 if unknown
+    int column;
+    int opcode;            // runtime: failing opcode, otherwise -1
+    char opcode_name[24];  // runtime: e.g. "OP_ADD"
+    int ip;                // runtime: failing instruction index, otherwise -1
+    int frame_count;       // runtime: call stack depth, see jedil_get_error_frame
+} JedilErrorInfo;
+
+// One level of a runtime error's call stack
+typedef struct {
+    char function[64];     // function name, "" for top-level code
+    int ip;                // executing instruction (call site for outer frames)
+    int line;              // source position of ip, 0 if unknown
+    int column;
+} JedilStackFrame;
+
+// Describe the last error
+JedilError jedil_get_error_info(JedilErrorInfo* info);
+
+// Get frame index (0 = where the error was raised, up to frame_count - 1 =
+// top-level code or the host's jedil_call) of the last runtime error
+// Returns: JEDIL_ERROR_INVALID_INPUT if there is no such frame
+JedilError jedil_get_error_frame(size_t index, JedilStackFrame* frame);
+
 #ifdef __cplusplus
 }
 #endif
@@ -0,0 +1,75 @@
+package hotreload
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"syscall"
+	"unsafe"
+)
+
+// Editors often save by writing a new file and renaming it over the old one,
+// which would end a watch on the file itself. The directory is watched
+// instead, for writes to and renames onto the file's name.
+const watchMask = syscall.IN_CLOSE_WRITE | syscall.IN_MOVED_TO
+
+func (w *Watcher) start() error {
+	fd, err := syscall.InotifyInit1(syscall.IN_CLOEXEC | syscall.IN_NONBLOCK)
+	if err != nil {
+		return os.NewSyscallError("inotify_init1", err)
+	}
+	if _, err := syscall.InotifyAddWatch(fd, filepath.Dir(w.path), watchMask); err != nil {
+		syscall.Close(fd)
+		return os.NewSyscallError("inotify_add_watch", err)
+	}
+
+	// non-blocking, so reads go through the runtime poller and Close
+	// interrupts a pending one
+	events := os.NewFile(uintptr(fd), "inotify")
+	w.stop = events.Close
+	go w.loop(events)
+	return nil
+}
+
+func (w *Watcher) loop(events *os.File) {
+	defer close(w.done)
+
+	name := filepath.Base(w.path)
+	buf := make([]byte, 64*(syscall.SizeofInotifyEvent+syscall.NAME_MAX+1))
+	for {
+		n, err := events.Read(buf)
+		if errors.Is(err, os.ErrClosed) {
+			return
+		}
+		if err != nil {
+			// the watch is dead, so say so rather than go quiet
+			w.report(w.Program(), fmt.Errorf("watch %s: %w", w.path, err))
+			return
+		}
+
+		changed := false
+		for offset := 0; offset+syscall.SizeofInotifyEvent <= n; {
+			event := (*syscall.InotifyEvent)(unsafe.Pointer(&buf[offset]))
+			start := offset + syscall.SizeofInotifyEvent
+			offset = start + int(event.Len)
+
+			// an overflowed queue has dropped events, possibly ones for
+			// the file, so reread it; Reload skips it if it's unchanged
+			if event.Mask&syscall.IN_Q_OVERFLOW != 0 {
+				changed = true
+				continue
+			}
+			eventName := string(bytes.TrimRight(buf[start:offset], "\x00"))
+			if eventName == name && event.Mask&watchMask != 0 {
+				changed = true
+			}
+		}
+
+		// one reload covers every event for the file in this batch
+		if changed {
+			w.Reload()
+		}
+	}
+}
@@ -0,0 +1,9 @@
+//go:build !linux
+
+package hotreload
+
+import "errors"
+
+func (w *Watcher) start() error {
+	return errors.New("file watching needs inotify, which is Linux only")
+}
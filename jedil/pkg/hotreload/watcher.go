@@ -0,0 +1,140 @@
+// Package hotreload keeps a compiled JEDIL program in step with its file.
+//
+// A Watcher recompiles the script each time the file is saved, verifies the
+// result and only then publishes it, so readers of Program always see a
+// complete, verified program. A save that fails to compile or verify leaves
+// the previous version in place.
+package hotreload
+
+import (
+	"bytes"
+	"fmt"
+	"jedil/pkg/bytecode"
+	"jedil/pkg/compiler"
+	"jedil/pkg/vm"
+	"os"
+	"sync"
+	"sync/atomic"
+)
+
+// Load reads a .jedil script or a .jbc image (recognised by its magic),
+// compiles it if needed and verifies it.
+func Load(path string) (*bytecode.Program, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return load(path, data)
+}
+
+func load(path string, data []byte) (*bytecode.Program, error) {
+	var program *bytecode.Program
+	var err error
+	if bytes.HasPrefix(data, bytecode.Magic[:]) {
+		program, err = bytecode.Decode(data, vm.ResolveNative)
+	} else {
+		program, err = compiler.CompileProgram(string(data))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if err := vm.Verify(program); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return program, nil
+}
+
+// ReloadFunc is told the outcome of every reload. On success p is the new
+// program and err is nil; on failure p is the previous program, which stays
+// current, and err says what was wrong with the new file.
+type ReloadFunc func(p *bytecode.Program, err error)
+
+// Watcher holds the current version of a script and replaces it whenever
+// its file changes.
+type Watcher struct {
+	path     string
+	onReload ReloadFunc
+
+	current atomic.Pointer[bytecode.Program]
+
+	mu   sync.Mutex // serialises reloads
+	last []byte     // file contents behind the current program
+
+	stop func() error  // stops the platform watch
+	done chan struct{} // closed when the watch loop exits
+}
+
+// Watch loads the file at path and starts watching it. onReload, which may
+// be nil, is called from the watcher's goroutine after each change; it
+// should return promptly, as further changes wait for it. The initial load
+// must succeed, since there is no previous version to fall back on.
+func Watch(path string, onReload ReloadFunc) (*Watcher, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	program, err := load(path, data)
+	if err != nil {
+		return nil, err
+	}
+
+	w := &Watcher{path: path, onReload: onReload, last: data, done: make(chan struct{})}
+	w.current.Store(program)
+	if err := w.start(); err != nil {
+		return nil, fmt.Errorf("watch %s: %v", path, err)
+	}
+	return w, nil
+}
+
+// Program returns the current version. Each call may return a newer one;
+// a program once returned never changes.
+func (w *Watcher) Program() *bytecode.Program {
+	return w.current.Load()
+}
+
+// Path returns the watched file.
+func (w *Watcher) Path() string {
+	return w.path
+}
+
+// Reload rereads the file now rather than waiting for a change, and reports
+// the result to onReload as well as returning it. Contents matching the
+// current program are not reloaded; contents that failed before are tried
+// again.
+func (w *Watcher) Reload() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	data, err := os.ReadFile(w.path)
+	if err != nil {
+		w.report(w.Program(), err)
+		return err
+	}
+	if bytes.Equal(data, w.last) {
+		return nil
+	}
+
+	program, err := load(w.path, data)
+	if err != nil {
+		w.report(w.Program(), err)
+		return err
+	}
+	w.last = data
+	w.current.Store(program)
+	w.report(program, nil)
+	return nil
+}
+
+func (w *Watcher) report(p *bytecode.Program, err error) {
+	if w.onReload != nil {
+		w.onReload(p, err)
+	}
+}
+
+// Close stops watching. Once it returns onReload won't be called again, so
+// it must not be called from onReload itself.
+func (w *Watcher) Close() error {
+	err := w.stop()
+	<-w.done
+	return err
+}
@@ -0,0 +1,158 @@
+//go:build linux
+
+package hotreload
+
+import (
+	"errors"
+	"jedil/pkg/bytecode"
+	"jedil/pkg/compiler"
+	"jedil/pkg/vm"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+type reload struct {
+	program *bytecode.Program
+	err     error
+}
+
+func run(t *testing.T, p *bytecode.Program) float64 {
+	t.Helper()
+	machine := vm.NewFromProgram(p)
+	if err := machine.Run(); err != nil {
+		t.Fatalf("run failed: %v", err)
+	}
+	result, _ := machine.GetResult()
+	return result.AsFloat()
+}
+
+func next(t *testing.T, reloads chan reload) reload {
+	t.Helper()
+	select {
+	case r := <-reloads:
+		return r
+	case <-time.After(5 * time.Second):
+		t.Fatal("no reload after the file changed")
+		return reload{}
+	}
+}
+
+func TestWatchReloads(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "model.jedil")
+	if err := os.WriteFile(path, []byte("return 1"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	reloads := make(chan reload, 4)
+	w, err := Watch(path, func(p *bytecode.Program, err error) { reloads <- reload{p, err} })
+	if err != nil {
+		t.Fatalf("watch failed: %v", err)
+	}
+	defer w.Close()
+	if got := run(t, w.Program()); got != 1 {
+		t.Fatalf("expected 1, got %g", got)
+	}
+
+	// written in place
+	os.WriteFile(path, []byte("return 2"), 0o644)
+	if r := next(t, reloads); r.err != nil || r.program != w.Program() || run(t, r.program) != 2 {
+		t.Fatalf("expected version 2, got %+v", r)
+	}
+
+	// a failed compile reports the error and keeps the old version
+	good := w.Program()
+	os.WriteFile(path, []byte("return 2 +"), 0o644)
+	r := next(t, reloads)
+	var compileErr *compiler.Error
+	if !errors.As(r.err, &compileErr) || compileErr.Line != 1 {
+		t.Fatalf("expected a located compile error, got %v", r.err)
+	}
+	if r.program != good || w.Program() != good {
+		t.Fatal("a failed reload replaced the program")
+	}
+
+	// saved by renaming a new file over the old one, as editors do
+	tmp := path + ".tmp"
+	os.WriteFile(tmp, []byte("return 3"), 0o644)
+	if err := os.Rename(tmp, path); err != nil {
+		t.Fatal(err)
+	}
+	if r := next(t, reloads); r.err != nil || run(t, w.Program()) != 3 {
+		t.Fatalf("expected version 3, got %+v", r)
+	}
+
+	if err := w.Close(); err != nil {
+		t.Fatalf("close failed: %v", err)
+	}
+	os.WriteFile(path, []byte("return 4"), 0o644)
+	select {
+	case r := <-reloads:
+		t.Fatalf("reloaded after close: %+v", r)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestReloadRetriesFailedContents(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "model.jedil")
+	os.WriteFile(path, []byte("return 1"), 0o644)
+
+	reloads := make(chan reload, 4)
+	w, err := Watch(path, func(p *bytecode.Program, err error) { reloads <- reload{p, err} })
+	if err != nil {
+		t.Fatalf("watch failed: %v", err)
+	}
+	defer w.Close()
+
+	// fails until the host registers the native it calls
+	os.WriteFile(path, []byte("return hotreload_twice(3)"), 0o644)
+	if r := next(t, reloads); r.err == nil {
+		t.Fatal("expected an unknown native error")
+	}
+
+	err = vm.RegisterNative("hotreload_twice", 1, func(args []vm.Value) (vm.Value, error) {
+		return vm.NewFloat(2 * args[0].AsFloat()), nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Reload(); err != nil {
+		t.Fatalf("reload of the same contents failed: %v", err)
+	}
+	if got := run(t, w.Program()); got != 6 {
+		t.Fatalf("expected 6, got %g", got)
+	}
+}
+
+func TestWatchNeedsAValidStart(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "model.jedil")
+	os.WriteFile(path, []byte("let = 1"), 0o644)
+	if _, err := Watch(path, nil); err == nil {
+		t.Fatal("expected the initial compile error")
+	}
+	if _, err := Watch(filepath.Join(t.TempDir(), "missing.jedil"), nil); err == nil {
+		t.Fatal("expected an error for a missing file")
+	}
+}
+
+func TestLoadImage(t *testing.T) {
+	program, err := compiler.CompileProgram("return 5")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := bytecode.Encode(program)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "model.jbc")
+	os.WriteFile(path, data, 0o644)
+
+	loaded, err := Load(path)
+	if err != nil {
+		t.Fatalf("load failed: %v", err)
+	}
+	if got := run(t, loaded); got != 5 {
+		t.Fatalf("expected 5, got %g", got)
+	}
+}
@@ -39,7 +39,7 @@ func BenchmarkVMScalar(b *testing.B) {
 	for i := 0; i < b.N; i++ {
 		vm.ip = 0        // Reset Instruction Pointer
 		vm.stack.top = 8 // Reset Stack Pointer (pretend data is still there)
-		vm.Run()
+		vm.resume()
 	}
 }
 
@@ -65,6 +65,6 @@ func BenchmarkVMBatch(b *testing.B) {
 	for i := 0; i < b.N; i++ {
 		vm.ip = 0
 		vm.stack.top = 2
-		vm.Run()
+		vm.resume()
 	}
 }
@@ -0,0 +1,68 @@
+package vm
+
+import (
+	"fmt"
+	"jedil/pkg/bytecode"
+)
+
+// Functions returns the program's exported function table.
+func (vm *VM) Functions() []bytecode.Function {
+	return vm.functions
+}
+
+// CallFunction runs a single named function with the given arguments and
+// returns the values it returns, in order. The VM is reset first, so it can
+// be mixed freely with Run; top-level code is not executed.
+func (vm *VM) CallFunction(name string, args ...Value) ([]Value, error) {
+	var fn bytecode.Function
+	found := false
+	for _, f := range vm.functions {
+		if f.Name == name {
+			fn, found = f, true
+			break
+		}
+	}
+	if !found {
+		return nil, fmt.Errorf("unknown function: %s", name)
+	}
+	if len(args) != fn.Params {
+		return nil, fmt.Errorf("function %s expects %d arguments, got %d", name, fn.Params, len(args))
+	}
+	if fn.Address < 0 || fn.Address >= len(vm.code) {
+		return nil, fmt.Errorf("function %s: invalid address %d", name, fn.Address)
+	}
+
+	vm.Reset()
+	for _, arg := range args {
+		if err := vm.stack.Push(arg); err != nil {
+			return nil, fmt.Errorf("call %s: %v", name, err)
+		}
+	}
+
+	// Enter the function the way OP_CALL would, but return to the end of
+	// the code so execution stops as soon as the function does
+	frame := CallFrame{
+		returnAddress: len(vm.code),
+		basePointer:   0,
+		localCount:    fn.Params,
+		function:      fn.Address,
+	}
+	if err := vm.callStack.Push(frame); err != nil {
+		return nil, fmt.Errorf("call %s: %v", name, err)
+	}
+	vm.ip = fn.Address
+
+	if err := vm.resume(); err != nil {
+		return nil, fmt.Errorf("call %s: %w", name, err)
+	}
+	if vm.callStack.top != 0 {
+		return nil, fmt.Errorf("call %s: halted before returning", name)
+	}
+	if vm.stack.top != fn.Returns {
+		return nil, fmt.Errorf("call %s: expected %d return values, stack holds %d", name, fn.Returns, vm.stack.top)
+	}
+
+	results := make([]Value, fn.Returns)
+	copy(results, vm.stack.values[:fn.Returns])
+	return results, nil
+}
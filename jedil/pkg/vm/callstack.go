@@ -8,6 +8,7 @@ type CallFrame struct {
 	returnAddress int // IP to return to after
 	basePointer int // Stack offset where functions params begin
 	localCount int // Number of stack slots used (params + locals)
+	function int // Entry address of the function this frame runs
 }
 
 type CallStack struct {
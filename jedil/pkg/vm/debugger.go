@@ -0,0 +1,301 @@
+package vm
+
+import (
+	"errors"
+	"fmt"
+	"jedil/pkg/bytecode"
+	"maps"
+	"slices"
+)
+
+// StopReason says why the debugger handed control back.
+type StopReason int
+
+const (
+	StopEntry      StopReason = iota // paused before the first instruction
+	StopStep                         // a step completed
+	StopBreakpoint                   // reached a breakpoint
+	StopFinished                     // the program halted or ran off the end
+	StopError                        // an instruction failed
+)
+
+func (r StopReason) String() string {
+	switch r {
+	case StopEntry:
+		return "entry"
+	case StopStep:
+		return "step"
+	case StopBreakpoint:
+		return "breakpoint"
+	case StopFinished:
+		return "finished"
+	case StopError:
+		return "error"
+	default:
+		return "unknown"
+	}
+}
+
+// Variable is a named local and its current value.
+type Variable struct {
+	Name  string
+	Slot  int
+	Value Value
+}
+
+// Debugger runs a program under control: breakpoints by source line or IP,
+// stepping by instruction or source line, and inspection of frames, stack
+// slots and named locals. Frame 0 is always the innermost.
+//
+// A new debugger is paused before the program's first instruction. Bind
+// inputs through VM() and call Restart before running to apply them.
+type Debugger struct {
+	vm          *VM
+	program     *bytecode.Program
+	breakpoints map[int]bool
+	state       StopReason
+	err         *RuntimeError // set while stopped with StopError
+}
+
+// NewDebugger creates a VM for p and pauses it at entry.
+func NewDebugger(p *bytecode.Program) (*Debugger, error) {
+	d := &Debugger{
+		vm:          NewFromProgram(p),
+		program:     p,
+		breakpoints: make(map[int]bool),
+	}
+	if err := d.Restart(); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// VM returns the debugged VM, e.g. to bind inputs or read the result.
+func (d *Debugger) VM() *VM {
+	return d.vm
+}
+
+// Program returns the program being debugged.
+func (d *Debugger) Program() *bytecode.Program {
+	return d.program
+}
+
+// State returns why the program is currently stopped.
+func (d *Debugger) State() StopReason {
+	return d.state
+}
+
+// Err returns the runtime error the program stopped on, if any.
+func (d *Debugger) Err() *RuntimeError {
+	return d.err
+}
+
+// Restart rewinds the program to its entry, reseeding inputs. Breakpoints
+// are kept.
+func (d *Debugger) Restart() error {
+	d.vm.Reset()
+	d.state = StopEntry
+	d.err = nil
+	return d.vm.seedInputs()
+}
+
+// BreakAtIP sets a breakpoint on the instruction at ip.
+func (d *Debugger) BreakAtIP(ip int) error {
+	if ip < 0 || ip >= len(d.program.Code) {
+		return fmt.Errorf("no instruction at IP %d (program has %d)", ip, len(d.program.Code))
+	}
+	d.breakpoints[ip] = true
+	return nil
+}
+
+// BreakAtLine sets a breakpoint on the first instruction compiled from the
+// given source line and returns its IP.
+func (d *Debugger) BreakAtLine(line int) (int, error) {
+	ip := slices.Index(d.program.Lines, line)
+	if line <= 0 || ip < 0 {
+		return -1, fmt.Errorf("no code on line %d", line)
+	}
+	d.breakpoints[ip] = true
+	return ip, nil
+}
+
+// ClearBreakpoint removes the breakpoint at ip, if there is one.
+func (d *Debugger) ClearBreakpoint(ip int) {
+	delete(d.breakpoints, ip)
+}
+
+// Breakpoints returns the IPs of all breakpoints in ascending order.
+func (d *Debugger) Breakpoints() []int {
+	return slices.Sorted(maps.Keys(d.breakpoints))
+}
+
+// Continue runs until a breakpoint, the end of the program or an error.
+func (d *Debugger) Continue() (StopReason, error) {
+	return d.resume(nil)
+}
+
+// StepInstruction executes a single instruction.
+func (d *Debugger) StepInstruction() (StopReason, error) {
+	return d.resume(func() bool { return true })
+}
+
+// StepInto runs until execution reaches a different source line, entering
+// any function called on the way.
+func (d *Debugger) StepInto() (StopReason, error) {
+	depth, line := d.vm.callStack.top, d.line()
+	return d.resume(func() bool {
+		current := d.line()
+		return current != 0 && (current != line || d.vm.callStack.top != depth)
+	})
+}
+
+// StepOver runs until execution reaches a different source line in the
+// current function, or returns from it. Calls run to completion unless they
+// hit a breakpoint.
+func (d *Debugger) StepOver() (StopReason, error) {
+	depth, line := d.vm.callStack.top, d.line()
+	return d.resume(func() bool {
+		current := d.line()
+		if current == 0 || d.vm.callStack.top > depth {
+			return false
+		}
+		return current != line || d.vm.callStack.top < depth
+	})
+}
+
+// StepOut runs until the current function returns to its caller.
+func (d *Debugger) StepOut() (StopReason, error) {
+	depth := d.vm.callStack.top
+	if depth == 0 {
+		return d.state, fmt.Errorf("not inside a function")
+	}
+	return d.resume(func() bool {
+		return d.vm.callStack.top < depth
+	})
+}
+
+// resume runs the VM until stepDone reports the step complete, a breakpoint
+// is reached, or the program ends.
+func (d *Debugger) resume(stepDone func() bool) (StopReason, error) {
+	if d.state == StopFinished || d.state == StopError {
+		return d.state, fmt.Errorf("program has stopped (%s); restart to run it again", d.state)
+	}
+
+	reason := StopStep
+	d.vm.pause = func() bool {
+		if d.breakpoints[d.vm.ip] {
+			reason = StopBreakpoint
+			return true
+		}
+		return stepDone != nil && stepDone()
+	}
+	defer func() { d.vm.pause = nil }()
+
+	at := d.vm.ip
+	err := d.vm.execute(&at)
+	switch {
+	case errors.Is(err, errPaused):
+		d.state = reason
+	case err != nil:
+		d.err = d.vm.runtimeError(at, err)
+		d.state = StopError
+		return d.state, d.err
+	default:
+		d.state = StopFinished
+	}
+	return d.state, nil
+}
+
+// ip is the instruction the program is stopped at: the next to run, or the
+// one that failed.
+func (d *Debugger) ip() int {
+	if d.err != nil {
+		return d.err.IP
+	}
+	return d.vm.ip
+}
+
+func (d *Debugger) line() int {
+	line, _ := d.vm.position(d.vm.ip)
+	return line
+}
+
+// Location returns the innermost frame: where the program is stopped.
+func (d *Debugger) Location() StackFrame {
+	return d.Frames()[0]
+}
+
+// Frames returns the call stack, innermost frame first, ending with
+// top-level code.
+func (d *Debugger) Frames() []StackFrame {
+	return d.vm.backtrace(d.ip())
+}
+
+// frameBounds returns the stack range [base, end) that frame occupies.
+func (d *Debugger) frameBounds(frame int) (base, end int, err error) {
+	depth := d.vm.callStack.top
+	if frame < 0 || frame > depth {
+		return 0, 0, fmt.Errorf("no frame %d (stack has %d)", frame, depth+1)
+	}
+
+	// frame i runs on callStack.frames[depth-1-i]; the last is top level
+	end = d.vm.stack.top
+	if frame > 0 {
+		end = d.vm.callStack.frames[depth-frame].basePointer
+	}
+	if frame < depth {
+		base = d.vm.callStack.frames[depth-1-frame].basePointer
+	}
+	return base, end, nil
+}
+
+// Slots returns the values on the stack in the given frame, from its first
+// slot (its first parameter, in a function) up.
+func (d *Debugger) Slots(frame int) ([]Value, error) {
+	base, end, err := d.frameBounds(frame)
+	if err != nil {
+		return nil, err
+	}
+	return slices.Clone(d.vm.stack.values[base:end]), nil
+}
+
+// Locals returns the named variables live in the given frame, in slot
+// order. Where a name is shadowed only the innermost binding is listed.
+func (d *Debugger) Locals(frame int) ([]Variable, error) {
+	base, end, err := d.frameBounds(frame)
+	if err != nil {
+		return nil, err
+	}
+	ip := d.Frames()[frame].IP
+
+	live := make(map[string]bytecode.Local)
+	for _, local := range d.program.Locals {
+		if ip < local.Start || ip >= local.End || base+local.Slot >= end {
+			continue
+		}
+		if prev, ok := live[local.Name]; !ok || local.Start > prev.Start {
+			live[local.Name] = local
+		}
+	}
+
+	vars := make([]Variable, 0, len(live))
+	for _, local := range live {
+		vars = append(vars, Variable{Name: local.Name, Slot: local.Slot, Value: d.vm.stack.values[base+local.Slot]})
+	}
+	slices.SortFunc(vars, func(a, b Variable) int { return a.Slot - b.Slot })
+	return vars, nil
+}
+
+// Lookup returns the value of a variable visible in the innermost frame.
+func (d *Debugger) Lookup(name string) (Value, error) {
+	vars, err := d.Locals(0)
+	if err != nil {
+		return Value{}, err
+	}
+	for _, v := range vars {
+		if v.Name == name {
+			return v.Value, nil
+		}
+	}
+	return Value{}, fmt.Errorf("no variable %s in scope", name)
+}
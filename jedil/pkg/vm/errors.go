@@ -0,0 +1,119 @@
+package vm
+
+import (
+	"fmt"
+	"jedil/pkg/bytecode"
+	"strings"
+)
+
+// StackFrame is one level of a runtime error's call stack.
+type StackFrame struct {
+	Function string // function name, or "" for top-level code
+	IP       int    // executing instruction, or the call site for outer frames
+	Line     int    // source position of IP; zero without a source map
+	Column   int
+}
+
+// RuntimeError is an error raised while executing an instruction. It records
+// the instruction, its source position when the program carries a source
+// map, and the call stack, innermost frame first. Unwrap gives the
+// underlying error, so errors.Is(err, ErrBudgetExceeded) still works.
+type RuntimeError struct {
+	Op     bytecode.OpCode
+	IP     int
+	Line   int
+	Column int
+	Trace  []StackFrame
+	Err    error
+}
+
+func (e *RuntimeError) Error() string {
+	var sb strings.Builder
+	if e.Line > 0 {
+		fmt.Fprintf(&sb, "line %d, column %d: ", e.Line, e.Column)
+	} else {
+		fmt.Fprintf(&sb, "IP %d (%s): ", e.IP, e.Op)
+	}
+	sb.WriteString(e.Err.Error())
+
+	// only worth spelling out when the error is inside a function
+	if len(e.Trace) > 0 && e.Trace[0].Function != "" {
+		fmt.Fprintf(&sb, " [in %s", e.Trace[0].Function)
+		for _, f := range e.Trace[1:] {
+			sb.WriteString(", called from ")
+			if f.Line > 0 {
+				fmt.Fprintf(&sb, "line %d", f.Line)
+			} else {
+				fmt.Fprintf(&sb, "IP %d", f.IP)
+			}
+			if f.Function != "" {
+				fmt.Fprintf(&sb, " in %s", f.Function)
+			}
+		}
+		sb.WriteString("]")
+	}
+	return sb.String()
+}
+
+func (e *RuntimeError) Unwrap() error {
+	return e.Err
+}
+
+// runtimeError wraps err, raised by the instruction at ip, with its location
+// and the current call stack.
+func (vm *VM) runtimeError(ip int, err error) *RuntimeError {
+	e := &RuntimeError{IP: ip, Err: err}
+	if ip < len(vm.code) {
+		e.Op = vm.code[ip].Op
+	}
+	e.Line, e.Column = vm.position(ip)
+	e.Trace = vm.backtrace(ip)
+	return e
+}
+
+// backtrace lists the call stack, innermost frame first, for a program
+// executing the instruction at ip.
+func (vm *VM) backtrace(ip int) []StackFrame {
+	var trace []StackFrame
+
+	// each frame runs a function, and its return address minus one is the
+	// call site in the frame below
+	for i := vm.callStack.top - 1; ; i-- {
+		frame := StackFrame{IP: ip}
+		frame.Line, frame.Column = vm.position(ip)
+		if i < 0 {
+			trace = append(trace, frame) // top-level code
+			break
+		}
+
+		f := vm.callStack.frames[i]
+		frame.Function = vm.functionName(f.function)
+		trace = append(trace, frame)
+		if f.returnAddress >= len(vm.code) {
+			break // entered by CallFunction; the caller is the host
+		}
+		ip = f.returnAddress - 1
+	}
+	return trace
+}
+
+// position returns the source line and column of the instruction at ip, or
+// zeros without a source map
+func (vm *VM) position(ip int) (line, column int) {
+	if ip >= 0 && ip < len(vm.lines) {
+		line = vm.lines[ip]
+	}
+	if ip >= 0 && ip < len(vm.columns) {
+		column = vm.columns[ip]
+	}
+	return line, column
+}
+
+func (vm *VM) functionName(address int) string {
+	for _, fn := range vm.functions {
+		if fn.Address == address {
+			return fn.Name
+		}
+	}
+	return fmt.Sprintf("function@%d", address)
+}
@@ -0,0 +1,90 @@
+package vm
+
+import (
+	"fmt"
+	"jedil/pkg/bytecode"
+	"jedil/pkg/types"
+)
+
+// NewFromProgram creates a VM for a compiled program, with every declared
+// input initialised to the zero value of its type, the function table
+// available to CallFunction and the source map used to locate runtime errors.
+func NewFromProgram(p *bytecode.Program) *VM {
+	vm := New(p.Code)
+	vm.functions = p.Functions
+	vm.lines = p.Lines
+	vm.columns = p.Columns
+	vm.inputs = p.Inputs
+	vm.inputValues = make([]Value, len(p.Inputs))
+	for i, in := range p.Inputs {
+		vm.inputValues[i] = zeroInput(in.Type)
+	}
+	return vm
+}
+
+func zeroInput(t bytecode.InputType) Value {
+	if t == bytecode.INPUT_VEC3 {
+		return NewVec3(types.Vec3{})
+	}
+	return NewFloat(0)
+}
+
+// Inputs returns the program's declared inputs in slot order.
+func (vm *VM) Inputs() []bytecode.Input {
+	return vm.inputs
+}
+
+// InputIndex returns the slot of the named input, or -1 if there is none.
+func (vm *VM) InputIndex(name string) int {
+	for i, in := range vm.inputs {
+		if in.Name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// SetInput binds the named input for subsequent runs.
+func (vm *VM) SetInput(name string, v Value) error {
+	index := vm.InputIndex(name)
+	if index < 0 {
+		return fmt.Errorf("unknown input: %s", name)
+	}
+	return vm.SetInputAt(index, v)
+}
+
+// SetInputAt binds the input at index for subsequent runs. The value must
+// match the declared type.
+func (vm *VM) SetInputAt(index int, v Value) error {
+	if index < 0 || index >= len(vm.inputs) {
+		return fmt.Errorf("input index %d out of range (program has %d inputs)", index, len(vm.inputs))
+	}
+
+	in := vm.inputs[index]
+	switch {
+	case in.Type == bytecode.INPUT_FLOAT && v.IsFloat():
+	case in.Type == bytecode.INPUT_VEC3 && v.IsVec3():
+	default:
+		return fmt.Errorf("input %s expects %s, got %s", in.Name, in.Type, v.String())
+	}
+
+	vm.inputValues[index] = v
+	return nil
+}
+
+// seedInputs clears the stack and pushes the bound inputs into the slots the
+// compiler reserved for them. Programs without inputs are left untouched.
+func (vm *VM) seedInputs() error {
+	if len(vm.inputs) == 0 {
+		return nil
+	}
+
+	vm.stack.Reset()
+	vm.callStack.top = 0
+	for _, v := range vm.inputValues {
+		if err := vm.stack.Push(v); err != nil {
+			return fmt.Errorf("seeding inputs failed: %v", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,85 @@
+package vm
+
+import (
+	"fmt"
+	"jedil/pkg/bytecode"
+)
+
+// Pop a bool from the stack
+func (vm *VM) popBool() (bool, error) {
+	v, err := vm.stack.Pop()
+	if err != nil {
+		return false, err
+	}
+	if !v.IsBool() {
+		return false, fmt.Errorf("expected bool, got %s", v.String())
+	}
+	return v.AsBool(), nil
+}
+
+// OP_EQ / OP_NE: equality over floats, bools and vec3s -> Bool
+func (vm *VM) opEqual(negate bool) error {
+	b, err := vm.stack.Pop()
+	if err != nil {
+		return err
+	}
+	a, err := vm.stack.Pop()
+	if err != nil {
+		return err
+	}
+
+	if a.Type != b.Type {
+		return fmt.Errorf("cannot compare %s with %s", a.String(), b.String())
+	}
+
+	var equal bool
+	switch a.Type {
+	case TYPE_FLOAT, TYPE_BOOL:
+		equal = a.Data == b.Data
+	case TYPE_NIL:
+		equal = true
+	case TYPE_VEC3:
+		equal = a.AsVec3() == b.AsVec3()
+	default:
+		return fmt.Errorf("values of this type cannot be compared: %s", a.String())
+	}
+
+	return vm.stack.Push(NewBool(equal != negate))
+}
+
+// OP_LT / OP_LE / OP_GT / OP_GE: ordering over floats -> Bool
+func (vm *VM) opCompare(op bytecode.OpCode) error {
+	b, err := vm.popFloat()
+	if err != nil {
+		return err
+	}
+	a, err := vm.popFloat()
+	if err != nil {
+		return err
+	}
+
+	var result bool
+	switch op {
+	case bytecode.OP_LT:
+		result = a < b
+	case bytecode.OP_LE:
+		result = a <= b
+	case bytecode.OP_GT:
+		result = a > b
+	case bytecode.OP_GE:
+		result = a >= b
+	default:
+		return fmt.Errorf("not a comparison: %s", op)
+	}
+
+	return vm.stack.Push(NewBool(result))
+}
+
+// OP_NOT: !b -> Bool
+func (vm *VM) opNot() error {
+	b, err := vm.popBool()
+	if err != nil {
+		return err
+	}
+	return vm.stack.Push(NewBool(!b))
+}
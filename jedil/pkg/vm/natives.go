@@ -0,0 +1,146 @@
+package vm
+
+import (
+	"fmt"
+	"sync"
+)
+
+// NativeFunc implements a builtin in Go. It receives exactly the declared
+// number of arguments, in call order.
+type NativeFunc func(args []Value) (Value, error)
+
+// Native is an entry in the native function table. OP_CALL_NATIVE refers to
+// natives by their index in the table.
+type Native struct {
+	Name  string
+	Arity int
+	Fn    NativeFunc
+}
+
+// nativeTable holds every native, in index order. The standard library comes
+// first so its indices are the same in every build; host natives follow in
+// registration order.
+var nativeTable []Native
+
+// nativeIndex maps names to indices in nativeTable
+var nativeIndex = make(map[string]int)
+
+// stdlibCount is how many natives the standard library registered; those
+// can't be replaced by hosts
+var stdlibCount int
+
+var nativeMu sync.RWMutex
+
+// reserved names are compiled to dedicated opcodes and would shadow a native
+var reservedNatives = map[string]bool{"vec3": true, "cross": true, "dot": true, "mag": true}
+
+func registerNative(name string, arity int, fn NativeFunc) int {
+	nativeIndex[name] = len(nativeTable)
+	nativeTable = append(nativeTable, Native{Name: name, Arity: arity, Fn: fn})
+	return len(nativeTable) - 1
+}
+
+// RegisterNative makes a Go function callable from scripts as name(...).
+// Scripts compiled afterwards resolve the name at compile time and reject
+// calls with the wrong number of arguments; functions defined in a script
+// shadow natives of the same name.
+//
+// Registering a name again replaces its implementation, so hosts can swap a
+// model at runtime, but the arity must stay the same since compiled programs
+// have already been checked against it. Standard library natives can't be
+// replaced. Safe for concurrent use.
+func RegisterNative(name string, arity int, fn NativeFunc) error {
+	if name == "" || fn == nil {
+		return fmt.Errorf("native needs a name and a function")
+	}
+	if arity < 0 {
+		return fmt.Errorf("native %s: negative arity %d", name, arity)
+	}
+	if reservedNatives[name] {
+		return fmt.Errorf("native %s: name is reserved for a builtin", name)
+	}
+
+	nativeMu.Lock()
+	defer nativeMu.Unlock()
+
+	if index, ok := nativeIndex[name]; ok {
+		if index < stdlibCount {
+			return fmt.Errorf("native %s: can't replace a standard library function", name)
+		}
+		if nativeTable[index].Arity != arity {
+			return fmt.Errorf("native %s: already registered with %d arguments, not %d",
+				name, nativeTable[index].Arity, arity)
+		}
+		nativeTable[index].Fn = fn
+		return nil
+	}
+
+	registerNative(name, arity, fn)
+	return nil
+}
+
+// LookupNative finds a native by name, returning its OP_CALL_NATIVE index.
+func LookupNative(name string) (int, Native, bool) {
+	nativeMu.RLock()
+	defer nativeMu.RUnlock()
+
+	index, ok := nativeIndex[name]
+	if !ok {
+		return -1, Native{}, false
+	}
+	return index, nativeTable[index], true
+}
+
+// ResolveNative finds a native by name and checks its arity. It has the
+// shape of bytecode.NativeResolver, for relinking loaded programs.
+func ResolveNative(name string, arity int) (int, error) {
+	index, native, ok := LookupNative(name)
+	if !ok {
+		return -1, fmt.Errorf("unknown native function: %s", name)
+	}
+	if native.Arity != arity {
+		return -1, fmt.Errorf("native %s takes %d arguments here, program expects %d", name, native.Arity, arity)
+	}
+	return index, nil
+}
+
+// NativeAt returns the native with the given index.
+func NativeAt(index int) (Native, bool) {
+	nativeMu.RLock()
+	defer nativeMu.RUnlock()
+
+	if index < 0 || index >= len(nativeTable) {
+		return Native{}, false
+	}
+	return nativeTable[index], true
+}
+
+// OP_CALL_NATIVE: pop the native's arguments, call it, push its result
+func (vm *VM) opCallNative(index int) error {
+	native, ok := NativeAt(index)
+	if !ok {
+		return fmt.Errorf("invalid native index %d", index)
+	}
+
+	// avoid allocating for the common small arities
+	var buf [4]Value
+	args := buf[:0]
+	if native.Arity > len(buf) {
+		args = make([]Value, 0, native.Arity)
+	}
+	args = args[:native.Arity]
+
+	for i := native.Arity - 1; i >= 0; i-- {
+		v, err := vm.stack.Pop()
+		if err != nil {
+			return fmt.Errorf("%s: %v", native.Name, err)
+		}
+		args[i] = v
+	}
+
+	result, err := native.Fn(args)
+	if err != nil {
+		return fmt.Errorf("%s: %v", native.Name, err)
+	}
+	return vm.stack.Push(result)
+}
@@ -63,6 +63,15 @@ func (s *Stack) Get(offset int) (Value, error) {
 	return s.values[offset], nil
 }
 
+// Set overwrites the value at offset, which must be below the top of the stack.
+func (s *Stack) Set(offset int, v Value) error {
+	if offset < 0 || offset >= s.top {
+		return fmt.Errorf("stack set: index %d out of bounds", offset)
+	}
+	s.values[offset] = v
+	return nil
+}
+
 // String returns a string representation of the stack for debugging.
 func (s *Stack) String() string {
 	if s.top == 0 {
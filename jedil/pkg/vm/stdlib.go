@@ -0,0 +1,97 @@
+package vm
+
+import (
+	"fmt"
+	"math"
+)
+
+// Scalar math library. Registration order fixes the OP_CALL_NATIVE indices,
+// so new entries go at the end.
+func init() {
+	registerNative("sqrt", 1, checked1(func(x float64) (float64, error) {
+		if x < 0 {
+			return 0, fmt.Errorf("square root of negative number %g", x)
+		}
+		return math.Sqrt(x), nil
+	}))
+	registerNative("sin", 1, float1(math.Sin))
+	registerNative("cos", 1, float1(math.Cos))
+	registerNative("tan", 1, float1(math.Tan))
+	registerNative("asin", 1, checked1(func(x float64) (float64, error) {
+		if x < -1 || x > 1 {
+			return 0, fmt.Errorf("argument %g outside [-1, 1]", x)
+		}
+		return math.Asin(x), nil
+	}))
+	registerNative("acos", 1, checked1(func(x float64) (float64, error) {
+		if x < -1 || x > 1 {
+			return 0, fmt.Errorf("argument %g outside [-1, 1]", x)
+		}
+		return math.Acos(x), nil
+	}))
+	registerNative("atan2", 2, float2(math.Atan2))
+	registerNative("exp", 1, float1(math.Exp))
+	registerNative("log", 1, checked1(func(x float64) (float64, error) {
+		if x <= 0 {
+			return 0, fmt.Errorf("logarithm of non-positive number %g", x)
+		}
+		return math.Log(x), nil
+	}))
+	registerNative("pow", 2, float2(math.Pow))
+	registerNative("abs", 1, float1(math.Abs))
+	registerNative("floor", 1, float1(math.Floor))
+	registerNative("min", 2, float2(math.Min))
+	registerNative("max", 2, float2(math.Max))
+	registerNative("clamp", 3, func(args []Value) (Value, error) {
+		x, lo, hi, err := floatArgs3(args)
+		if err != nil {
+			return Value{}, err
+		}
+		if lo > hi {
+			return Value{}, fmt.Errorf("lower bound %g above upper bound %g", lo, hi)
+		}
+		return NewFloat(math.Min(math.Max(x, lo), hi)), nil
+	})
+
+	stdlibCount = len(nativeTable)
+}
+
+// float1 adapts a float -> float function to a NativeFunc
+func float1(f func(float64) float64) NativeFunc {
+	return checked1(func(x float64) (float64, error) {
+		return f(x), nil
+	})
+}
+
+// checked1 is float1 for functions that reject part of their domain
+func checked1(f func(float64) (float64, error)) NativeFunc {
+	return func(args []Value) (Value, error) {
+		if !args[0].IsFloat() {
+			return Value{}, fmt.Errorf("expected float, got %s", args[0].String())
+		}
+		r, err := f(args[0].AsFloat())
+		if err != nil {
+			return Value{}, err
+		}
+		return NewFloat(r), nil
+	}
+}
+
+// float2 adapts a (float, float) -> float function to a NativeFunc
+func float2(f func(a, b float64) float64) NativeFunc {
+	return func(args []Value) (Value, error) {
+		if !args[0].IsFloat() || !args[1].IsFloat() {
+			return Value{}, fmt.Errorf("expected floats, got %s and %s", args[0].String(), args[1].String())
+		}
+		return NewFloat(f(args[0].AsFloat(), args[1].AsFloat())), nil
+	}
+}
+
+func floatArgs3(args []Value) (a, b, c float64, err error) {
+	for _, v := range args[:3] {
+		if !v.IsFloat() {
+			return 0, 0, 0, fmt.Errorf("expected float, got %s", v.String())
+		}
+	}
+	return args[0].AsFloat(), args[1].AsFloat(), args[2].AsFloat(), nil
+}
@@ -0,0 +1,542 @@
+package vm
+
+import (
+	"fmt"
+	"jedil/pkg/bytecode"
+	"maps"
+	"math"
+	"slices"
+)
+
+// Verify statically checks a program before it runs: every operand and
+// jump or call target must be valid, every path into an instruction must
+// agree on the stack depth, and operand types must be ones the instruction
+// accepts. Code that passes can still fail at runtime (a division by zero,
+// a native's domain error, a value whose type only the VM knows), but not
+// by reading or jumping outside what the program set up.
+//
+// Functions are checked one frame at a time. Their parameter counts come
+// from the function table, or for bytecode without one from the OP_PUSH
+// that precedes each OP_CALL, as the compiler emits it.
+func Verify(p *bytecode.Program) error {
+	v := &verifier{program: p, code: p.Code}
+
+	for i, inst := range p.Code {
+		if err := v.checkOperand(inst); err != nil {
+			return v.errorAt(nil, i, err)
+		}
+	}
+
+	routines, err := v.findRoutines()
+	if err != nil {
+		return err
+	}
+	v.routines = routines
+
+	for _, entry := range slices.Sorted(maps.Keys(routines)) {
+		if err := v.analyze(routines[entry]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// slotType is the verifier's view of a stack value. typeAny stands for a
+// value whose type depends on data, such as a function parameter or a
+// native's result.
+type slotType uint8
+
+const (
+	typeAny slotType = iota
+	typeFloat
+	typeBool
+	typeVec3
+	typeBatch
+)
+
+func (t slotType) String() string {
+	switch t {
+	case typeFloat:
+		return "float"
+	case typeBool:
+		return "bool"
+	case typeVec3:
+		return "vec3"
+	case typeBatch:
+		return "batch"
+	default:
+		return "any"
+	}
+}
+
+// routine is a separately verified body of code: top-level code, or a
+// function entered by OP_CALL or CallFunction.
+type routine struct {
+	name    string
+	entry   int
+	params  []slotType // initial frame contents
+	returns int
+	isFunc  bool
+}
+
+type verifier struct {
+	program  *bytecode.Program
+	code     []bytecode.Instruction
+	routines map[int]*routine
+}
+
+func (v *verifier) errorAt(r *routine, ip int, err error) error {
+	where := ""
+	if r != nil {
+		where = " in " + r.name
+	}
+	line := ""
+	if ip < len(v.program.Lines) && v.program.Lines[ip] != 0 {
+		line = fmt.Sprintf(", line %d", v.program.Lines[ip])
+	}
+	return fmt.Errorf("verify: instruction %d (%s)%s%s: %v", ip, v.code[ip].Op, where, line, err)
+}
+
+// checkOperand validates an instruction in isolation, whether or not it is
+// reachable.
+func (v *verifier) checkOperand(inst bytecode.Instruction) error {
+	if !inst.Op.Valid() {
+		return fmt.Errorf("unknown opcode %d", inst.Op)
+	}
+
+	switch inst.Op {
+	case bytecode.OP_BATCH_VSCALE:
+		return fmt.Errorf("opcode is not implemented by the VM")
+	case bytecode.OP_LOAD, bytecode.OP_STORE, bytecode.OP_RET:
+		_, err := count(inst.Args)
+		return err
+	case bytecode.OP_JMP, bytecode.OP_JMP_IF_FALSE:
+		target, err := count(inst.Args)
+		if err != nil {
+			return err
+		}
+		if target > len(v.code) {
+			return fmt.Errorf("jump target %d outside code (length %d)", target, len(v.code))
+		}
+	case bytecode.OP_CALL:
+		target, err := count(inst.Args)
+		if err != nil {
+			return err
+		}
+		if target >= len(v.code) {
+			return fmt.Errorf("call target %d outside code (length %d)", target, len(v.code))
+		}
+	case bytecode.OP_CALL_NATIVE:
+		index, err := count(inst.Args)
+		if err != nil {
+			return err
+		}
+		if _, ok := NativeAt(index); !ok {
+			return fmt.Errorf("no native function with index %d", index)
+		}
+	case bytecode.OP_LOAD_INPUT:
+		index, err := count(inst.Args)
+		if err != nil {
+			return err
+		}
+		if index >= len(v.program.Inputs) {
+			return fmt.Errorf("no input with index %d (program has %d)", index, len(v.program.Inputs))
+		}
+	}
+	return nil
+}
+
+func inputType(in bytecode.Input) slotType {
+	if in.Type == bytecode.INPUT_VEC3 {
+		return typeVec3
+	}
+	return typeFloat
+}
+
+// count converts an operand that must be a non-negative integer.
+func count(arg float64) (int, error) {
+	if arg < 0 || arg != math.Trunc(arg) || arg > math.MaxInt32 {
+		return 0, fmt.Errorf("operand %g is not a non-negative integer", arg)
+	}
+	return int(arg), nil
+}
+
+// findRoutines collects top-level code, the function table and every call
+// target, with their parameter and return counts.
+func (v *verifier) findRoutines() (map[int]*routine, error) {
+	routines := make(map[int]*routine)
+
+	if len(v.code) > 0 {
+		top := &routine{name: "top level", entry: 0}
+		for _, in := range v.program.Inputs {
+			top.params = append(top.params, inputType(in))
+		}
+		routines[0] = top
+	}
+
+	declared := make(map[int]bool)
+	for _, fn := range v.program.Functions {
+		if fn.Address < 0 || fn.Address >= len(v.code) {
+			return nil, fmt.Errorf("verify: function %s at address %d outside code (length %d)", fn.Name, fn.Address, len(v.code))
+		}
+		if fn.Address == 0 {
+			return nil, fmt.Errorf("verify: function %s starts at address 0, where top-level code begins", fn.Name)
+		}
+		if declared[fn.Address] {
+			return nil, fmt.Errorf("verify: function %s shares address %d with another function", fn.Name, fn.Address)
+		}
+		declared[fn.Address] = true
+		routines[fn.Address] = &routine{
+			name:    "function " + fn.Name,
+			entry:   fn.Address,
+			params:  make([]slotType, fn.Params),
+			returns: fn.Returns,
+			isFunc:  true,
+		}
+	}
+
+	for i, inst := range v.code {
+		if inst.Op != bytecode.OP_CALL {
+			continue
+		}
+		if i == 0 || v.code[i-1].Op != bytecode.OP_PUSH {
+			return nil, v.errorAt(nil, i, fmt.Errorf("parameter count must be pushed by the preceding OP_PUSH"))
+		}
+		params, err := count(v.code[i-1].Args)
+		if err != nil {
+			return nil, v.errorAt(nil, i-1, fmt.Errorf("parameter count: %v", err))
+		}
+
+		target := int(inst.Args)
+		if target == 0 {
+			return nil, v.errorAt(nil, i, fmt.Errorf("call into top-level code"))
+		}
+		r, ok := routines[target]
+		if !ok {
+			r = &routine{
+				name:    fmt.Sprintf("function at %d", target),
+				entry:   target,
+				params:  make([]slotType, params),
+				returns: -1, // taken from its OP_RETs below
+				isFunc:  true,
+			}
+			routines[target] = r
+		}
+		if len(r.params) != params {
+			return nil, v.errorAt(nil, i, fmt.Errorf("passes %d arguments to %s, which takes %d", params, r.name, len(r.params)))
+		}
+	}
+
+	for _, entry := range slices.Sorted(maps.Keys(routines)) {
+		if r := routines[entry]; r.isFunc {
+			if err := v.checkReturns(r); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return routines, nil
+}
+
+// checkReturns makes every OP_RET reachable from a function's entry return
+// the same number of values, and that number match the function table.
+func (v *verifier) checkReturns(r *routine) error {
+	seen := make(map[int]bool)
+	work := []int{r.entry}
+	for len(work) > 0 {
+		ip := work[len(work)-1]
+		work = work[:len(work)-1]
+		if ip >= len(v.code) || seen[ip] {
+			continue
+		}
+		seen[ip] = true
+
+		if inst := v.code[ip]; inst.Op == bytecode.OP_RET {
+			n := int(inst.Args)
+			if r.returns < 0 {
+				r.returns = n
+			} else if n != r.returns {
+				return v.errorAt(r, ip, fmt.Errorf("returns %d values, expected %d", n, r.returns))
+			}
+		}
+		work = append(work, v.successors(ip)...)
+	}
+
+	if r.returns < 0 {
+		r.returns = 0 // never returns
+	}
+	return nil
+}
+
+// successors lists where control can go after ip. len(code) means the
+// program ends by running off the end.
+func (v *verifier) successors(ip int) []int {
+	inst := v.code[ip]
+	switch inst.Op {
+	case bytecode.OP_JMP:
+		return []int{int(inst.Args)}
+	case bytecode.OP_JMP_IF_FALSE:
+		return []int{ip + 1, int(inst.Args)}
+	case bytecode.OP_RET, bytecode.OP_HALT:
+		return nil
+	default:
+		return []int{ip + 1}
+	}
+}
+
+// analyze propagates abstract stacks through a routine until they stop
+// changing. Stacks are frame-relative, so slot 0 is the first parameter.
+func (v *verifier) analyze(r *routine) error {
+	states := make(map[int][]slotType)
+	states[r.entry] = append([]slotType{}, r.params...)
+	work := []int{r.entry}
+
+	for len(work) > 0 {
+		ip := work[len(work)-1]
+		work = work[:len(work)-1]
+
+		stack, err := v.step(r, ip, append([]slotType{}, states[ip]...))
+		if err != nil {
+			return v.errorAt(r, ip, err)
+		}
+		if len(stack) > STACK_MAX {
+			return v.errorAt(r, ip, fmt.Errorf("stack depth %d exceeds the VM's %d slots", len(stack), STACK_MAX))
+		}
+
+		for _, next := range v.successors(ip) {
+			if next == len(v.code) {
+				if r.isFunc {
+					return v.errorAt(r, ip, fmt.Errorf("control runs off the end of the code without OP_RET"))
+				}
+				continue
+			}
+
+			prev, seen := states[next]
+			if !seen {
+				states[next] = append([]slotType{}, stack...)
+				work = append(work, next)
+				continue
+			}
+			if len(prev) != len(stack) {
+				return v.errorAt(r, ip, fmt.Errorf("stack depth %d here but %d on another path into instruction %d", len(stack), len(prev), next))
+			}
+
+			changed := false
+			for i := range prev {
+				if prev[i] != stack[i] && prev[i] != typeAny {
+					prev[i] = typeAny
+					changed = true
+				}
+			}
+			if changed {
+				work = append(work, next)
+			}
+		}
+	}
+	return nil
+}
+
+// step applies one instruction to an abstract stack.
+func (v *verifier) step(r *routine, ip int, stack []slotType) ([]slotType, error) {
+	inst := v.code[ip]
+
+	pop := func(n int) ([]slotType, error) {
+		if len(stack) < n {
+			return nil, fmt.Errorf("needs %d values, stack holds %d", n, len(stack))
+		}
+		popped := stack[len(stack)-n:]
+		stack = stack[:len(stack)-n]
+		return popped, nil
+	}
+	// pops one value for each entry of want, checking its type
+	operands := func(want ...slotType) error {
+		popped, err := pop(len(want))
+		if err != nil {
+			return err
+		}
+		for i, t := range popped {
+			if t != typeAny && t != want[i] {
+				return fmt.Errorf("operand %d is %s, expected %s", i+1, t, want[i])
+			}
+		}
+		return nil
+	}
+	push := func(ts ...slotType) ([]slotType, error) {
+		return append(stack, ts...), nil
+	}
+
+	switch inst.Op {
+	case bytecode.OP_PUSH:
+		return push(typeFloat)
+	case bytecode.OP_PUSH_BOOL:
+		return push(typeBool)
+	case bytecode.OP_POP:
+		if _, err := pop(1); err != nil {
+			return nil, err
+		}
+		return stack, nil
+
+	case bytecode.OP_LOAD:
+		slot := int(inst.Args)
+		if slot >= len(stack) {
+			return nil, fmt.Errorf("slot %d not set (frame holds %d values)", slot, len(stack))
+		}
+		return push(stack[slot])
+	case bytecode.OP_LOAD_INPUT:
+		return push(inputType(v.program.Inputs[int(inst.Args)]))
+	case bytecode.OP_STORE:
+		popped, err := pop(1)
+		if err != nil {
+			return nil, err
+		}
+		slot := int(inst.Args)
+		if slot >= len(stack) {
+			return nil, fmt.Errorf("slot %d not set (frame holds %d values)", slot, len(stack))
+		}
+		stack[slot] = popped[0]
+		return stack, nil
+
+	case bytecode.OP_ADD, bytecode.OP_SUB:
+		popped, err := pop(2)
+		if err != nil {
+			return nil, err
+		}
+		a, b := popped[0], popped[1]
+		result := a
+		if result == typeAny {
+			result = b
+		}
+		if (a != typeAny && b != typeAny && a != b) || (result != typeAny && result != typeFloat && result != typeVec3) {
+			return nil, fmt.Errorf("cannot combine %s and %s", a, b)
+		}
+		return push(result)
+	case bytecode.OP_MUL:
+		popped, err := pop(2)
+		if err != nil {
+			return nil, err
+		}
+		a, b := popped[0], popped[1]
+		for _, t := range popped {
+			if t != typeAny && t != typeFloat && t != typeVec3 {
+				return nil, fmt.Errorf("cannot multiply %s and %s", a, b)
+			}
+		}
+		switch {
+		case a == typeVec3 && b == typeVec3:
+			return nil, fmt.Errorf("cannot multiply vec3 and vec3 (use OP_VMUL for a dot product)")
+		case a == typeVec3 || b == typeVec3:
+			return push(typeVec3)
+		case a == typeFloat && b == typeFloat:
+			return push(typeFloat)
+		default:
+			return push(typeAny)
+		}
+	case bytecode.OP_DIV:
+		if err := operands(typeFloat, typeFloat); err != nil {
+			return nil, err
+		}
+		return push(typeFloat)
+
+	case bytecode.OP_VADD, bytecode.OP_VSUB, bytecode.OP_VCROSS:
+		if err := operands(typeVec3, typeVec3); err != nil {
+			return nil, err
+		}
+		return push(typeVec3)
+	case bytecode.OP_VMUL:
+		if err := operands(typeVec3, typeVec3); err != nil {
+			return nil, err
+		}
+		return push(typeFloat)
+	case bytecode.OP_VSCALE:
+		if err := operands(typeVec3, typeFloat); err != nil {
+			return nil, err
+		}
+		return push(typeVec3)
+	case bytecode.OP_VMAG:
+		if err := operands(typeVec3); err != nil {
+			return nil, err
+		}
+		return push(typeFloat)
+	case bytecode.OP_VEC3:
+		if err := operands(typeFloat, typeFloat, typeFloat); err != nil {
+			return nil, err
+		}
+		return push(typeVec3)
+
+	case bytecode.OP_BATCH_PACK:
+		if err := operands(typeVec3, typeVec3, typeVec3, typeVec3); err != nil {
+			return nil, err
+		}
+		return push(typeBatch)
+	case bytecode.OP_BATCH_VADD, bytecode.OP_BATCH_VSUB:
+		if err := operands(typeBatch, typeBatch); err != nil {
+			return nil, err
+		}
+		return push(typeBatch)
+	case bytecode.OP_BATCH_VMUL:
+		if err := operands(typeBatch, typeBatch); err != nil {
+			return nil, err
+		}
+		return push(typeFloat, typeFloat, typeFloat, typeFloat)
+
+	case bytecode.OP_EQ, bytecode.OP_NE:
+		popped, err := pop(2)
+		if err != nil {
+			return nil, err
+		}
+		a, b := popped[0], popped[1]
+		if (a != typeAny && b != typeAny && a != b) || a == typeBatch || b == typeBatch {
+			return nil, fmt.Errorf("cannot compare %s with %s", a, b)
+		}
+		return push(typeBool)
+	case bytecode.OP_LT, bytecode.OP_LE, bytecode.OP_GT, bytecode.OP_GE:
+		if err := operands(typeFloat, typeFloat); err != nil {
+			return nil, err
+		}
+		return push(typeBool)
+	case bytecode.OP_NOT:
+		if err := operands(typeBool); err != nil {
+			return nil, err
+		}
+		return push(typeBool)
+
+	case bytecode.OP_JMP:
+		return stack, nil
+	case bytecode.OP_JMP_IF_FALSE:
+		if err := operands(typeBool); err != nil {
+			return nil, err
+		}
+		return stack, nil
+
+	case bytecode.OP_CALL_NATIVE:
+		native, _ := NativeAt(int(inst.Args))
+		if _, err := pop(native.Arity); err != nil {
+			return nil, fmt.Errorf("%s: %v", native.Name, err)
+		}
+		return push(typeAny)
+	case bytecode.OP_CALL:
+		if err := operands(typeFloat); err != nil {
+			return nil, err
+		}
+		callee := v.routines[int(inst.Args)]
+		if _, err := pop(len(callee.params)); err != nil {
+			return nil, fmt.Errorf("%s: %v", callee.name, err)
+		}
+		for i := 0; i < callee.returns; i++ {
+			stack = append(stack, typeAny)
+		}
+		return stack, nil
+	case bytecode.OP_RET:
+		if !r.isFunc {
+			return nil, fmt.Errorf("return outside a function")
+		}
+		if _, err := pop(int(inst.Args)); err != nil {
+			return nil, err
+		}
+		return stack, nil
+
+	case bytecode.OP_HALT:
+		return stack, nil
+	}
+
+	return nil, fmt.Errorf("opcode not handled by the verifier")
+}
@@ -0,0 +1,120 @@
+package vm
+
+import (
+	"jedil/pkg/bytecode"
+	"strings"
+	"testing"
+)
+
+func TestVerifyAcceptsValidCode(t *testing.T) {
+	p := &bytecode.Program{
+		Code: []bytecode.Instruction{
+			{Op: bytecode.OP_JMP, Args: 5},
+			{Op: bytecode.OP_LOAD, Args: 0}, // 1: fn square(x)
+			{Op: bytecode.OP_LOAD, Args: 0},
+			{Op: bytecode.OP_MUL},
+			{Op: bytecode.OP_RET, Args: 1},
+			{Op: bytecode.OP_HALT}, // 5
+		},
+		Functions: []bytecode.Function{{Name: "square", Address: 1, Params: 1, Returns: 1}},
+	}
+	if err := Verify(p); err != nil {
+		t.Fatalf("expected valid program, got %v", err)
+	}
+
+	// the backward-jump countdown loop merges two paths at its head
+	loop := &bytecode.Program{Code: []bytecode.Instruction{
+		{Op: bytecode.OP_PUSH, Args: 3},
+		{Op: bytecode.OP_LOAD, Args: 0},
+		{Op: bytecode.OP_PUSH, Args: 0},
+		{Op: bytecode.OP_GT},
+		{Op: bytecode.OP_JMP_IF_FALSE, Args: 8},
+		{Op: bytecode.OP_PUSH, Args: 1},
+		{Op: bytecode.OP_SUB},
+		{Op: bytecode.OP_JMP, Args: 1},
+		{Op: bytecode.OP_HALT},
+	}}
+	if err := Verify(loop); err != nil {
+		t.Fatalf("expected valid loop, got %v", err)
+	}
+}
+
+func TestVerifyRejects(t *testing.T) {
+	push := func(v float64) bytecode.Instruction { return bytecode.Instruction{Op: bytecode.OP_PUSH, Args: v} }
+	op := func(o bytecode.OpCode, args ...float64) bytecode.Instruction {
+		inst := bytecode.Instruction{Op: o}
+		if len(args) > 0 {
+			inst.Args = args[0]
+		}
+		return inst
+	}
+
+	tests := []struct {
+		name string
+		code []bytecode.Instruction
+		want string
+	}{
+		{"unknown opcode", []bytecode.Instruction{op(200)}, "unknown opcode 200"},
+		{"jump target", []bytecode.Instruction{op(bytecode.OP_JMP, 7)}, "jump target 7 outside code"},
+		{"fractional slot", []bytecode.Instruction{push(1), op(bytecode.OP_LOAD, 0.5)}, "not a non-negative integer"},
+		{"native index", []bytecode.Instruction{op(bytecode.OP_CALL_NATIVE, 1e6)}, "no native function"},
+		{"input index", []bytecode.Instruction{op(bytecode.OP_LOAD_INPUT, 0)}, "no input with index 0"},
+		{"underflow", []bytecode.Instruction{push(1), op(bytecode.OP_ADD)}, "needs 2 values, stack holds 1"},
+		{"unset slot", []bytecode.Instruction{push(1), op(bytecode.OP_LOAD, 1)}, "slot 1 not set"},
+		{"type", []bytecode.Instruction{push(1), op(bytecode.OP_PUSH_BOOL, 1), op(bytecode.OP_ADD)}, "cannot combine float and bool"},
+		{"condition", []bytecode.Instruction{push(1), op(bytecode.OP_JMP_IF_FALSE, 2)}, "operand 1 is float, expected bool"},
+		{"vector op", []bytecode.Instruction{push(1), op(bytecode.OP_VMAG)}, "expected vec3"},
+		{"unbalanced branch", []bytecode.Instruction{
+			op(bytecode.OP_PUSH_BOOL, 1),
+			op(bytecode.OP_JMP_IF_FALSE, 3),
+			push(1), // only pushed on the fall-through path
+			op(bytecode.OP_HALT),
+		}, "on another path into instruction 3"},
+		{"return at top level", []bytecode.Instruction{push(1), op(bytecode.OP_RET, 1)}, "return outside a function"},
+		{"call without count", []bytecode.Instruction{op(bytecode.OP_CALL, 1), op(bytecode.OP_RET)}, "preceding OP_PUSH"},
+		{"call arity", []bytecode.Instruction{
+			push(0), op(bytecode.OP_CALL, 3), op(bytecode.OP_HALT),
+			op(bytecode.OP_LOAD, 0), op(bytecode.OP_RET, 1),
+		}, "slot 0 not set"},
+		{"function runs off end", []bytecode.Instruction{
+			push(0), op(bytecode.OP_CALL, 3), op(bytecode.OP_HALT),
+			push(1),
+		}, "runs off the end"},
+		{"unimplemented", []bytecode.Instruction{op(bytecode.OP_BATCH_VSCALE)}, "not implemented"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Verify(&bytecode.Program{Code: tt.code})
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("expected error containing %q, got %v", tt.want, err)
+			}
+		})
+	}
+}
+
+func TestVerifyFunctionTable(t *testing.T) {
+	p := &bytecode.Program{
+		Code: []bytecode.Instruction{
+			{Op: bytecode.OP_PUSH, Args: 1},
+			{Op: bytecode.OP_PUSH, Args: 1},
+			{Op: bytecode.OP_CALL, Args: 4},
+			{Op: bytecode.OP_HALT},
+			{Op: bytecode.OP_LOAD, Args: 1}, // 4: fn f(a, b)
+			{Op: bytecode.OP_RET, Args: 1},
+		},
+		Functions: []bytecode.Function{{Name: "f", Address: 4, Params: 2, Returns: 1}},
+	}
+	if err := Verify(p); err == nil || !strings.Contains(err.Error(), "passes 1 arguments to function f, which takes 2") {
+		t.Fatalf("expected arity mismatch, got %v", err)
+	}
+
+	p.Code[1].Args = 2
+	p.Code = append([]bytecode.Instruction{{Op: bytecode.OP_PUSH, Args: 1}}, p.Code...)
+	p.Code[3].Args = 5
+	p.Functions[0].Address = 5
+	p.Functions[0].Returns = 2
+	if err := Verify(p); err == nil || !strings.Contains(err.Error(), "returns 1 values, expected 2") {
+		t.Fatalf("expected return count mismatch, got %v", err)
+	}
+}
@@ -1,16 +1,40 @@
 package vm
 
 import (
+	"errors"
 	"fmt"
 	"jedil/pkg/bytecode"
+	"strings"
 )
 
+// DEFAULT_INSTRUCTION_BUDGET is the number of instructions a single Run may
+// execute before it is aborted, so a script stuck in a loop can't hang the host.
+const DEFAULT_INSTRUCTION_BUDGET = 10_000_000
+
+// ErrBudgetExceeded is returned (wrapped) by Run when the instruction budget
+// runs out.
+var ErrBudgetExceeded = errors.New("instruction budget exceeded")
+
+// errPaused is returned by execute when the debugger's pause hook stops it
+var errPaused = errors.New("paused")
+
 // VM represents the virtual machine.
 type VM struct {
 	stack *Stack                 // the VM stack
 	callStack *CallStack // function CallStack
 	code  []bytecode.Instruction // bytecode instructions to execute
 	ip    int                    // instruction pointer
+	budget int                   // max instructions per Run, 0 = unlimited
+
+	inputs      []bytecode.Input // declared host inputs, in slot order
+	inputValues []Value          // values bound to them, seeded on each fresh Run
+
+	functions []bytecode.Function // exported function table, for CallFunction
+
+	lines   []int // source line per instruction, for runtime errors; may be nil
+	columns []int // source column per instruction
+
+	pause func() bool // debugger hook, asked after each instruction whether to stop
 }
 
 // NewVM creates and initializes a new VM with the given bytecode.
@@ -20,12 +44,54 @@ func New(code []bytecode.Instruction) *VM {
 		callStack: NewCallStack(),
 		code:  code,
 		ip:    0,
+		budget: DEFAULT_INSTRUCTION_BUDGET,
 	}
 }
 
-// Run executes the VM.
+// SetInstructionBudget limits how many instructions a single Run may execute.
+// Zero or a negative value removes the limit.
+func (vm *VM) SetInstructionBudget(n int) {
+	vm.budget = max(n, 0)
+}
+
+// InstructionBudget returns the current per-Run instruction limit (0 = unlimited).
+func (vm *VM) InstructionBudget() int {
+	return vm.budget
+}
+
+// Run executes the program from the top with a fresh stack and the bound
+// inputs, so the same VM can be run repeatedly. Errors raised by
+// instructions are *RuntimeError.
 func (vm *VM) Run() error {
+	vm.Reset()
+	if err := vm.seedInputs(); err != nil {
+		return err
+	}
+	return vm.resume()
+}
+
+// resume executes from the current ip and stack, e.g. after CallFunction
+// has set up a frame.
+func (vm *VM) resume() error {
+	// ip of the instruction being executed, for error reporting
+	at := vm.ip
+	if err := vm.execute(&at); err != nil {
+		return vm.runtimeError(at, err)
+	}
+	return nil
+}
+
+// execute runs instructions from vm.ip until the program halts or fails,
+// keeping *at on the instruction being executed.
+func (vm *VM) execute(at *int) error {
+	executed := 0
 	for vm.ip < len(vm.code) {
+		*at = vm.ip
+		if vm.budget > 0 && executed >= vm.budget {
+			return fmt.Errorf("%w: stopped after %d instructions", ErrBudgetExceeded, executed)
+		}
+		executed++
+
 		// fetch current instruction
 		inst := vm.code[vm.ip]
 		vm.ip++
@@ -46,13 +112,7 @@ func (vm *VM) Run() error {
 			}
 		case bytecode.OP_LOAD:
 			// load variable from stack (Args is index)
-			offset := int(inst.Args)
-
-			// If we're inside a function, adjust offset relative to basePointer
-			if vm.callStack.top > 0 {
-				frame, _ := vm.callStack.Peek()
-				offset = frame.basePointer + offset
-			}
+			offset := vm.slot(inst.Args)
 
 			// get the value at the offset -- bounds check done in Get()
 			val, err := vm.stack.Get(offset)
@@ -65,6 +125,17 @@ func (vm *VM) Run() error {
 			if err != nil {
 				return fmt.Errorf("LOAD failed: %v", err)
 			}
+		case bytecode.OP_STORE:
+			// pop a value and write it to a variable slot (Args is index)
+			val, err := vm.stack.Pop()
+			if err != nil {
+				return fmt.Errorf("STORE failed: %v", err)
+			}
+
+			// bounds check done in Set()
+			if err := vm.stack.Set(vm.slot(inst.Args), val); err != nil {
+				return fmt.Errorf("STORE failed: %v", err)
+			}
 		case bytecode.OP_ADD:
 			// pop 2 values, add them, push result (polymorphic: float or vec3)
 			b, err := vm.stack.Pop()
@@ -241,6 +312,7 @@ func (vm *VM) Run() error {
 				returnAddress: vm.ip,        // next instruction after call
 				basePointer:   basePointer,  // where parameters begin
 				localCount:    paramCount,   // start with just params
+				function:      funcAddress,  // for stack traces
 			}
 
 			if err := vm.callStack.Push(frame); err != nil {
@@ -282,8 +354,57 @@ func (vm *VM) Run() error {
 			vm.ip = frame.returnAddress
 
 		case bytecode.OP_JMP:
-			// Unconditional jump to address in Args
-			vm.ip = int(inst.Args)
+			// Unconditional jump to address in Args (forward or backward)
+			if err := vm.jump(inst.Args); err != nil {
+				return fmt.Errorf("JMP failed: %v", err)
+			}
+
+		case bytecode.OP_JMP_IF_FALSE:
+			// Pop the condition and jump to address in Args if it is false
+			cond, err := vm.popBool()
+			if err != nil {
+				return fmt.Errorf("JMP_IF_FALSE failed: %v", err)
+			}
+			if !cond {
+				if err := vm.jump(inst.Args); err != nil {
+					return fmt.Errorf("JMP_IF_FALSE failed: %v", err)
+				}
+			}
+
+		case bytecode.OP_PUSH_BOOL:
+			if err := vm.stack.Push(NewBool(inst.Args != 0)); err != nil {
+				return fmt.Errorf("PUSH_BOOL failed: %v", err)
+			}
+		case bytecode.OP_EQ:
+			if err := vm.opEqual(false); err != nil {
+				return fmt.Errorf("EQ failed: %v", err)
+			}
+		case bytecode.OP_NE:
+			if err := vm.opEqual(true); err != nil {
+				return fmt.Errorf("NE failed: %v", err)
+			}
+		case bytecode.OP_LT, bytecode.OP_LE, bytecode.OP_GT, bytecode.OP_GE:
+			if err := vm.opCompare(inst.Op); err != nil {
+				return fmt.Errorf("%s failed: %v", strings.TrimPrefix(inst.Op.String(), "OP_"), err)
+			}
+		case bytecode.OP_NOT:
+			if err := vm.opNot(); err != nil {
+				return fmt.Errorf("NOT failed: %v", err)
+			}
+		case bytecode.OP_CALL_NATIVE:
+			if err := vm.opCallNative(int(inst.Args)); err != nil {
+				return fmt.Errorf("CALL_NATIVE failed: %v", err)
+			}
+		case bytecode.OP_LOAD_INPUT:
+			// read the bound value rather than its top-level slot, which a
+			// function's frame can't address and CallFunction never seeds
+			index := int(inst.Args)
+			if index < 0 || index >= len(vm.inputValues) {
+				return fmt.Errorf("LOAD_INPUT failed: input index %d out of range (program has %d inputs)", index, len(vm.inputValues))
+			}
+			if err := vm.stack.Push(vm.inputValues[index]); err != nil {
+				return fmt.Errorf("LOAD_INPUT failed: %v", err)
+			}
 
 		case bytecode.OP_HALT:
 			// Stop execution
@@ -292,8 +413,35 @@ func (vm *VM) Run() error {
 		default:
 			return fmt.Errorf("unknown opcode: %d", inst.Op)
 		}
+
+		if vm.pause != nil && vm.ip < len(vm.code) && vm.pause() {
+			return errPaused
+		}
+	}
+
+	return nil
+}
+
+// slot resolves a variable index to an absolute stack offset. Inside a
+// function the index is relative to the frame's basePointer; at top level it
+// is already absolute.
+func (vm *VM) slot(index float64) int {
+	offset := int(index)
+	if vm.callStack.top > 0 {
+		frame, _ := vm.callStack.Peek()
+		offset = frame.basePointer + offset
 	}
+	return offset
+}
 
+// jump moves the instruction pointer to target. Jumping to len(code) is
+// allowed and ends the program, as falling off the end does.
+func (vm *VM) jump(target float64) error {
+	address := int(target)
+	if address < 0 || address > len(vm.code) {
+		return fmt.Errorf("invalid jump target %d", address)
+	}
+	vm.ip = address
 	return nil
 }
 
@@ -304,6 +452,7 @@ func (vm *VM) GetResult() (Value, error) {
 
 func (vm *VM) Reset() {
 	vm.stack.Reset()
+	vm.callStack.top = 0
 	vm.ip = 0
 }
 
@@ -0,0 +1,200 @@
+package vm
+
+import (
+	"errors"
+	"fmt"
+	"jedil/pkg/bytecode"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestBackwardJumpLoop(t *testing.T) {
+	// counts down from 3 on the stack: 3 -> 2 -> 1 -> 0
+	code := []bytecode.Instruction{
+		{Op: bytecode.OP_PUSH, Args: 3},
+		{Op: bytecode.OP_LOAD, Args: 0}, // 1: loop
+		{Op: bytecode.OP_PUSH, Args: 0},
+		{Op: bytecode.OP_GT},
+		{Op: bytecode.OP_JMP_IF_FALSE, Args: 8},
+		{Op: bytecode.OP_PUSH, Args: 1},
+		{Op: bytecode.OP_SUB},
+		{Op: bytecode.OP_JMP, Args: 1},
+		{Op: bytecode.OP_HALT}, // 8
+	}
+
+	machine := New(code)
+	if err := machine.Run(); err != nil {
+		t.Fatalf("run failed: %v", err)
+	}
+	result, err := machine.GetResult()
+	if err != nil || !result.IsFloat() || result.AsFloat() != 0 {
+		t.Fatalf("expected 0, got %v (%v)", result, err)
+	}
+}
+
+func TestInstructionBudget(t *testing.T) {
+	spin := []bytecode.Instruction{
+		{Op: bytecode.OP_JMP, Args: 0},
+	}
+
+	machine := New(spin)
+	machine.SetInstructionBudget(500)
+	err := machine.Run()
+	if !errors.Is(err, ErrBudgetExceeded) {
+		t.Fatalf("expected ErrBudgetExceeded, got %v", err)
+	}
+
+	// the default budget also stops it
+	if err := New(spin).Run(); !errors.Is(err, ErrBudgetExceeded) {
+		t.Fatalf("expected default budget to stop the loop, got %v", err)
+	}
+}
+
+func TestInstructionBudgetIsPerRun(t *testing.T) {
+	code := []bytecode.Instruction{
+		{Op: bytecode.OP_PUSH, Args: 1},
+		{Op: bytecode.OP_POP},
+		{Op: bytecode.OP_HALT},
+	}
+
+	machine := New(code)
+	machine.SetInstructionBudget(3)
+	for i := 0; i < 3; i++ {
+		machine.Reset()
+		if err := machine.Run(); err != nil {
+			t.Fatalf("run %d failed: %v", i, err)
+		}
+	}
+}
+
+func TestRunRestartsFromTop(t *testing.T) {
+	code := []bytecode.Instruction{
+		{Op: bytecode.OP_PUSH, Args: 2},
+		{Op: bytecode.OP_PUSH, Args: 3},
+		{Op: bytecode.OP_MUL},
+		{Op: bytecode.OP_HALT},
+	}
+
+	machine := New(code)
+	for i := 0; i < 3; i++ {
+		if err := machine.Run(); err != nil {
+			t.Fatalf("run %d failed: %v", i, err)
+		}
+		if got := machine.Debug(); !strings.Contains(got, "Stack: [6.000000]") {
+			t.Fatalf("run %d: expected a single 6 on the stack, got %s", i, got)
+		}
+	}
+}
+
+func TestConcurrentRunsShareProgram(t *testing.T) {
+	// x * x, with x an input; one image, one VM per goroutine
+	program := &bytecode.Program{
+		Code: []bytecode.Instruction{
+			{Op: bytecode.OP_LOAD, Args: 0},
+			{Op: bytecode.OP_LOAD, Args: 0},
+			{Op: bytecode.OP_MUL},
+			{Op: bytecode.OP_HALT},
+		},
+		Inputs: []bytecode.Input{{Name: "x", Type: bytecode.INPUT_FLOAT}},
+	}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 8)
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func(x float64) {
+			defer wg.Done()
+			machine := NewFromProgram(program)
+			for i := 0; i < 100; i++ {
+				machine.SetInput("x", NewFloat(x))
+				if err := machine.Run(); err != nil {
+					errs <- err
+					return
+				}
+				if result, _ := machine.GetResult(); result.AsFloat() != x*x {
+					errs <- fmt.Errorf("x = %g: got %s", x, result.String())
+					return
+				}
+			}
+		}(float64(g))
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+}
+
+func TestInvalidJumpTarget(t *testing.T) {
+	code := []bytecode.Instruction{
+		{Op: bytecode.OP_JMP, Args: 42},
+	}
+	err := New(code).Run()
+	if err == nil || !strings.Contains(err.Error(), "invalid jump target") {
+		t.Fatalf("expected invalid jump target error, got %v", err)
+	}
+}
+
+func TestStoreRelativeToFrame(t *testing.T) {
+	// fn(x) { x = x * 10; return x } called with 4, with a top-level slot
+	// below the frame that must stay untouched
+	code := []bytecode.Instruction{
+		{Op: bytecode.OP_JMP, Args: 6},
+		{Op: bytecode.OP_LOAD, Args: 0}, // 1: fn
+		{Op: bytecode.OP_PUSH, Args: 10},
+		{Op: bytecode.OP_MUL},
+		{Op: bytecode.OP_STORE, Args: 0},
+		{Op: bytecode.OP_RET, Args: 0},
+		{Op: bytecode.OP_PUSH, Args: 7}, // 6: main, slot 0
+		{Op: bytecode.OP_PUSH, Args: 4},
+		{Op: bytecode.OP_PUSH, Args: 1}, // param count
+		{Op: bytecode.OP_CALL, Args: 1},
+		{Op: bytecode.OP_HALT},
+	}
+
+	machine := New(code)
+	if err := machine.Run(); err != nil {
+		t.Fatalf("run failed: %v", err)
+	}
+	if got := machine.Debug(); !strings.Contains(got, "Stack: [7.000000]") {
+		t.Fatalf("expected only the untouched top-level slot left, got %s", got)
+	}
+
+	// STORE at top level writes the absolute slot
+	code = []bytecode.Instruction{
+		{Op: bytecode.OP_PUSH, Args: 1},
+		{Op: bytecode.OP_PUSH, Args: 2},
+		{Op: bytecode.OP_PUSH, Args: 9},
+		{Op: bytecode.OP_STORE, Args: 0},
+		{Op: bytecode.OP_LOAD, Args: 0},
+		{Op: bytecode.OP_HALT},
+	}
+	machine = New(code)
+	if err := machine.Run(); err != nil {
+		t.Fatalf("run failed: %v", err)
+	}
+	if result, _ := machine.GetResult(); result.AsFloat() != 9 {
+		t.Fatalf("expected 9, got %s", result.String())
+	}
+}
+
+func TestRuntimeErrorWithoutSourceMap(t *testing.T) {
+	code := []bytecode.Instruction{
+		{Op: bytecode.OP_PUSH, Args: 1},
+		{Op: bytecode.OP_PUSH_BOOL, Args: 1},
+		{Op: bytecode.OP_DIV},
+	}
+
+	err := New(code).Run()
+	var rt *RuntimeError
+	if !errors.As(err, &rt) {
+		t.Fatalf("expected a RuntimeError, got %v", err)
+	}
+	if rt.IP != 2 || rt.Op != bytecode.OP_DIV || rt.Line != 0 || len(rt.Trace) != 1 {
+		t.Fatalf("unexpected error details: %+v", rt)
+	}
+	if !strings.HasPrefix(err.Error(), "IP 2 (OP_DIV): ") {
+		t.Fatalf("unexpected message: %v", err)
+	}
+}
@@ -16,7 +16,7 @@ func main() {
 	
 	// Check the AST
 	ret := program.Statements[0].(*compiler.ReturnStmt)
-	binop := ret.Value.(*compiler.BinaryOp)
+	binop := ret.Values[0].(*compiler.BinaryOp)
 	fmt.Printf("BinaryOp.Op type: %T, value: %v (%d)\n", binop.Op, binop.Op, binop.Op)
 	fmt.Printf("TOKEN_PLUS value: %d\n", compiler.TOKEN_PLUS)
 }
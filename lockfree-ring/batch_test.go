@@ -0,0 +1,181 @@
+package lockfreering
+
+import (
+	"runtime"
+	"sync"
+	"testing"
+)
+
+func TestRingBatchWraps(t *testing.T) {
+	r := NewRing[int](8)
+
+	// offset head/tail so the batches straddle the end of the buffer
+	for i := range 5 {
+		r.Push(i)
+	}
+	for range 5 {
+		r.Pop()
+	}
+
+	if n := r.PushBatch([]int{10, 11, 12, 13, 14, 15, 16, 17, 18, 19}); n != 8 {
+		t.Fatalf("expected 8 pushed into empty ring, got %d", n)
+	}
+	if n := r.PushBatch([]int{99}); n != 0 {
+		t.Fatalf("expected 0 pushed into full ring, got %d", n)
+	}
+
+	dst := make([]int, 3)
+	if n := r.PopBatch(dst); n != 3 || dst[0] != 10 || dst[2] != 12 {
+		t.Fatalf("unexpected first batch: %d %v", n, dst)
+	}
+
+	dst = make([]int, 16)
+	n := r.PopBatch(dst)
+	if n != 5 {
+		t.Fatalf("expected 5 remaining, got %d", n)
+	}
+	for i, v := range dst[:n] {
+		if v != 13+i {
+			t.Fatalf("expected %d at %d, got %d", 13+i, i, v)
+		}
+	}
+	if n := r.PopBatch(dst); n != 0 {
+		t.Fatalf("expected 0 popped from empty ring, got %d", n)
+	}
+}
+
+func TestRingClaimCommit(t *testing.T) {
+	r := NewRing[int](8)
+	for i := range 6 {
+		r.Push(i)
+	}
+	for range 6 {
+		r.Pop()
+	}
+
+	// tail sits at slot 6, so only two slots are contiguous before the wrap
+	slots := r.Claim(5)
+	if len(slots) != 2 {
+		t.Fatalf("expected 2 contiguous slots, got %d", len(slots))
+	}
+	slots[0], slots[1] = 100, 101
+
+	if _, ok := r.Pop(); ok {
+		t.Fatal("claimed slots must not be visible before Commit")
+	}
+	r.Commit(2)
+
+	slots = r.Claim(5)
+	if len(slots) != 5 {
+		t.Fatalf("expected 5 slots after wrap, got %d", len(slots))
+	}
+	for i := range slots {
+		slots[i] = 102 + i
+	}
+	r.Commit(3) // publish only part of the claim
+
+	dst := make([]int, 8)
+	n := r.PopBatch(dst)
+	if n != 5 {
+		t.Fatalf("expected 5 committed items, got %d", n)
+	}
+	for i, v := range dst[:n] {
+		if v != 100+i {
+			t.Fatalf("expected %d at %d, got %d", 100+i, i, v)
+		}
+	}
+}
+
+func TestRingClaimNonPositive(t *testing.T) {
+	r := NewRing[int](4)
+	for _, n := range []int{0, -1, -100} {
+		if slots := r.Claim(n); slots != nil {
+			t.Fatalf("Claim(%d): expected nil, got %d slots", n, len(slots))
+		}
+	}
+	r.Commit(0)
+
+	if !r.Push(7) {
+		t.Fatal("push failed after empty claims")
+	}
+	if v, ok := r.Pop(); !ok || v != 7 {
+		t.Fatalf("expected 7, got %d (%v)", v, ok)
+	}
+}
+
+func TestRingCommitOverClaimPanics(t *testing.T) {
+	r := NewRing[int](4)
+	r.Claim(2)
+
+	defer func() {
+		if recover() == nil {
+			t.Fatal("expected panic committing more than claimed")
+		}
+	}()
+	r.Commit(3)
+}
+
+func TestRingBatchSPSC(t *testing.T) {
+	const n = 100000
+	r := NewRing[int](64)
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		batch := make([]int, 7)
+		for sent := 0; sent < n; {
+			k := min(len(batch), n-sent)
+			for i := range k {
+				batch[i] = sent + i
+			}
+			pushed := r.PushBatch(batch[:k])
+			if pushed == 0 {
+				runtime.Gosched()
+			}
+			sent += pushed
+		}
+	}()
+
+	dst := make([]int, 13)
+	for next := 0; next < n; {
+		got := r.PopBatch(dst)
+		if got == 0 {
+			runtime.Gosched()
+		}
+		for _, v := range dst[:got] {
+			if v != next {
+				t.Fatalf("expected %d, got %d", next, v)
+			}
+			next++
+		}
+	}
+	wg.Wait()
+}
+
+func BenchmarkRingBatch32(b *testing.B) {
+	r := NewRing[int](1024)
+	src := make([]int, 32)
+	dst := make([]int, 32)
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i += len(src) {
+		r.PushBatch(src)
+		r.PopBatch(dst)
+	}
+}
+
+func BenchmarkRingClaimCommit32(b *testing.B) {
+	r := NewRing[int](1024)
+	dst := make([]int, 32)
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i += len(dst) {
+		slots := r.Claim(len(dst))
+		for j := range slots {
+			slots[j] = j
+		}
+		r.Commit(len(slots))
+		r.PopBatch(dst)
+	}
+}
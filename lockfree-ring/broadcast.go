@@ -0,0 +1,188 @@
+package lockfreering
+
+import (
+	"context"
+	"sync/atomic"
+)
+
+// Broadcast is a single-producer, multi-consumer ring in the style of the
+// LMAX Disruptor. Every consumer sees every item, reading it in place from
+// the shared slot at its own sequence. A consumer can be gated behind others
+// so it only reaches an item once they have all finished with it, and the
+// producer only reuses a slot once the slowest consumer has moved past it.
+//
+// Sequences work like Ring's head and tail: free-running counters masked
+// into the buffer. The cursor counts published items and each consumer's
+// sequence counts the items it has released.
+type Broadcast[T any] struct {
+	buffer []T
+	mask   uint64
+	_      [cacheLine - 32]byte // buffer header + mask
+
+	cursor     atomic.Uint64 // items published, written only by the producer
+	cachedGate uint64        // producer's last seen slowest consumer sequence
+	fullHits   atomic.Uint64
+	_          [cacheLine - 24]byte
+
+	consumers []*Consumer[T]
+
+	waitState
+}
+
+// Consumer is one reader of a Broadcast with its own sequence and the
+// barrier it waits behind. A Consumer must only be used from one goroutine.
+type Consumer[T any] struct {
+	seq        atomic.Uint64 // items this consumer has released
+	cachedGate uint64        // last seen barrier, refreshed only when it looks caught up
+	_          [cacheLine - 16]byte
+
+	ring *Broadcast[T]
+	deps []*Consumer[T]
+}
+
+// NewBroadcast returns a broadcast ring holding at least size items, rounded
+// up to the next power of two.
+func NewBroadcast[T any](size int) *Broadcast[T] {
+	capacity := nextPowerOfTwo(size)
+	return &Broadcast[T]{
+		buffer: make([]T, capacity),
+		mask:   uint64(capacity - 1),
+	}
+}
+
+// AddConsumer registers a consumer that only sees an item after every
+// consumer in deps has released it. With no deps it follows the producer
+// directly. All consumers must be added before the first Publish.
+func (b *Broadcast[T]) AddConsumer(deps ...*Consumer[T]) *Consumer[T] {
+	if b.cursor.Load() != 0 {
+		panic("lockfreering: consumer added after publishing started")
+	}
+	for _, d := range deps {
+		if d.ring != b {
+			panic("lockfreering: dependency belongs to a different ring")
+		}
+	}
+
+	c := &Consumer[T]{ring: b, deps: deps}
+	b.consumers = append(b.consumers, c)
+	return c
+}
+
+// Publish makes val visible to every consumer. It returns false if the
+// slowest consumer is a full lap behind.
+func (b *Broadcast[T]) Publish(val T) bool {
+	cursor := b.cursor.Load()
+
+	if cursor-b.cachedGate == uint64(len(b.buffer)) {
+		b.cachedGate = b.gate()
+		if cursor-b.cachedGate == uint64(len(b.buffer)) {
+			b.fullHits.Add(1)
+			return false
+		}
+	}
+
+	b.buffer[cursor&b.mask] = val
+	b.cursor.Store(cursor + 1)
+	b.notEmpty.wake()
+
+	return true
+}
+
+// PublishWait publishes val, waiting for the slowest consumer to free a slot
+// until ctx is done or the ring is closed.
+func (b *Broadcast[T]) PublishWait(ctx context.Context, val T) error {
+	if b.closed.Load() {
+		return ErrClosed
+	}
+
+	return b.await(ctx, &b.notFull,
+		func() bool { return b.Publish(val) },
+		func() bool { return b.cursor.Load()-b.gate() < uint64(len(b.buffer)) },
+		nil,
+	)
+}
+
+// gate returns the sequence of the slowest consumer, which bounds how far
+// the producer may run ahead.
+func (b *Broadcast[T]) gate() uint64 {
+	gate := b.cursor.Load()
+	for _, c := range b.consumers {
+		gate = min(gate, c.seq.Load())
+	}
+	return gate
+}
+
+// FullHits counts Publish calls rejected because the ring was full.
+func (b *Broadcast[T]) FullHits() uint64 {
+	return b.fullHits.Load()
+}
+
+// barrier returns how far this consumer may read: the producer's cursor, or
+// the slowest of its dependencies.
+func (c *Consumer[T]) barrier() uint64 {
+	if len(c.deps) == 0 {
+		return c.ring.cursor.Load()
+	}
+
+	barrier := c.deps[0].seq.Load()
+	for _, d := range c.deps[1:] {
+		barrier = min(barrier, d.seq.Load())
+	}
+	return barrier
+}
+
+// Poll hands every item currently available to handle, in order, then
+// releases them all with a single store. handle gets a pointer into the
+// shared slot so nothing is copied; it must not keep the pointer or write
+// through it, since other consumers read the same slot. Poll returns how many
+// items were handled.
+func (c *Consumer[T]) Poll(handle func(val *T)) int {
+	seq := c.seq.Load()
+
+	if seq == c.cachedGate {
+		c.cachedGate = c.barrier()
+		if seq == c.cachedGate {
+			return 0
+		}
+	}
+
+	b := c.ring
+	end := c.cachedGate
+	for s := seq; s < end; s++ {
+		handle(&b.buffer[s&b.mask])
+	}
+	c.seq.Store(end)
+
+	// wake both the producer and any consumers gated behind this one
+	b.notFull.wake()
+	b.notEmpty.wake()
+
+	return int(end - seq)
+}
+
+// PollWait is Poll, but waits until at least one item is available, ctx is
+// done, or the ring is closed and this consumer has seen everything that was
+// published.
+func (c *Consumer[T]) PollWait(ctx context.Context, handle func(val *T)) (int, error) {
+	var n int
+	err := c.ring.await(ctx, &c.ring.notEmpty,
+		func() bool {
+			n = c.Poll(handle)
+			return n > 0
+		},
+		func() bool { return c.barrier() > c.seq.Load() },
+		func() bool { return c.seq.Load() == c.ring.cursor.Load() },
+	)
+	return n, err
+}
+
+// Sequence returns how many items this consumer has released.
+func (c *Consumer[T]) Sequence() uint64 {
+	return c.seq.Load()
+}
+
+// Lag returns how many published items this consumer has yet to release.
+func (c *Consumer[T]) Lag() int {
+	seq := c.seq.Load()
+	return int(c.ring.cursor.Load() - seq)
+}
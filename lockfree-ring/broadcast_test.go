@@ -0,0 +1,205 @@
+package lockfreering
+
+import (
+	"context"
+	"errors"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+func TestBroadcastEveryConsumerSeesEverything(t *testing.T) {
+	const n = 20000
+	b := NewBroadcast[int](32)
+	ctx := context.Background()
+
+	consumers := []*Consumer[int]{b.AddConsumer(), b.AddConsumer(), b.AddConsumer()}
+
+	var wg sync.WaitGroup
+	for i, c := range consumers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			next := 0
+			for {
+				_, err := c.PollWait(ctx, func(val *int) {
+					if *val != next {
+						t.Errorf("consumer %d: expected %d, got %d", i, next, *val)
+					}
+					next++
+				})
+				if err != nil {
+					break
+				}
+			}
+			if next != n {
+				t.Errorf("consumer %d: saw %d items, want %d", i, next, n)
+			}
+		}()
+	}
+
+	for i := range n {
+		if err := b.PublishWait(ctx, i); err != nil {
+			t.Fatal(err)
+		}
+	}
+	b.Close()
+	wg.Wait()
+}
+
+func TestBroadcastDependencyBarrier(t *testing.T) {
+	const n = 20000
+	b := NewBroadcast[int](16)
+	ctx := context.Background()
+
+	decoder := b.AddConsumer()
+	archiver := b.AddConsumer()
+	estimator := b.AddConsumer(decoder, archiver)
+
+	// decoded[i] is set by the decoder before it releases item i, so the
+	// estimator must always find it set
+	decoded := make([]atomic.Bool, n)
+	archived := make([]atomic.Bool, n)
+
+	var wg sync.WaitGroup
+	run := func(c *Consumer[int], handle func(val *int)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				if _, err := c.PollWait(ctx, handle); err != nil {
+					return
+				}
+			}
+		}()
+	}
+
+	run(decoder, func(val *int) { decoded[*val].Store(true) })
+	run(archiver, func(val *int) { archived[*val].Store(true) })
+
+	seen := 0
+	run(estimator, func(val *int) {
+		if !decoded[*val].Load() || !archived[*val].Load() {
+			t.Errorf("estimator reached %d before its dependencies", *val)
+		}
+		seen++
+	})
+
+	for i := range n {
+		if err := b.PublishWait(ctx, i); err != nil {
+			t.Fatal(err)
+		}
+	}
+	b.Close()
+	wg.Wait()
+
+	if seen != n {
+		t.Fatalf("estimator saw %d items, want %d", seen, n)
+	}
+}
+
+func TestBroadcastProducerGatedBySlowestConsumer(t *testing.T) {
+	b := NewBroadcast[int](4)
+	fast := b.AddConsumer()
+	slow := b.AddConsumer()
+
+	for i := range 4 {
+		if !b.Publish(i) {
+			t.Fatalf("publish %d: expected success", i)
+		}
+	}
+
+	fast.Poll(func(*int) {})
+	if b.Publish(4) {
+		t.Fatal("expected Publish to fail while the slow consumer holds every slot")
+	}
+	if b.FullHits() != 1 {
+		t.Fatalf("expected 1 full hit, got %d", b.FullHits())
+	}
+	if slow.Lag() != 4 || fast.Lag() != 0 {
+		t.Fatalf("unexpected lag: slow %d, fast %d", slow.Lag(), fast.Lag())
+	}
+
+	if n := slow.Poll(func(*int) {}); n != 4 {
+		t.Fatalf("expected slow consumer to release 4, got %d", n)
+	}
+	if !b.Publish(4) {
+		t.Fatal("expected Publish to succeed after the slow consumer caught up")
+	}
+}
+
+func TestBroadcastCloseWaitsForUpstream(t *testing.T) {
+	b := NewBroadcast[int](8)
+	first := b.AddConsumer()
+	second := b.AddConsumer(first)
+
+	for i := range 3 {
+		b.Publish(i)
+	}
+	b.Close()
+
+	// second must not give up while first still has items to release
+	done := make(chan int)
+	go func() {
+		total := 0
+		for {
+			n, err := second.PollWait(context.Background(), func(*int) {})
+			total += n
+			if errors.Is(err, ErrClosed) {
+				done <- total
+				return
+			}
+		}
+	}()
+
+	for first.Lag() > 0 {
+		first.Poll(func(*int) {})
+		runtime.Gosched()
+	}
+
+	if total := <-done; total != 3 {
+		t.Fatalf("expected dependent consumer to drain 3 items, got %d", total)
+	}
+}
+
+func TestBroadcastAddConsumerAfterPublishPanics(t *testing.T) {
+	b := NewBroadcast[int](4)
+	b.AddConsumer()
+	b.Publish(1)
+
+	defer func() {
+		if recover() == nil {
+			t.Fatal("expected panic")
+		}
+	}()
+	b.AddConsumer()
+}
+
+func BenchmarkBroadcastThreeConsumers(b *testing.B) {
+	ring := NewBroadcast[int](1024)
+	ctx := context.Background()
+
+	consumers := []*Consumer[int]{ring.AddConsumer(), ring.AddConsumer()}
+	consumers = append(consumers, ring.AddConsumer(consumers...))
+
+	var wg sync.WaitGroup
+	for _, c := range consumers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				if _, err := c.PollWait(ctx, func(*int) {}); err != nil {
+					return
+				}
+			}
+		}()
+	}
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		ring.PublishWait(ctx, i)
+	}
+	ring.Close()
+	wg.Wait()
+}
@@ -1,42 +1,46 @@
 package main
 
 import (
-	"io"
+	"context"
+	"fmt"
 	lockfreering "lockfree-ring"
 	"sync"
 )
 
 func main() {
-	ring := lockfreering.NewRing(5)
+	ring := lockfreering.NewRing[int](8)
+	ctx := context.Background()
 
 	var wg sync.WaitGroup
 
 	wg.Add(1)
-	go func(r *lockfreering.Ring) {
+	go func(r *lockfreering.Ring[int]) {
 		defer wg.Done()
 		for i := range 10000 {
-			for !ring.Push(i) {
-				// buffer full so spin until consumer catches up
+			// parks if the consumer falls behind
+			if err := r.PushWait(ctx, i); err != nil {
+				return
 			}
 		}
+		r.Close()
 
 	}(ring)
 
 	wg.Add(1)
-	go func(r *lockfreering.Ring) {
+	go func(r *lockfreering.Ring[int]) {
 		defer wg.Done()
-		for i := 0; i < 10000; i++ {
-			for {
-				if val, ok := ring.Pop(); ok {
-					println(val.(int))
-					break
-				}
-				// buffer empty so spin until producer pushes something
+		for {
+			// returns ErrClosed once the producer is done and the ring drains
+			val, err := r.PopWait(ctx)
+			if err != nil {
+				return
 			}
+			println(val)
 		}
 
 	}(ring)
 	wg.Wait()
 
-	r := io.Reader()
+	stats := ring.Stats()
+	fmt.Printf("full hits: %d, empty hits: %d, high water: %d\n", stats.FullHits, stats.EmptyHits, stats.HighWater)
 }
@@ -0,0 +1,166 @@
+package lockfreering
+
+import (
+	"context"
+	"sync/atomic"
+)
+
+// MPMCRing is a bounded multi-producer, multi-consumer ring after Dmitry
+// Vyukov's design. Each slot carries a sequence number that says whose turn
+// it is: seq == pos means free for the producer claiming pos, seq == pos+1
+// means filled and ready for the consumer claiming pos. Producers and
+// consumers claim positions with a CAS on their own counter and then only
+// touch their claimed slot, so no two goroutines ever share a slot.
+type MPMCRing[T any] struct {
+	buffer []mpmcSlot[T]
+	mask   uint64
+	_      [cacheLine - 32]byte // buffer header + mask
+
+	enqueuePos atomic.Uint64
+	_          [cacheLine - 8]byte
+
+	dequeuePos atomic.Uint64
+	_          [cacheLine - 8]byte
+
+	fullHits  atomic.Uint64
+	emptyHits atomic.Uint64
+	highWater atomic.Uint64
+	_         [cacheLine - 24]byte
+
+	waitState
+}
+
+type mpmcSlot[T any] struct {
+	seq atomic.Uint64
+	val T
+}
+
+// NewMPMCRing returns a ring holding at least size items, rounded up to the
+// next power of two.
+func NewMPMCRing[T any](size int) *MPMCRing[T] {
+	capacity := nextPowerOfTwo(size)
+	r := &MPMCRing[T]{
+		buffer: make([]mpmcSlot[T], capacity),
+		mask:   uint64(capacity - 1),
+	}
+	for i := range r.buffer {
+		r.buffer[i].seq.Store(uint64(i))
+	}
+	return r
+}
+
+func (r *MPMCRing[T]) Push(val T) bool {
+	pos := r.enqueuePos.Load()
+
+	var slot *mpmcSlot[T]
+	for {
+		slot = &r.buffer[pos&r.mask]
+		diff := int64(slot.seq.Load() - pos)
+
+		if diff == 0 {
+			// slot is free for this lap; race other producers for it
+			if r.enqueuePos.CompareAndSwap(pos, pos+1) {
+				break
+			}
+			pos = r.enqueuePos.Load()
+		} else if diff < 0 {
+			// consumer hasn't released this slot from the previous lap
+			r.fullHits.Add(1)
+			return false
+		} else {
+			// another producer already took pos
+			pos = r.enqueuePos.Load()
+		}
+	}
+
+	slot.val = val
+	slot.seq.Store(pos + 1) // publish to the consumer that claims pos
+	if head := r.dequeuePos.Load(); head < pos+1 {
+		// consumers may already be past pos if later slots were published
+		raiseHighWater(&r.highWater, pos+1-head)
+	}
+	r.notEmpty.wake()
+
+	return true
+}
+
+func (r *MPMCRing[T]) Pop() (T, bool) {
+	pos := r.dequeuePos.Load()
+
+	var slot *mpmcSlot[T]
+	for {
+		slot = &r.buffer[pos&r.mask]
+		diff := int64(slot.seq.Load() - (pos + 1))
+
+		if diff == 0 {
+			if r.dequeuePos.CompareAndSwap(pos, pos+1) {
+				break
+			}
+			pos = r.dequeuePos.Load()
+		} else if diff < 0 {
+			// producer hasn't filled this slot yet
+			r.emptyHits.Add(1)
+			var zero T
+			return zero, false
+		} else {
+			pos = r.dequeuePos.Load()
+		}
+	}
+
+	val := slot.val
+	var zero T
+	slot.val = zero
+	slot.seq.Store(pos + r.mask + 1) // free the slot for the producer one lap ahead
+	r.notFull.wake()
+
+	return val, true
+}
+
+// PushWait pushes val, waiting for space until ctx is done or the ring is
+// closed.
+func (r *MPMCRing[T]) PushWait(ctx context.Context, val T) error {
+	if r.closed.Load() {
+		return ErrClosed
+	}
+
+	return r.await(ctx, &r.notFull,
+		func() bool { return r.Push(val) },
+		func() bool { return r.Len() < len(r.buffer) },
+		nil,
+	)
+}
+
+// PopWait pops the next item, waiting until one arrives, ctx is done, or the
+// ring is closed and empty.
+func (r *MPMCRing[T]) PopWait(ctx context.Context) (T, error) {
+	var val T
+	err := r.await(ctx, &r.notEmpty,
+		func() bool {
+			var ok bool
+			val, ok = r.Pop()
+			return ok
+		},
+		func() bool { return r.Len() > 0 },
+		func() bool { return r.Len() == 0 },
+	)
+	return val, err
+}
+
+func (r *MPMCRing[T]) Stats() Stats {
+	return Stats{
+		FullHits:  r.fullHits.Load(),
+		EmptyHits: r.emptyHits.Load(),
+		HighWater: int(r.highWater.Load()),
+	}
+}
+
+// Len returns an approximate item count; claimed but unpublished slots are
+// included.
+func (r *MPMCRing[T]) Len() int {
+	head := r.dequeuePos.Load() // consumers never claim past enqueuePos
+	return int(r.enqueuePos.Load() - head)
+}
+
+func (r *MPMCRing[T]) Cap() int {
+	return len(r.buffer)
+}
@@ -0,0 +1,164 @@
+package lockfreering
+
+import (
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+func TestMPMCFullAndEmpty(t *testing.T) {
+	r := NewMPMCRing[int](4)
+
+	if _, ok := r.Pop(); ok {
+		t.Fatal("expected Pop on empty ring to fail")
+	}
+	for i := range 4 {
+		if !r.Push(i) {
+			t.Fatalf("push %d: expected success", i)
+		}
+	}
+	if r.Push(99) {
+		t.Fatal("expected Push on full ring to fail")
+	}
+
+	// run a few laps so sequence numbers wrap past the first round
+	for i := 4; i < 20; i++ {
+		val, ok := r.Pop()
+		if !ok || val != i-4 {
+			t.Fatalf("pop: expected %d, got %d, %v", i-4, val, ok)
+		}
+		if !r.Push(i) {
+			t.Fatalf("push %d: expected success", i)
+		}
+	}
+}
+
+// TestMPMCStress runs many producers and consumers against a small ring and
+// checks every item comes out exactly once. Run with -race.
+func TestMPMCStress(t *testing.T) {
+	const (
+		producers   = 8
+		consumers   = 8
+		perProducer = 5000
+		total       = producers * perProducer
+	)
+	r := NewMPMCRing[int](64)
+
+	seen := make([]atomic.Int32, total)
+	var popped atomic.Int64
+
+	var wg sync.WaitGroup
+	for p := range producers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range perProducer {
+				for !r.Push(p*perProducer + i) {
+					runtime.Gosched()
+				}
+			}
+		}()
+	}
+
+	for range consumers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for popped.Load() < total {
+				val, ok := r.Pop()
+				if !ok {
+					runtime.Gosched()
+					continue
+				}
+				seen[val].Add(1)
+				popped.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+
+	for i := range seen {
+		if n := seen[i].Load(); n != 1 {
+			t.Fatalf("item %d seen %d times", i, n)
+		}
+	}
+	if r.Len() != 0 {
+		t.Fatalf("expected empty ring, Len = %d", r.Len())
+	}
+}
+
+// TestMPMCPerProducerOrder checks that items from a single producer are never
+// reordered relative to each other when one consumer drains the ring.
+func TestMPMCPerProducerOrder(t *testing.T) {
+	const (
+		producers   = 4
+		perProducer = 5000
+	)
+	r := NewMPMCRing[[2]int](32)
+
+	var wg sync.WaitGroup
+	for p := range producers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range perProducer {
+				for !r.Push([2]int{p, i}) {
+					runtime.Gosched()
+				}
+			}
+		}()
+	}
+
+	next := make([]int, producers)
+	for range producers * perProducer {
+		var item [2]int
+		var ok bool
+		for item, ok = r.Pop(); !ok; item, ok = r.Pop() {
+			runtime.Gosched()
+		}
+		if item[1] != next[item[0]] {
+			t.Fatalf("producer %d: expected %d, got %d", item[0], next[item[0]], item[1])
+		}
+		next[item[0]]++
+	}
+	wg.Wait()
+}
+
+func BenchmarkMPMCPushPop(b *testing.B) {
+	r := NewMPMCRing[int](1024)
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		r.Push(i)
+		r.Pop()
+	}
+}
+
+func BenchmarkMPMCParallel(b *testing.B) {
+	r := NewMPMCRing[int](1024)
+
+	b.ReportAllocs()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			for !r.Push(1) {
+				runtime.Gosched()
+			}
+			for _, ok := r.Pop(); !ok; _, ok = r.Pop() {
+				runtime.Gosched()
+			}
+		}
+	})
+}
+
+func BenchmarkChannelParallel(b *testing.B) {
+	ch := make(chan int, 1024)
+
+	b.ReportAllocs()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			ch <- 1
+			<-ch
+		}
+	})
+}
@@ -1,46 +1,252 @@
 package lockfreering
 
 import (
-	"log"
+	"context"
 	"sync/atomic"
 )
 
-type Ring struct {
-	buffer []any
-	head   atomic.Uint64 // pad to 64 bytes so we can have a separate cache line for head
-	_      [56]byte
-	tail   atomic.Uint64 // pad to 64 bytes so we can have a separate cache line for tail
-	_      [56]byte
-	size   int
+const cacheLine = 64
+
+// Ring is a single-producer, single-consumer ring buffer. Head and tail are
+// free-running counters; the slot index is the counter masked by capacity-1,
+// so capacity is always a power of two.
+type Ring[T any] struct {
+	buffer []T
+	mask   uint64
+	_      [cacheLine - 32]byte // buffer header + mask
+
+	head       atomic.Uint64 // next slot the consumer reads, written only by the consumer
+	cachedTail uint64        // consumer's last seen tail, refreshed only when the ring looks empty
+	emptyHits  atomic.Uint64
+	_          [cacheLine - 24]byte
+
+	tail       atomic.Uint64 // next slot the producer writes, written only by the producer
+	cachedHead uint64        // producer's last seen head, refreshed only when the ring looks full
+	claimed    int           // slots handed out by the last Claim, not yet committed
+	fullHits   atomic.Uint64
+	highWater  atomic.Uint64
+	_          [cacheLine - 40]byte
+
+	waitState
 }
 
-func NewRing(size int) *Ring {
-	return &Ring{
-		buffer: make([]any, size),
-		head:   atomic.Uint64{},
-		tail:   atomic.Uint64{},
-		size:   size,
+// NewRing returns a ring holding at least size items, rounded up to the next
+// power of two.
+func NewRing[T any](size int) *Ring[T] {
+	capacity := nextPowerOfTwo(size)
+	return &Ring[T]{
+		buffer: make([]T, capacity),
+		mask:   uint64(capacity - 1),
 	}
 }
 
-func (r *Ring) Push(val any) bool {
-	if (int(r.tail.Load())+1)%r.size == int(r.head.Load()) {
-		log.Print("full")
-		return false
+func (r *Ring[T]) Push(val T) bool {
+	tail := r.tail.Load()
+
+	if tail-r.cachedHead == uint64(len(r.buffer)) {
+		r.cachedHead = r.head.Load()
+		if tail-r.cachedHead == uint64(len(r.buffer)) {
+			r.fullHits.Add(1)
+			return false
+		}
 	}
 
-	r.buffer[r.tail.Load()] = val
-	r.tail.Store((r.tail.Load() + 1) % uint64(r.size))
+	r.buffer[tail&r.mask] = val
+	r.published(tail + 1)
 
 	return true
 }
 
-func (r *Ring) Pop() (any, bool) {
-	if r.head.Load() == r.tail.Load() {
-		log.Print("empty")
-		return nil, false
+func (r *Ring[T]) Pop() (T, bool) {
+	head := r.head.Load()
+
+	if head == r.cachedTail {
+		r.cachedTail = r.tail.Load()
+		if head == r.cachedTail {
+			r.emptyHits.Add(1)
+			var zero T
+			return zero, false
+		}
 	}
-	val := r.buffer[r.head.Load()]
-	r.head.Store((r.head.Load() + 1) % uint64(r.size))
+
+	idx := head & r.mask
+	val := r.buffer[idx]
+	var zero T
+	r.buffer[idx] = zero // don't keep the popped value reachable
+	r.head.Store(head + 1)
+	r.notFull.wake()
+
 	return val, true
 }
+
+// PushBatch pushes as many of vals as fit and returns how many were pushed.
+// The whole batch is published with a single store to tail.
+func (r *Ring[T]) PushBatch(vals []T) int {
+	if len(vals) == 0 {
+		return 0
+	}
+
+	tail := r.tail.Load()
+	free := r.free(tail, len(vals))
+	if free == 0 {
+		r.fullHits.Add(1)
+		return 0
+	}
+
+	n := min(len(vals), free)
+	start := int(tail & r.mask)
+	copied := copy(r.buffer[start:], vals[:n])
+	copy(r.buffer, vals[copied:n]) // wrapped remainder, if any
+	r.published(tail + uint64(n))
+
+	return n
+}
+
+// PopBatch pops up to len(dst) items into dst and returns how many were
+// popped. The whole batch is released with a single store to head.
+func (r *Ring[T]) PopBatch(dst []T) int {
+	if len(dst) == 0 {
+		return 0
+	}
+
+	head := r.head.Load()
+	if head+uint64(len(dst)) > r.cachedTail {
+		r.cachedTail = r.tail.Load()
+	}
+	if head == r.cachedTail {
+		r.emptyHits.Add(1)
+		return 0
+	}
+
+	n := min(len(dst), int(r.cachedTail-head))
+	start := int(head & r.mask)
+	end := min(start+n, len(r.buffer))
+	copied := copy(dst, r.buffer[start:end])
+	clear(r.buffer[start:end])
+	copy(dst[copied:n], r.buffer[:n-copied])
+	clear(r.buffer[:n-copied])
+	r.head.Store(head + uint64(n))
+	r.notFull.wake()
+
+	return n
+}
+
+// Claim hands the producer up to n free slots to write into directly. The
+// returned slice stops at the end of the buffer, so it can be shorter than n
+// even when more space is free; call Claim again after Commit for the rest.
+// Nothing is visible to the consumer until Commit. Claiming n <= 0 slots
+// returns nil.
+func (r *Ring[T]) Claim(n int) []T {
+	if n <= 0 {
+		r.claimed = 0
+		return nil
+	}
+
+	tail := r.tail.Load()
+	free := r.free(tail, n)
+
+	start := int(tail & r.mask)
+	n = min(n, free, len(r.buffer)-start)
+	r.claimed = n
+
+	return r.buffer[start : start+n : start+n]
+}
+
+// Commit publishes the first n slots of the last Claim to the consumer.
+func (r *Ring[T]) Commit(n int) {
+	if n < 0 || n > r.claimed {
+		panic("lockfreering: commit exceeds claimed slots")
+	}
+
+	r.claimed = 0
+	r.published(r.tail.Load() + uint64(n))
+}
+
+// published moves tail forward, then updates the high-water mark and wakes a
+// parked consumer. The true head is only loaded when the cached one says a
+// new high-water mark might have been reached, and that load also refreshes
+// the cache.
+func (r *Ring[T]) published(tail uint64) {
+	r.tail.Store(tail)
+
+	if tail-r.cachedHead > r.highWater.Load() {
+		r.cachedHead = r.head.Load()
+		if n := tail - r.cachedHead; n > r.highWater.Load() {
+			r.highWater.Store(n)
+		}
+	}
+
+	r.notEmpty.wake()
+}
+
+// free returns how many slots the producer can fill starting at tail,
+// refreshing the cached head only if fewer than want look free.
+func (r *Ring[T]) free(tail uint64, want int) int {
+	free := len(r.buffer) - int(tail-r.cachedHead)
+	if free < want {
+		r.cachedHead = r.head.Load()
+		free = len(r.buffer) - int(tail-r.cachedHead)
+	}
+	return free
+}
+
+// PushWait pushes val, waiting for space until ctx is done or the ring is
+// closed.
+func (r *Ring[T]) PushWait(ctx context.Context, val T) error {
+	if r.closed.Load() {
+		return ErrClosed
+	}
+
+	return r.await(ctx, &r.notFull,
+		func() bool { return r.Push(val) },
+		func() bool { return r.Len() < len(r.buffer) },
+		nil,
+	)
+}
+
+// PopWait pops the next item, waiting until one arrives, ctx is done, or the
+// ring is closed and empty.
+func (r *Ring[T]) PopWait(ctx context.Context) (T, error) {
+	var val T
+	err := r.await(ctx, &r.notEmpty,
+		func() bool {
+			var ok bool
+			val, ok = r.Pop()
+			return ok
+		},
+		func() bool { return r.Len() > 0 },
+		func() bool { return r.Len() == 0 },
+	)
+	return val, err
+}
+
+func (r *Ring[T]) Stats() Stats {
+	return Stats{
+		FullHits:  r.fullHits.Load(),
+		EmptyHits: r.emptyHits.Load(),
+		HighWater: int(r.highWater.Load()),
+	}
+}
+
+// Len returns the number of items currently buffered. It is only a snapshot
+// when called concurrently with Push or Pop.
+func (r *Ring[T]) Len() int {
+	head := r.head.Load() // load head first so tail can never appear behind it
+	return int(r.tail.Load() - head)
+}
+
+func (r *Ring[T]) Cap() int {
+	return len(r.buffer)
+}
+
+func nextPowerOfTwo(n int) int {
+	if n < 1 {
+		return 1
+	}
+
+	p := 1
+	for p < n {
+		p <<= 1
+	}
+	return p
+}
@@ -0,0 +1,132 @@
+package lockfreering
+
+import (
+	"runtime"
+	"sync"
+	"testing"
+)
+
+func TestRingCapacityRoundsUp(t *testing.T) {
+	for _, tc := range []struct{ size, want int }{{0, 1}, {1, 1}, {5, 8}, {8, 8}, {1000, 1024}} {
+		if got := NewRing[int](tc.size).Cap(); got != tc.want {
+			t.Errorf("NewRing(%d).Cap() = %d, want %d", tc.size, got, tc.want)
+		}
+	}
+}
+
+func TestRingFullAndEmpty(t *testing.T) {
+	r := NewRing[int](4)
+
+	if _, ok := r.Pop(); ok {
+		t.Fatal("expected Pop on empty ring to fail")
+	}
+
+	for i := range 4 {
+		if !r.Push(i) {
+			t.Fatalf("push %d: expected success", i)
+		}
+	}
+	if r.Push(99) {
+		t.Fatal("expected Push on full ring to fail")
+	}
+	if r.Len() != 4 {
+		t.Fatalf("expected Len 4, got %d", r.Len())
+	}
+
+	for i := range 4 {
+		val, ok := r.Pop()
+		if !ok || val != i {
+			t.Fatalf("pop %d: got %d, %v", i, val, ok)
+		}
+	}
+}
+
+func TestRingSPSCOrder(t *testing.T) {
+	const n = 100000
+	r := NewRing[int](16)
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := range n {
+			for !r.Push(i) {
+				runtime.Gosched()
+			}
+		}
+	}()
+
+	for i := range n {
+		var val int
+		var ok bool
+		for val, ok = r.Pop(); !ok; val, ok = r.Pop() {
+			runtime.Gosched()
+		}
+		if val != i {
+			t.Fatalf("expected %d, got %d", i, val)
+		}
+	}
+	wg.Wait()
+}
+
+func BenchmarkRingPushPop(b *testing.B) {
+	r := NewRing[int](1024)
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		r.Push(i)
+		r.Pop()
+	}
+}
+
+func BenchmarkChannelPushPop(b *testing.B) {
+	ch := make(chan int, 1024)
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		ch <- i
+		<-ch
+	}
+}
+
+func BenchmarkRingSPSC(b *testing.B) {
+	r := NewRing[int](1024)
+
+	b.ReportAllocs()
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < b.N; i++ {
+			for !r.Push(i) {
+				runtime.Gosched()
+			}
+		}
+	}()
+
+	for i := 0; i < b.N; i++ {
+		for _, ok := r.Pop(); !ok; _, ok = r.Pop() {
+			runtime.Gosched()
+		}
+	}
+	wg.Wait()
+}
+
+func BenchmarkChannelSPSC(b *testing.B) {
+	ch := make(chan int, 1024)
+
+	b.ReportAllocs()
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < b.N; i++ {
+			ch <- i
+		}
+	}()
+
+	for i := 0; i < b.N; i++ {
+		<-ch
+	}
+	wg.Wait()
+}
@@ -0,0 +1,141 @@
+package lockfreering
+
+import (
+	"context"
+	"errors"
+	"runtime"
+	"sync"
+	"sync/atomic"
+)
+
+// ErrClosed is returned by PushWait once the ring is closed, and by PopWait
+// once the ring is closed and drained.
+var ErrClosed = errors.New("lockfreering: ring closed")
+
+// Stats are the ring's full/empty counters, replacing per-hit logging.
+type Stats struct {
+	FullHits  uint64 // Push attempts rejected because the ring was full
+	EmptyHits uint64 // Pop attempts rejected because the ring was empty
+	HighWater int    // most items ever observed buffered at once
+}
+
+const (
+	maxSpin     = 256 // upper bound on the adaptive spin budget
+	initialSpin = 32
+)
+
+// parker lets a waiter sleep until the other side makes progress. The fast
+// path only pays an atomic load: wake does nothing unless someone is parked.
+type parker struct {
+	waiters atomic.Int32
+	mu      sync.Mutex
+	ch      chan struct{} // closed and replaced on every wake
+}
+
+// park blocks until wake is called or ctx is done. ready is re-checked after
+// registering as a waiter so a wake racing with registration isn't lost.
+func (p *parker) park(ctx context.Context, ready func() bool) error {
+	p.mu.Lock()
+	if p.ch == nil {
+		p.ch = make(chan struct{})
+	}
+	ch := p.ch
+	p.waiters.Add(1)
+	p.mu.Unlock()
+	defer p.waiters.Add(-1)
+
+	if ready() {
+		return nil
+	}
+
+	select {
+	case <-ch:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (p *parker) wake() {
+	if p.waiters.Load() == 0 {
+		return
+	}
+
+	p.mu.Lock()
+	if p.ch != nil {
+		close(p.ch)
+		p.ch = nil
+	}
+	p.mu.Unlock()
+}
+
+// waitState is shared by the ring variants to implement the blocking calls.
+type waitState struct {
+	closed   atomic.Bool
+	notEmpty parker
+	notFull  parker
+	spin     atomic.Int32 // adaptive spin budget, learned from recent waits
+}
+
+// await retries attempt, spinning for a while before parking on p until
+// ready reports the other side has made progress. The spin budget grows when
+// waits are satisfied by spinning and shrinks when they end up parking. Once
+// the ring is closed, await gives up with ErrClosed as soon as finished
+// reports there is nothing left to wait for; a nil finished gives up at once.
+func (w *waitState) await(ctx context.Context, p *parker, attempt, ready, finished func() bool) error {
+	budget := int(w.spin.Load())
+	if budget == 0 {
+		budget = initialSpin
+	}
+	done := func() bool { return w.closed.Load() && (finished == nil || finished()) }
+
+	for spins := 0; ; spins++ {
+		if attempt() {
+			if spins > 0 && spins <= budget {
+				w.spin.Store(int32(min(maxSpin, max(budget, 2*spins)+1)))
+			}
+			return nil
+		}
+		if done() {
+			return ErrClosed
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		if spins < budget {
+			runtime.Gosched()
+			continue
+		}
+
+		if spins == budget {
+			w.spin.Store(int32(max(1, budget/2)))
+		}
+		if err := p.park(ctx, func() bool { return ready() || done() }); err != nil {
+			return err
+		}
+	}
+}
+
+// Close marks the ring closed and wakes every parked waiter. PushWait fails
+// from then on; PopWait drains what's left and then fails. Plain Push and
+// Pop are unaffected.
+func (w *waitState) Close() {
+	w.closed.Store(true)
+	w.notEmpty.wake()
+	w.notFull.wake()
+}
+
+func (w *waitState) Closed() bool {
+	return w.closed.Load()
+}
+
+// raiseHighWater lifts hw to n if n is larger.
+func raiseHighWater(hw *atomic.Uint64, n uint64) {
+	for {
+		cur := hw.Load()
+		if n <= cur || hw.CompareAndSwap(cur, n) {
+			return
+		}
+	}
+}
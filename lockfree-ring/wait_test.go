@@ -0,0 +1,182 @@
+package lockfreering
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestRingPopWaitBlocksUntilPush(t *testing.T) {
+	r := NewRing[int](4)
+
+	got := make(chan int)
+	go func() {
+		val, err := r.PopWait(context.Background())
+		if err != nil {
+			t.Error(err)
+		}
+		got <- val
+	}()
+
+	time.Sleep(10 * time.Millisecond)
+	r.Push(42)
+
+	select {
+	case val := <-got:
+		if val != 42 {
+			t.Fatalf("expected 42, got %d", val)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("PopWait was not woken by Push")
+	}
+}
+
+func TestRingPushWaitBlocksUntilPop(t *testing.T) {
+	r := NewRing[int](2)
+	r.Push(1)
+	r.Push(2)
+
+	done := make(chan error)
+	go func() { done <- r.PushWait(context.Background(), 3) }()
+
+	time.Sleep(10 * time.Millisecond)
+	r.Pop()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("PushWait was not woken by Pop")
+	}
+}
+
+func TestRingWaitContextCancel(t *testing.T) {
+	r := NewRing[int](2)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	if _, err := r.PopWait(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected deadline exceeded, got %v", err)
+	}
+}
+
+func TestRingCloseWakesAndDrains(t *testing.T) {
+	r := NewRing[int](4)
+
+	var wg sync.WaitGroup
+	var got []int
+	var popErr error
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for {
+			val, err := r.PopWait(context.Background())
+			if err != nil {
+				popErr = err
+				return
+			}
+			got = append(got, val)
+		}
+	}()
+
+	time.Sleep(10 * time.Millisecond)
+	r.Push(1)
+	r.Push(2)
+	r.Close()
+	wg.Wait()
+
+	if !errors.Is(popErr, ErrClosed) {
+		t.Fatalf("expected ErrClosed, got %v", popErr)
+	}
+	if len(got) != 2 {
+		t.Fatalf("expected both items drained before close, got %v", got)
+	}
+	if err := r.PushWait(context.Background(), 3); !errors.Is(err, ErrClosed) {
+		t.Fatalf("expected ErrClosed from PushWait, got %v", err)
+	}
+}
+
+func TestRingStats(t *testing.T) {
+	r := NewRing[int](4)
+
+	r.Pop()
+	for i := range 3 {
+		r.Push(i)
+	}
+	r.Pop()
+	r.Pop()
+	r.Push(3)
+	r.Push(4)
+	r.Push(5)
+	r.Push(6) // full
+
+	stats := r.Stats()
+	if stats.EmptyHits != 1 || stats.FullHits != 1 {
+		t.Fatalf("expected 1 empty and 1 full hit, got %+v", stats)
+	}
+	if stats.HighWater != 4 {
+		t.Fatalf("expected high water 4, got %d", stats.HighWater)
+	}
+}
+
+func TestMPMCWaitStress(t *testing.T) {
+	const (
+		producers   = 4
+		consumers   = 4
+		perProducer = 2000
+		total       = producers * perProducer
+	)
+	r := NewMPMCRing[int](16)
+	ctx := context.Background()
+
+	var pwg sync.WaitGroup
+	for p := range producers {
+		pwg.Add(1)
+		go func() {
+			defer pwg.Done()
+			for i := range perProducer {
+				if err := r.PushWait(ctx, p*perProducer+i); err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}()
+	}
+
+	seen := make([]int, total)
+	var mu sync.Mutex
+	var cwg sync.WaitGroup
+	for range consumers {
+		cwg.Add(1)
+		go func() {
+			defer cwg.Done()
+			for {
+				val, err := r.PopWait(ctx)
+				if err != nil {
+					return
+				}
+				mu.Lock()
+				seen[val]++
+				mu.Unlock()
+			}
+		}()
+	}
+
+	pwg.Wait()
+	r.Close()
+	cwg.Wait()
+
+	for i, n := range seen {
+		if n != 1 {
+			t.Fatalf("item %d seen %d times", i, n)
+		}
+	}
+	if hw := r.Stats().HighWater; hw < 1 || hw > r.Cap() {
+		t.Fatalf("high water %d outside [1, %d]", hw, r.Cap())
+	}
+}
@@ -1,78 +1,130 @@
 package minheap
 
-type MinHeap struct {
-	data []int
+// Heap is a binary min-heap ordered by Less. When OnMove is set it is called
+// with an element's new position every time one moves, and with -1 when one
+// leaves the heap, so callers can track positions and Remove by index.
+type Heap[T any] struct {
+	data   []T
+	Less   func(a, b T) bool
+	OnMove func(v T, idx int)
 }
 
-func (h *MinHeap) Push(val int) {
+func (h *Heap[T]) Push(val T) {
 	h.data = append(h.data, val)
+	h.moved(len(h.data) - 1)
 	h.bubbleUp(len(h.data) - 1)
 }
 
-func (h *MinHeap) Pop() (int, bool) {
+func (h *Heap[T]) Pop() (T, bool) {
 	if len(h.data) == 0 {
-		return 0, false
+		var zero T
+		return zero, false
 	}
 
-	// grab min value first
-	min := h.data[0]
-
-	// move last to root
-	h.data[0] = h.data[len(h.data)-1]
-	h.data = h.data[:len(h.data)-1]
+	return h.Remove(0), true
+}
 
-	// bubble down if there's still data
-	if len(h.data) > 0 {
-		h.bubbleDown(0)
+func (h *Heap[T]) Peek() (T, bool) {
+	if len(h.data) == 0 {
+		var zero T
+		return zero, false
 	}
 
-	return min, true
+	return h.data[0], true
 }
 
-func (h *MinHeap) Peek() (int, bool) {
-	if len(h.data) == 0 {
-		return 0, false
+func (h *Heap[T]) Len() int {
+	return len(h.data)
+}
+
+// Remove takes out the element at idx and returns it.
+func (h *Heap[T]) Remove(idx int) T {
+	last := len(h.data) - 1
+	removed := h.data[idx]
+
+	// move last into the hole
+	h.swap(idx, last)
+	var zero T
+	h.data[last] = zero
+	h.data = h.data[:last]
+	if h.OnMove != nil {
+		h.OnMove(removed, -1)
 	}
 
-	return h.data[0], true
+	// the element moved into idx may need to go either way
+	if idx < len(h.data) {
+		h.bubbleDown(idx)
+		h.bubbleUp(idx)
+	}
+
+	return removed
 }
 
-func (h *MinHeap) bubbleUp(idx int) {
+func (h *Heap[T]) bubbleUp(idx int) {
 	if idx == 0 {
 		return
 	}
 
-	// val 0
-	if h.data[idx] < h.data[h.parent(idx)] {
-		// swap
-		h.data[idx], h.data[h.parent(idx)] = h.data[h.parent(idx)], h.data[idx]
+	if h.Less(h.data[idx], h.data[h.parent(idx)]) {
+		h.swap(idx, h.parent(idx))
 		h.bubbleUp(h.parent(idx))
 	}
 }
 
-func (h *MinHeap) bubbleDown(idx int) {
+func (h *Heap[T]) bubbleDown(idx int) {
 	left := h.leftChild(idx)
 	right := h.rightChild(idx)
 	smallest := idx
 
 	// check left
-	if left < len(h.data) && h.data[left] < h.data[smallest] {
+	if left < len(h.data) && h.Less(h.data[left], h.data[smallest]) {
 		smallest = left
 	}
 
 	// check right
-	if right < len(h.data) && h.data[right] < h.data[smallest] {
+	if right < len(h.data) && h.Less(h.data[right], h.data[smallest]) {
 		smallest = right
 	}
 
 	// if child is smaller, swap and continue
 	if smallest != idx {
-		h.data[idx], h.data[smallest] = h.data[smallest], h.data[idx]
+		h.swap(idx, smallest)
 		h.bubbleDown(smallest)
 	}
+}
 
+func (h *Heap[T]) swap(i, j int) {
+	h.data[i], h.data[j] = h.data[j], h.data[i]
+	h.moved(i)
+	h.moved(j)
 }
 
-func (h *MinHeap) parent(idx int) int     { return (idx - 1) / 2 }
-func (h *MinHeap) leftChild(idx int) int  { return 2*idx + 1 }
-func (h *MinHeap) rightChild(idx int) int { return 2*idx + 2 }
+func (h *Heap[T]) moved(idx int) {
+	if h.OnMove != nil {
+		h.OnMove(h.data[idx], idx)
+	}
+}
+
+func (h *Heap[T]) parent(idx int) int     { return (idx - 1) / 2 }
+func (h *Heap[T]) leftChild(idx int) int  { return 2*idx + 1 }
+func (h *Heap[T]) rightChild(idx int) int { return 2*idx + 2 }
+
+// MinHeap is a heap of ints, ready to use as its zero value.
+type MinHeap struct {
+	heap Heap[int]
+}
+
+func (h *MinHeap) Push(val int) {
+	if h.heap.Less == nil {
+		h.heap.Less = func(a, b int) bool { return a < b }
+	}
+	h.heap.Push(val)
+}
+
+func (h *MinHeap) Pop() (int, bool) {
+	return h.heap.Pop()
+}
+
+func (h *MinHeap) Peek() (int, bool) {
+	return h.heap.Peek()
+}
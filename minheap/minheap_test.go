@@ -0,0 +1,54 @@
+package minheap
+
+import "testing"
+
+func TestMinHeapOrder(t *testing.T) {
+	var h MinHeap
+	for _, v := range []int{5, 3, 8, 1, 9, 1} {
+		h.Push(v)
+	}
+
+	want := []int{1, 1, 3, 5, 8, 9}
+	for _, w := range want {
+		if v, ok := h.Pop(); !ok || v != w {
+			t.Fatalf("expected %d, got %d (%v)", w, v, ok)
+		}
+	}
+	if _, ok := h.Pop(); ok {
+		t.Fatal("expected empty heap")
+	}
+}
+
+func TestHeapTracksIndices(t *testing.T) {
+	type item struct{ val, idx int }
+	h := Heap[*item]{
+		Less:   func(a, b *item) bool { return a.val < b.val },
+		OnMove: func(it *item, idx int) { it.idx = idx },
+	}
+
+	items := make([]*item, 10)
+	for i := range items {
+		items[i] = &item{val: (i * 7) % 10}
+		h.Push(items[i])
+	}
+	for _, it := range items {
+		if h.data[it.idx] != it {
+			t.Fatalf("item %d has stale index %d", it.val, it.idx)
+		}
+	}
+
+	// remove from the middle by tracked index
+	removed := h.Remove(items[4].idx)
+	if removed != items[4] || removed.idx != -1 {
+		t.Fatalf("removed wrong item %+v", removed)
+	}
+
+	prev := -1
+	for h.Len() > 0 {
+		it, _ := h.Pop()
+		if it.val < prev || it == items[4] {
+			t.Fatalf("bad pop order: %d after %d", it.val, prev)
+		}
+		prev = it.val
+	}
+}
@@ -0,0 +1,225 @@
+package minheap
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Clock is the time source a Scheduler reads deadlines against.
+type Clock interface {
+	Now() time.Time
+}
+
+// WallClock reads the real system time.
+type WallClock struct{}
+
+func (WallClock) Now() time.Time { return time.Now() }
+
+// SimClock is a manually advanced clock for deterministic tick-driven tests.
+type SimClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func NewSimClock(start time.Time) *SimClock {
+	return &SimClock{now: start}
+}
+
+func (c *SimClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *SimClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	c.now = c.now.Add(d)
+	c.mu.Unlock()
+}
+
+func (c *SimClock) Set(t time.Time) {
+	c.mu.Lock()
+	c.now = t
+	c.mu.Unlock()
+}
+
+// Timer is the cancellation token returned when a callback is scheduled.
+type Timer struct {
+	deadline  time.Time
+	interval  time.Duration // zero for one-shot timers
+	seq       uint64        // insertion order, breaks ties between equal deadlines
+	index     int           // position in the heap, -1 when not queued
+	cancelled bool
+	fn        func(at time.Time)
+	s         *Scheduler
+}
+
+// Cancel stops the timer from firing again. It reports whether the timer was
+// still pending. Cancelling a periodic timer from inside its own callback
+// prevents it from being re-armed.
+func (t *Timer) Cancel() bool {
+	t.s.mu.Lock()
+	defer t.s.mu.Unlock()
+
+	if t.cancelled {
+		return false
+	}
+	t.cancelled = true
+
+	if t.index < 0 {
+		// currently firing; only a periodic timer had anything left to stop
+		return t.interval > 0
+	}
+	t.s.timers.Remove(t.index)
+	return true
+}
+
+// Scheduler runs callbacks at their deadlines, ordered by a min-heap.
+type Scheduler struct {
+	mu     sync.Mutex
+	clock  Clock
+	timers Heap[*Timer]
+	seq    uint64
+	wake   chan struct{}
+}
+
+func NewScheduler(clock Clock) *Scheduler {
+	if clock == nil {
+		clock = WallClock{}
+	}
+
+	s := &Scheduler{
+		clock: clock,
+		wake:  make(chan struct{}, 1),
+	}
+	s.timers.Less = timerLess
+	s.timers.OnMove = func(t *Timer, idx int) { t.index = idx }
+	return s
+}
+
+// timerLess orders timers by deadline, then by insertion order.
+func timerLess(a, b *Timer) bool {
+	if a.deadline.Equal(b.deadline) {
+		return a.seq < b.seq
+	}
+	return a.deadline.Before(b.deadline)
+}
+
+// At schedules fn to run once at deadline.
+func (s *Scheduler) At(deadline time.Time, fn func(at time.Time)) *Timer {
+	return s.schedule(deadline, 0, fn)
+}
+
+// After schedules fn to run once, d after the current clock time.
+func (s *Scheduler) After(d time.Duration, fn func(at time.Time)) *Timer {
+	return s.schedule(s.clock.Now().Add(d), 0, fn)
+}
+
+// Every schedules fn to run every interval, starting one interval from now.
+// Each deadline is derived from the previous deadline rather than from when
+// the callback actually ran, so ticks never drift.
+func (s *Scheduler) Every(interval time.Duration, fn func(at time.Time)) *Timer {
+	if interval <= 0 {
+		panic("minheap: non-positive interval")
+	}
+	return s.schedule(s.clock.Now().Add(interval), interval, fn)
+}
+
+func (s *Scheduler) schedule(deadline time.Time, interval time.Duration, fn func(at time.Time)) *Timer {
+	s.mu.Lock()
+	t := &Timer{
+		deadline: deadline,
+		interval: interval,
+		seq:      s.seq,
+		index:    -1,
+		fn:       fn,
+		s:        s,
+	}
+	s.seq++
+	s.timers.Push(t)
+	s.mu.Unlock()
+
+	// let Run re-evaluate its sleep in case this is the new earliest deadline
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+
+	return t
+}
+
+// Len returns the number of pending timers.
+func (s *Scheduler) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.timers.Len()
+}
+
+// Next returns the earliest pending deadline.
+func (s *Scheduler) Next() (time.Time, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	t, ok := s.timers.Peek()
+	if !ok {
+		return time.Time{}, false
+	}
+	return t.deadline, true
+}
+
+// Tick fires every timer whose deadline is at or before the clock's current
+// time, in deadline order, and returns how many callbacks ran. A periodic
+// timer that fell several intervals behind fires once per missed interval.
+func (s *Scheduler) Tick() int {
+	now := s.clock.Now()
+	fired := 0
+
+	for {
+		s.mu.Lock()
+		t, ok := s.timers.Peek()
+		if !ok || t.deadline.After(now) {
+			s.mu.Unlock()
+			return fired
+		}
+		s.timers.Pop()
+		s.mu.Unlock()
+
+		// run outside the lock so callbacks can schedule or cancel freely
+		t.fn(t.deadline)
+		fired++
+
+		if t.interval > 0 {
+			s.mu.Lock()
+			if !t.cancelled {
+				t.deadline = t.deadline.Add(t.interval)
+				s.timers.Push(t)
+			}
+			s.mu.Unlock()
+		}
+	}
+}
+
+// Run drives the scheduler against a wall clock until ctx is cancelled.
+// Simulated clocks should call Tick after each Advance instead.
+func (s *Scheduler) Run(ctx context.Context) error {
+	sleep := time.NewTimer(time.Hour)
+	defer sleep.Stop()
+
+	for {
+		s.Tick()
+
+		wait := time.Hour
+		if next, ok := s.Next(); ok {
+			wait = next.Sub(s.clock.Now())
+		}
+		sleep.Reset(wait)
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-s.wake:
+		case <-sleep.C:
+		}
+	}
+}
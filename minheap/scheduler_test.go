@@ -0,0 +1,136 @@
+package minheap
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+var epoch = time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+
+func TestSchedulerOrder(t *testing.T) {
+	clock := NewSimClock(epoch)
+	s := NewScheduler(clock)
+
+	var order []int
+	s.After(30*time.Millisecond, func(time.Time) { order = append(order, 3) })
+	s.After(10*time.Millisecond, func(time.Time) { order = append(order, 1) })
+	s.After(20*time.Millisecond, func(time.Time) { order = append(order, 2) })
+	s.After(20*time.Millisecond, func(time.Time) { order = append(order, 22) })
+
+	if n := s.Tick(); n != 0 {
+		t.Fatalf("expected nothing due yet, fired %d", n)
+	}
+
+	clock.Advance(20 * time.Millisecond)
+	if n := s.Tick(); n != 3 {
+		t.Fatalf("expected 3 fired, got %d", n)
+	}
+
+	clock.Advance(10 * time.Millisecond)
+	s.Tick()
+
+	want := []int{1, 2, 22, 3}
+	if len(order) != len(want) {
+		t.Fatalf("expected %v, got %v", want, order)
+	}
+	for i := range want {
+		if order[i] != want[i] {
+			t.Fatalf("expected %v, got %v", want, order)
+		}
+	}
+}
+
+func TestSchedulerCancel(t *testing.T) {
+	clock := NewSimClock(epoch)
+	s := NewScheduler(clock)
+
+	fired := 0
+	timers := make([]*Timer, 10)
+	for i := range timers {
+		timers[i] = s.After(time.Duration(i+1)*time.Second, func(time.Time) { fired++ })
+	}
+
+	for i := 0; i < len(timers); i += 2 {
+		if !timers[i].Cancel() {
+			t.Errorf("timer %d: expected Cancel to report pending", i)
+		}
+	}
+	if timers[0].Cancel() {
+		t.Error("expected second Cancel to report false")
+	}
+	if s.Len() != 5 {
+		t.Errorf("expected 5 pending, got %d", s.Len())
+	}
+
+	clock.Advance(time.Minute)
+	s.Tick()
+
+	if fired != 5 {
+		t.Errorf("expected 5 fired, got %d", fired)
+	}
+}
+
+func TestSchedulerPeriodicNoDrift(t *testing.T) {
+	clock := NewSimClock(epoch)
+	s := NewScheduler(clock)
+
+	var ticks []time.Time
+	s.Every(100*time.Millisecond, func(at time.Time) { ticks = append(ticks, at) })
+
+	// uneven advances must still yield ticks on exact 100ms boundaries
+	for _, d := range []time.Duration{130, 40, 250, 95} {
+		clock.Advance(d * time.Millisecond)
+		s.Tick()
+	}
+
+	if len(ticks) != 5 {
+		t.Fatalf("expected 5 ticks, got %d", len(ticks))
+	}
+	for i, at := range ticks {
+		want := epoch.Add(time.Duration(i+1) * 100 * time.Millisecond)
+		if !at.Equal(want) {
+			t.Errorf("tick %d: expected %v, got %v", i, want, at)
+		}
+	}
+}
+
+func TestSchedulerCancelFromCallback(t *testing.T) {
+	clock := NewSimClock(epoch)
+	s := NewScheduler(clock)
+
+	count := 0
+	var timer *Timer
+	timer = s.Every(time.Second, func(time.Time) {
+		count++
+		if count == 3 {
+			timer.Cancel()
+		}
+	})
+
+	clock.Advance(10 * time.Second)
+	s.Tick()
+
+	if count != 3 {
+		t.Errorf("expected 3 ticks before cancel, got %d", count)
+	}
+	if s.Len() != 0 {
+		t.Errorf("expected no pending timers, got %d", s.Len())
+	}
+}
+
+func TestSchedulerRunWallClock(t *testing.T) {
+	s := NewScheduler(nil)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	done := make(chan struct{})
+	go s.Run(ctx)
+	s.After(5*time.Millisecond, func(time.Time) { close(done) })
+
+	select {
+	case <-done:
+	case <-ctx.Done():
+		t.Fatal("timer did not fire under Run")
+	}
+}
@@ -1 +1,31 @@
 package main
+
+import (
+	"fmt"
+	"math/rand/v2"
+	spatialgrid "spatial-grid"
+)
+
+type satellite struct {
+	id      int
+	x, y, z float64
+}
+
+func (s *satellite) ID() int                       { return s.id }
+func (s *satellite) Position() (x, y float64)      { return s.x, s.y }
+func (s *satellite) Position3D() (x, y, z float64) { return s.x, s.y, s.z }
+
+func main() {
+	sh := spatialgrid.NewSpatialHash3D[*satellite](50, 1000, 1000, 1000)
+
+	for i := 0; i < 1000; i++ {
+		s := &satellite{id: i, x: rand.Float64() * 1000, y: rand.Float64() * 1000, z: rand.Float64() * 1000}
+		sh.Insert3D(s, s.x, s.y, s.z)
+	}
+
+	nearby := sh.QueryDistanceFilter3D(500, 500, 500, 100)
+	fmt.Printf("%d satellites within 100 units of the centre:\n", len(nearby))
+	for _, s := range nearby {
+		fmt.Printf("  #%d at (%.1f, %.1f, %.1f)\n", s.id, s.x, s.y, s.z)
+	}
+}
@@ -0,0 +1,401 @@
+package spatialgrid
+
+import (
+	"runtime"
+	"sync"
+	"sync/atomic"
+)
+
+const (
+	cellStripes = 256 // power of two; cells share a lock by index & (cellStripes-1)
+	idShards    = 64  // power of two; entity records are sharded by ID
+	cacheLine   = 64
+)
+
+// ConcurrentSpatialHash is a dense SpatialHash that is safe to use from many
+// goroutines. Cells are guarded by striped locks, so moves in different parts
+// of the world don't contend, and each entity's record is guarded by a lock
+// sharded on its ID, so operations on the same entity are serialised.
+//
+// Like a dense SpatialHash it keeps entities outside the world in the
+// nearest edge cell.
+//
+// Lock order is always ID shard, then cell stripes in ascending index. A
+// query holds one stripe at a time and never an ID shard.
+type ConcurrentSpatialHash[E Entity] struct {
+	grid
+
+	// rebuild is held for writing only while BulkUpdate swaps in a new grid
+	rebuild sync.RWMutex
+	cells   [][]slotEntry[E]
+	records [idShards]recordShard[E]
+	stripes [cellStripes]stripe
+	count   atomic.Int64
+}
+
+// record is where an entity currently sits. key is written only with the
+// entity's ID shard held (plus the affected stripes); slot is written by
+// whoever holds the stripe of key's cell, since removing a neighbour can
+// shift it.
+type record struct {
+	key  CellKey
+	slot int
+}
+
+type slotEntry[E Entity] struct {
+	e   E
+	rec *record
+}
+
+type recordShard[E Entity] struct {
+	mu      sync.Mutex
+	records map[int]*record
+	_       [cacheLine - 16]byte
+}
+
+type stripe struct {
+	sync.Mutex
+	_ [cacheLine - 8]byte
+}
+
+// Placement is one entity's position in a BulkUpdate snapshot.
+type Placement[E Entity] struct {
+	Entity  E
+	X, Y, Z float64
+}
+
+func NewConcurrentSpatialHash[E Entity](cellSize float64, worldWidth, worldHeight float64) *ConcurrentSpatialHash[E] {
+	return newConcurrentSpatialHash[E](cellSize, worldWidth, worldHeight, 0, false)
+}
+
+func NewConcurrentSpatialHash3D[E Entity](cellSize float64, worldWidth, worldHeight, worldDepth float64) *ConcurrentSpatialHash[E] {
+	return newConcurrentSpatialHash[E](cellSize, worldWidth, worldHeight, worldDepth, true)
+}
+
+func newConcurrentSpatialHash[E Entity](cellSize float64, worldWidth, worldHeight, worldDepth float64, is3D bool) *ConcurrentSpatialHash[E] {
+	ch := &ConcurrentSpatialHash[E]{grid: newGrid(cellSize, worldWidth, worldHeight, worldDepth, is3D)}
+	ch.cells = make([][]slotEntry[E], ch.gridWidth*ch.gridHeight*ch.gridDepth)
+	for i := range ch.records {
+		ch.records[i].records = make(map[int]*record)
+	}
+	return ch
+}
+
+// placeKey returns the cell an entity at (x, y, z) is stored in.
+func (ch *ConcurrentSpatialHash[E]) placeKey(x, y, z float64) CellKey {
+	return ch.clamp(ch.cellKey(x, y, z))
+}
+
+func (ch *ConcurrentSpatialHash[E]) stripe(idx int) *stripe {
+	return &ch.stripes[idx&(cellStripes-1)]
+}
+
+func (ch *ConcurrentSpatialHash[E]) shard(id int) *recordShard[E] {
+	return &ch.records[uint(id)&(idShards-1)]
+}
+
+func (ch *ConcurrentSpatialHash[E]) Len() int {
+	return int(ch.count.Load())
+}
+
+func (ch *ConcurrentSpatialHash[E]) Insert(e E, x, y float64) {
+	ch.Update3D(e, x, y, 0)
+}
+
+func (ch *ConcurrentSpatialHash[E]) Insert3D(e E, x, y, z float64) {
+	ch.Update3D(e, x, y, z)
+}
+
+func (ch *ConcurrentSpatialHash[E]) Update(e E, x, y float64) {
+	ch.Update3D(e, x, y, 0)
+}
+
+// Update3D moves e to (x, y, z), inserting it if it isn't in the hash yet.
+func (ch *ConcurrentSpatialHash[E]) Update3D(e E, x, y, z float64) {
+	ch.rebuild.RLock()
+	defer ch.rebuild.RUnlock()
+
+	key := ch.placeKey(x, y, z)
+	to := ch.index(key)
+
+	shard := ch.shard(e.ID())
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+
+	rec, ok := shard.records[e.ID()]
+	if !ok {
+		rec = &record{key: key}
+		shard.records[e.ID()] = rec
+		ch.count.Add(1)
+
+		s := ch.stripe(to)
+		s.Lock()
+		ch.appendLocked(to, e, rec)
+		s.Unlock()
+		return
+	}
+	if rec.key == key {
+		return
+	}
+
+	from := ch.index(rec.key)
+	first, second := ch.stripe(from), ch.stripe(to)
+	if from&(cellStripes-1) > to&(cellStripes-1) {
+		first, second = second, first
+	}
+	first.Lock()
+	if second != first {
+		second.Lock()
+	}
+
+	ch.removeLocked(from, rec)
+	rec.key = key
+	ch.appendLocked(to, e, rec)
+
+	if second != first {
+		second.Unlock()
+	}
+	first.Unlock()
+}
+
+// Remove takes e out of the hash. It's a no-op for entities not in it.
+func (ch *ConcurrentSpatialHash[E]) Remove(e E) {
+	ch.rebuild.RLock()
+	defer ch.rebuild.RUnlock()
+
+	shard := ch.shard(e.ID())
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+
+	rec, ok := shard.records[e.ID()]
+	if !ok {
+		return
+	}
+	delete(shard.records, e.ID())
+	ch.count.Add(-1)
+
+	idx := ch.index(rec.key)
+	s := ch.stripe(idx)
+	s.Lock()
+	ch.removeLocked(idx, rec)
+	s.Unlock()
+}
+
+// appendLocked and removeLocked need idx's stripe held.
+func (ch *ConcurrentSpatialHash[E]) appendLocked(idx int, e E, rec *record) {
+	rec.slot = len(ch.cells[idx])
+	ch.cells[idx] = append(ch.cells[idx], slotEntry[E]{e: e, rec: rec})
+}
+
+func (ch *ConcurrentSpatialHash[E]) removeLocked(idx int, rec *record) {
+	entries := ch.cells[idx]
+	last := len(entries) - 1
+
+	// swap since ordering doesn't matter in the cell
+	if rec.slot != last {
+		entries[rec.slot] = entries[last]
+		entries[rec.slot].rec.slot = rec.slot
+	}
+	entries[last] = slotEntry[E]{}
+	ch.cells[idx] = entries[:last]
+}
+
+func (ch *ConcurrentSpatialHash[E]) Query(x, y, radius float64) []E {
+	return ch.Query3D(x, y, 0, radius)
+}
+
+// Query3D returns all entities in cells that overlap the sphere.
+func (ch *ConcurrentSpatialHash[E]) Query3D(x, y, z, radius float64) []E {
+	var entities []E
+	ch.eachCell(x, y, z, radius, func(cell []slotEntry[E]) bool {
+		for _, entry := range cell {
+			entities = append(entities, entry.e)
+		}
+		return true
+	})
+	return entities
+}
+
+func (ch *ConcurrentSpatialHash[E]) QueryDistanceFilter(x, y, radius float64) []E {
+	return ch.QueryDistanceFilter3D(x, y, 0, radius)
+}
+
+func (ch *ConcurrentSpatialHash[E]) QueryDistanceFilter3D(x, y, z, radius float64) []E {
+	var result []E
+	ch.EachInRadius3D(x, y, z, radius, func(e E) bool {
+		result = append(result, e)
+		return true
+	})
+	return result
+}
+
+func (ch *ConcurrentSpatialHash[E]) EachInRadius(x, y, radius float64, fn func(e E) bool) {
+	ch.EachInRadius3D(x, y, 0, radius, fn)
+}
+
+// EachInRadius3D calls fn for every entity within radius of (x, y, z). fn
+// runs with a cell lock held, so it must not call back into the hash.
+func (ch *ConcurrentSpatialHash[E]) EachInRadius3D(x, y, z, radius float64, fn func(e E) bool) {
+	radiusSq := radius * radius
+
+	ch.eachCell(x, y, z, radius, func(cell []slotEntry[E]) bool {
+		for _, entry := range cell {
+			ex, ey, ez := position(entry.e)
+			dx, dy, dz := x-ex, y-ey, 0.0
+			if ch.is3D {
+				dz = z - ez
+			}
+			if dx*dx+dy*dy+dz*dz <= radiusSq && !fn(entry.e) {
+				return false
+			}
+		}
+		return true
+	})
+}
+
+// eachCell calls fn with each non-empty cell overlapping the sphere, holding
+// that cell's stripe for the duration of the call.
+func (ch *ConcurrentSpatialHash[E]) eachCell(x, y, z, radius float64, fn func(cell []slotEntry[E]) bool) {
+	ch.rebuild.RLock()
+	defer ch.rebuild.RUnlock()
+
+	lo := ch.clamp(ch.cellKey(x-radius, y-radius, z-radius))
+	hi := ch.clamp(ch.cellKey(x+radius, y+radius, z+radius))
+
+	for cz := lo.Z; cz <= hi.Z; cz++ {
+		for cy := lo.Y; cy <= hi.Y; cy++ {
+			for cx := lo.X; cx <= hi.X; cx++ {
+				idx := ch.index(CellKey{X: cx, Y: cy, Z: cz})
+				s := ch.stripe(idx)
+				s.Lock()
+				cont := len(ch.cells[idx]) == 0 || fn(ch.cells[idx])
+				s.Unlock()
+				if !cont {
+					return
+				}
+			}
+		}
+	}
+}
+
+// BulkUpdate replaces the hash's contents with snapshot, rebuilding the grid
+// across GOMAXPROCS workers with a parallel counting sort. The new grid is
+// built off to the side and swapped in at the end, so queries keep seeing
+// the old one until then; inserts, updates and removals that race with a
+// BulkUpdate are lost. Entity IDs in snapshot must be unique.
+func (ch *ConcurrentSpatialHash[E]) BulkUpdate(snapshot []Placement[E]) {
+	numCells := len(ch.cells)
+	workers := max(1, min(runtime.GOMAXPROCS(0), len(snapshot)/1024))
+	chunk := (len(snapshot) + workers - 1) / workers
+
+	parallel := func(fn func(w, lo, hi int)) {
+		var wg sync.WaitGroup
+		for w := range workers {
+			lo, hi := w*chunk, min((w+1)*chunk, len(snapshot))
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				fn(w, lo, hi)
+			}()
+		}
+		wg.Wait()
+	}
+
+	// 1. bucket every placement by cell and by ID shard, counting per worker
+	cellOf := make([]int32, len(snapshot))
+	counts := make([][]int32, workers)
+	shardCounts := make([][]int32, workers)
+	parallel(func(w, lo, hi int) {
+		counts[w] = make([]int32, numCells)
+		shardCounts[w] = make([]int32, idShards)
+		for i := lo; i < hi; i++ {
+			p := &snapshot[i]
+			idx := ch.index(ch.placeKey(p.X, p.Y, p.Z))
+			cellOf[i] = int32(idx)
+			counts[w][idx]++
+			shardCounts[w][uint(p.Entity.ID())&(idShards-1)]++
+		}
+	})
+
+	// 2. prefix sums: each worker gets its own disjoint run inside each
+	// cell and each shard
+	cellStart := prefixSum(counts, numCells)
+	shardStart := prefixSum(shardCounts, idShards)
+
+	// 3. scatter into one flat backing array, and snapshot indices into
+	// runs by shard
+	flat := make([]slotEntry[E], len(snapshot))
+	recs := make([]record, len(snapshot))
+	byShard := make([]int32, len(snapshot))
+	parallel(func(w, lo, hi int) {
+		for i := lo; i < hi; i++ {
+			s := uint(snapshot[i].Entity.ID()) & (idShards - 1)
+			byShard[shardCounts[w][s]] = int32(i)
+			shardCounts[w][s]++
+
+			c := cellOf[i]
+			pos := counts[w][c]
+			counts[w][c]++
+
+			p := &snapshot[i]
+			recs[i] = record{
+				key:  ch.placeKey(p.X, p.Y, p.Z),
+				slot: int(pos - cellStart[c]),
+			}
+			flat[pos] = slotEntry[E]{e: p.Entity, rec: &recs[i]}
+		}
+	})
+
+	cells := make([][]slotEntry[E], numCells)
+	for c := range cells {
+		lo, hi := cellStart[c], cellStart[c+1]
+		// cap each cell at its own run so an append can't spill into the next
+		cells[c] = flat[lo:hi:hi]
+	}
+
+	// 4. rebuild the ID shards, each worker owning a subset of shards and
+	// walking only their runs
+	var shards [idShards]map[int]*record
+	var wg sync.WaitGroup
+	for w := range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for s := w; s < idShards; s += workers {
+				run := byShard[shardStart[s]:shardStart[s+1]]
+				shards[s] = make(map[int]*record, len(run))
+				for _, i := range run {
+					shards[s][snapshot[i].Entity.ID()] = &recs[i]
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	ch.rebuild.Lock()
+	ch.cells = cells
+	for s := range ch.records {
+		ch.records[s].records = shards[s]
+	}
+	ch.count.Store(int64(len(snapshot)))
+	ch.rebuild.Unlock()
+}
+
+// prefixSum turns per-worker bucket counts into write cursors: afterwards
+// counts[w][b] is where worker w writes its first entry of bucket b, with
+// the workers' runs laid out in order inside each bucket. It returns where
+// each bucket starts, plus the total at the end.
+func prefixSum(counts [][]int32, buckets int) []int32 {
+	start := make([]int32, buckets+1)
+	var running int32
+	for b := range buckets {
+		start[b] = running
+		for w := range counts {
+			n := counts[w][b]
+			counts[w][b] = running
+			running += n
+		}
+	}
+	start[buckets] = running
+	return start
+}
@@ -0,0 +1,272 @@
+package spatialgrid
+
+import (
+	"math"
+	"math/rand/v2"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+// movingEntity keeps its position in atomics so workers can move it while
+// queries read it under -race.
+type movingEntity struct {
+	id   int
+	x, y atomic.Uint64 // float64 bits
+}
+
+func (e *movingEntity) ID() int {
+	return e.id
+}
+
+func (e *movingEntity) Position() (x, y float64) {
+	return math.Float64frombits(e.x.Load()), math.Float64frombits(e.y.Load())
+}
+
+func TestConcurrentMatchesSequential(t *testing.T) {
+	ch := NewConcurrentSpatialHash[*TestEntity](10, 200, 200)
+	sh := NewSpatialHash[*TestEntity](10, 200, 200)
+
+	rng := rand.New(rand.NewPCG(1, 1))
+	entities := make([]*TestEntity, 500)
+	for i := range entities {
+		e := &TestEntity{id: i, x: rng.Float64() * 199, y: rng.Float64() * 199}
+		entities[i] = e
+		ch.Insert(e, e.x, e.y)
+		sh.Insert(e, e.x, e.y)
+	}
+	for i, e := range entities {
+		switch i % 3 {
+		case 0:
+			ch.Remove(e)
+			sh.Remove(e)
+		case 1:
+			e.x, e.y = rng.Float64()*199, rng.Float64()*199
+			ch.Update(e, e.x, e.y)
+			sh.Update(e, e.x, e.y)
+		}
+	}
+
+	if ch.Len() != sh.Len() {
+		t.Fatalf("Len mismatch: %d vs %d", ch.Len(), sh.Len())
+	}
+	got := ch.QueryDistanceFilter(100, 100, 60)
+	want := sh.QueryDistanceFilter(100, 100, 60)
+	if !slices.Equal(testIDs(got), testIDs(want)) {
+		t.Fatalf("query mismatch: %d vs %d entities", len(got), len(want))
+	}
+}
+
+// TestConcurrentStress moves entities from many goroutines while others
+// query, then checks every entity ended up exactly once in the cell for its
+// final position. Run with -race.
+func TestConcurrentStress(t *testing.T) {
+	const (
+		workers   = 8
+		perWorker = 200
+		moves     = 200
+	)
+	ch := NewConcurrentSpatialHash[*movingEntity](10, 500, 500)
+
+	entities := make([]*movingEntity, workers*perWorker)
+	for i := range entities {
+		entities[i] = &movingEntity{id: i}
+		ch.Insert(entities[i], 0, 0)
+	}
+
+	var done atomic.Bool
+	var queries sync.WaitGroup
+	for range 2 {
+		queries.Add(1)
+		go func() {
+			defer queries.Done()
+			for !done.Load() {
+				ch.QueryDistanceFilter(250, 250, 100)
+			}
+		}()
+	}
+
+	var wg sync.WaitGroup
+	for w := range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			rng := rand.New(rand.NewPCG(uint64(w), 7))
+			mine := entities[w*perWorker : (w+1)*perWorker]
+			for range moves {
+				e := mine[rng.IntN(len(mine))]
+				x, y := rng.Float64()*499, rng.Float64()*499
+				e.x.Store(math.Float64bits(x))
+				e.y.Store(math.Float64bits(y))
+				ch.Update(e, x, y)
+			}
+		}()
+	}
+	wg.Wait()
+	done.Store(true)
+	queries.Wait()
+
+	if ch.Len() != len(entities) {
+		t.Fatalf("expected %d entities, got %d", len(entities), ch.Len())
+	}
+	assertPlacement(t, ch, entities)
+}
+
+func TestBulkUpdateMatchesSequential(t *testing.T) {
+	ch := NewConcurrentSpatialHash3D[*TestEntity3D](10, 100, 100, 100)
+
+	// stale contents that the rebuild must discard
+	for i := range 100 {
+		ch.Insert3D(&TestEntity3D{id: 10000 + i}, 5, 5, 5)
+	}
+
+	entities := randomEntities3D(5000, 0, 99.9, 9)
+	snapshot := make([]Placement[*TestEntity3D], len(entities))
+	for i, e := range entities {
+		snapshot[i] = Placement[*TestEntity3D]{Entity: e, X: e.x, Y: e.y, Z: e.z}
+	}
+	ch.BulkUpdate(snapshot)
+
+	if ch.Len() != len(entities) {
+		t.Fatalf("expected %d entities, got %d", len(entities), ch.Len())
+	}
+
+	sh := NewSpatialHash3D[*TestEntity3D](10, 100, 100, 100)
+	for _, e := range entities {
+		sh.Insert3D(e, e.x, e.y, e.z)
+	}
+	got := ch.QueryDistanceFilter3D(40, 60, 50, 25)
+	want := sh.QueryDistanceFilter3D(40, 60, 50, 25)
+	if !slices.Equal(ids(got), ids(want)) {
+		t.Fatalf("query mismatch after BulkUpdate: %d vs %d", len(got), len(want))
+	}
+
+	// records built by the rebuild must support later incremental edits
+	for _, e := range entities[:1000] {
+		ch.Remove(e)
+	}
+	for _, e := range entities[1000:2000] {
+		e.x, e.y, e.z = 99-e.x, 99-e.y, 99-e.z
+		ch.Update3D(e, e.x, e.y, e.z)
+	}
+	if ch.Len() != len(entities)-1000 {
+		t.Fatalf("expected %d entities, got %d", len(entities)-1000, ch.Len())
+	}
+	total := 0
+	for _, cell := range ch.cells {
+		total += len(cell)
+		for slot, entry := range cell {
+			if entry.rec.slot != slot {
+				t.Fatalf("entity #%d records slot %d but sits at %d", entry.e.ID(), entry.rec.slot, slot)
+			}
+		}
+	}
+	if total != ch.Len() {
+		t.Fatalf("cells hold %d entities, Len reports %d", total, ch.Len())
+	}
+}
+
+func TestConcurrentOutsideWorld(t *testing.T) {
+	ch := NewConcurrentSpatialHash3D[*TestEntity3D](10, 100, 100, 100)
+
+	// spread over three times the world so most land outside it; before
+	// clamping these panicked inside BulkUpdate's workers
+	entities := randomEntities3D(5000, -100, 200, 11)
+	snapshot := make([]Placement[*TestEntity3D], len(entities))
+	for i, e := range entities {
+		snapshot[i] = Placement[*TestEntity3D]{Entity: e, X: e.x, Y: e.y, Z: e.z}
+	}
+	ch.BulkUpdate(snapshot)
+
+	sh := NewSparseSpatialHash3D[*TestEntity3D](10)
+	for _, e := range entities {
+		sh.Insert3D(e, e.x, e.y, e.z)
+	}
+	for _, q := range [][3]float64{{-50, -50, -50}, {150, 50, 180}, {50, 50, 50}} {
+		got := ch.QueryDistanceFilter3D(q[0], q[1], q[2], 30)
+		want := sh.QueryDistanceFilter3D(q[0], q[1], q[2], 30)
+		if !slices.Equal(ids(got), ids(want)) {
+			t.Fatalf("query %v after BulkUpdate: got %d entities, want %d", q, len(got), len(want))
+		}
+	}
+
+	e := entities[0]
+	e.x, e.y, e.z = -500, 500, 1e6
+	ch.Update3D(e, e.x, e.y, e.z)
+	if got := ch.QueryDistanceFilter3D(e.x, e.y, e.z, 1); len(got) != 1 || got[0] != e {
+		t.Fatalf("expected the moved entity, got %v", got)
+	}
+}
+
+func assertPlacement(t *testing.T, ch *ConcurrentSpatialHash[*movingEntity], entities []*movingEntity) {
+	t.Helper()
+
+	seen := make(map[int]int)
+	for idx, cell := range ch.cells {
+		for slot, entry := range cell {
+			seen[entry.e.ID()]++
+			if entry.rec.slot != slot {
+				t.Fatalf("entity #%d records slot %d but sits at %d", entry.e.ID(), entry.rec.slot, slot)
+			}
+			x, y := entry.e.Position()
+			if want := ch.index(ch.cellKey(x, y, 0)); want != idx {
+				t.Fatalf("entity #%d in cell %d, want %d", entry.e.ID(), idx, want)
+			}
+		}
+	}
+	for _, e := range entities {
+		if seen[e.id] != 1 {
+			t.Fatalf("entity #%d appears %d times", e.id, seen[e.id])
+		}
+	}
+}
+
+func testIDs(entities []*TestEntity) []int {
+	out := make([]int, len(entities))
+	for i, e := range entities {
+		out[i] = e.id
+	}
+	slices.Sort(out)
+	return out
+}
+
+func BenchmarkBulkUpdate(b *testing.B) {
+	entities := randomEntities3D(100000, 0, 999, 11)
+	snapshot := make([]Placement[*TestEntity3D], len(entities))
+	for i, e := range entities {
+		snapshot[i] = Placement[*TestEntity3D]{Entity: e, X: e.x, Y: e.y}
+	}
+	ch := NewConcurrentSpatialHash[*TestEntity3D](10, 1000, 1000)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		ch.BulkUpdate(snapshot)
+	}
+}
+
+func BenchmarkSequentialRebuild(b *testing.B) {
+	entities := randomEntities3D(100000, 0, 999, 11)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		sh := NewSpatialHash[*TestEntity3D](10, 1000, 1000)
+		for _, e := range entities {
+			sh.Insert(e, e.x, e.y)
+		}
+	}
+}
+
+func BenchmarkConcurrentUpdateParallel(b *testing.B) {
+	ch := NewConcurrentSpatialHash[*TestEntity](10, 1000, 1000)
+	var nextID atomic.Int64
+
+	b.RunParallel(func(pb *testing.PB) {
+		id := int(nextID.Add(1))
+		rng := rand.New(rand.NewPCG(uint64(id), 3))
+		e := &TestEntity{id: id}
+		for pb.Next() {
+			ch.Update(e, rng.Float64()*999, rng.Float64()*999)
+		}
+	})
+}
@@ -4,3 +4,19 @@ type Entity interface {
 	ID() int
 	Position() (x, y float64)
 }
+
+// Entity3D is an Entity that also has a height. A 3D SpatialHash uses
+// Position3D where it needs an entity's current position; plain entities are
+// treated as sitting at z = 0.
+type Entity3D interface {
+	Entity
+	Position3D() (x, y, z float64)
+}
+
+func position(e Entity) (x, y, z float64) {
+	if e3, ok := e.(Entity3D); ok {
+		return e3.Position3D()
+	}
+	x, y = e.Position()
+	return x, y, 0
+}
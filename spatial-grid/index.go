@@ -0,0 +1,28 @@
+package spatialgrid
+
+// SpatialIndex is the common surface of the spatial structures in this
+// package, so callers can swap a uniform hash for a tree when their entity
+// distribution calls for it.
+//
+// Query is a broad phase: it returns at least every entity within radius,
+// possibly more. QueryDistanceFilter narrows that to entities whose current
+// position is within radius.
+//
+// Queries never modify an index, so any number may run at once as long as
+// nothing writes meanwhile. Only ConcurrentSpatialHash also allows writes
+// alongside them.
+type SpatialIndex[E Entity] interface {
+	Insert(e E, x, y float64)
+	Remove(e E)
+	Update(e E, x, y float64)
+	Query(x, y, radius float64) []E
+	QueryDistanceFilter(x, y, radius float64) []E
+	Len() int
+}
+
+var (
+	_ SpatialIndex[Entity] = (*SpatialHash[Entity])(nil)
+	_ SpatialIndex[Entity] = (*ConcurrentSpatialHash[Entity])(nil)
+	_ SpatialIndex[Entity] = (*Quadtree[Entity])(nil)
+	_ SpatialIndex[Entity] = (*LooseGrid[Entity])(nil)
+)
@@ -0,0 +1,280 @@
+package spatialgrid
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"slices"
+	"sync"
+	"testing"
+)
+
+const benchWorld = 2000.0
+
+// indexes builds a fresh instance of every SpatialIndex over the bench world.
+var indexes = []struct {
+	name string
+	make func() SpatialIndex[*TestEntity]
+}{
+	{"hash", func() SpatialIndex[*TestEntity] { return NewSpatialHash[*TestEntity](20, benchWorld, benchWorld) }},
+	{"sparse", func() SpatialIndex[*TestEntity] { return NewSparseSpatialHash[*TestEntity](20) }},
+	{"quadtree", func() SpatialIndex[*TestEntity] { return NewQuadtree[*TestEntity](benchWorld, benchWorld, 16, 12) }},
+	{"loosegrid", func() SpatialIndex[*TestEntity] { return NewLooseGrid[*TestEntity](100, benchWorld, benchWorld) }},
+}
+
+// distributions generate n entity positions inside the bench world.
+var distributions = []struct {
+	name     string
+	generate func(n int, rng *rand.Rand) []*TestEntity
+}{
+	{"uniform", func(n int, rng *rand.Rand) []*TestEntity {
+		entities := make([]*TestEntity, n)
+		for i := range entities {
+			entities[i] = &TestEntity{id: i, x: rng.Float64() * benchWorld, y: rng.Float64() * benchWorld}
+		}
+		return entities
+	}},
+	// a handful of tight towns and nothing in between, like a game world
+	{"clustered", func(n int, rng *rand.Rand) []*TestEntity {
+		const towns = 12
+		centres := make([][2]float64, towns)
+		for i := range centres {
+			centres[i] = [2]float64{100 + rng.Float64()*(benchWorld-200), 100 + rng.Float64()*(benchWorld-200)}
+		}
+
+		entities := make([]*TestEntity, n)
+		for i := range entities {
+			c := centres[rng.IntN(towns)]
+			x := min(max(c[0]+rng.NormFloat64()*8, 0), benchWorld-1)
+			y := min(max(c[1]+rng.NormFloat64()*8, 0), benchWorld-1)
+			entities[i] = &TestEntity{id: i, x: x, y: y}
+		}
+		return entities
+	}},
+}
+
+func TestIndexesMatchBruteForce(t *testing.T) {
+	for _, dist := range distributions {
+		rng := rand.New(rand.NewPCG(1, 2))
+		entities := dist.generate(5000, rng)
+
+		for _, ix := range indexes {
+			t.Run(dist.name+"/"+ix.name, func(t *testing.T) {
+				index := ix.make()
+				for _, e := range entities {
+					index.Insert(e, e.x, e.y)
+				}
+
+				// churn: move a third, remove a third
+				for i, e := range entities {
+					switch i % 3 {
+					case 0:
+						e.x = min(max(e.x+rng.NormFloat64()*30, 0), benchWorld-1)
+						e.y = min(max(e.y+rng.NormFloat64()*30, 0), benchWorld-1)
+						index.Update(e, e.x, e.y)
+					case 1:
+						index.Remove(e)
+					}
+				}
+
+				live := make([]*TestEntity, 0, len(entities))
+				for i, e := range entities {
+					if i%3 != 1 {
+						live = append(live, e)
+					}
+				}
+				if index.Len() != len(live) {
+					t.Fatalf("expected Len %d, got %d", len(live), index.Len())
+				}
+
+				for range 50 {
+					// aim half the queries at entities so clustered scenes get hits
+					q := live[rng.IntN(len(live))]
+					x, y, r := q.x, q.y, 5+rng.Float64()*60
+					if rng.IntN(2) == 0 {
+						x, y = rng.Float64()*benchWorld, rng.Float64()*benchWorld
+					}
+
+					var want []*TestEntity
+					for _, e := range live {
+						dx, dy := e.x-x, e.y-y
+						if dx*dx+dy*dy <= r*r {
+							want = append(want, e)
+						}
+					}
+
+					got := index.QueryDistanceFilter(x, y, r)
+					if !slices.Equal(testIDs(got), testIDs(want)) {
+						t.Fatalf("query (%.1f, %.1f, %.1f): got %d entities, want %d", x, y, r, len(got), len(want))
+					}
+					if broad := index.Query(x, y, r); len(broad) < len(want) {
+						t.Fatalf("broad Query returned %d, fewer than the %d exact matches", len(broad), len(want))
+					}
+				}
+			})
+		}
+	}
+}
+
+func TestIndexesFindEntitiesOutsideBounds(t *testing.T) {
+	for _, ix := range indexes {
+		t.Run(ix.name, func(t *testing.T) {
+			index := ix.make()
+			inside := &TestEntity{id: 1, x: 10, y: 10}
+			outside := []*TestEntity{
+				{id: 2, x: -50, y: 10},
+				{id: 3, x: benchWorld + 75, y: benchWorld + 75},
+				{id: 4, x: 500, y: -1e6},
+			}
+			index.Insert(inside, inside.x, inside.y)
+			for _, e := range outside {
+				index.Insert(e, e.x, e.y)
+			}
+
+			for _, e := range outside {
+				if got := index.QueryDistanceFilter(e.x, e.y, 5); len(got) != 1 || got[0] != e {
+					t.Errorf("query at #%d's position (%v, %v): got %v", e.id, e.x, e.y, got)
+				}
+			}
+		})
+	}
+}
+
+func TestQuadtreeSplitsAndMerges(t *testing.T) {
+	qt := NewQuadtree[*TestEntity](100, 100, 4, 8)
+
+	entities := make([]*TestEntity, 40)
+	for i := range entities {
+		entities[i] = &TestEntity{id: i, x: 10 + float64(i%7), y: 10 + float64(i/7)}
+		qt.Insert(entities[i], entities[i].x, entities[i].y)
+	}
+	if qt.root.children == nil {
+		t.Fatal("expected root to split past capacity")
+	}
+
+	for _, e := range entities[2:] {
+		qt.Remove(e)
+	}
+	if qt.root.children != nil {
+		t.Fatal("expected tree to collapse back to a single leaf")
+	}
+	if got := qt.QueryDistanceFilter(10, 10, 2); len(got) != 2 {
+		t.Fatalf("expected the 2 remaining entities, got %d", len(got))
+	}
+}
+
+type sizedEntity struct {
+	TestEntity
+	radius float64
+}
+
+func (e *sizedEntity) Radius() float64 { return e.radius }
+
+func TestLooseGridSizedEntities(t *testing.T) {
+	lg := NewLooseGrid[*sizedEntity](10, 100, 100)
+
+	// centred two cells away but big enough to reach the query point
+	big := &sizedEntity{TestEntity: TestEntity{id: 1, x: 35, y: 15}, radius: 18}
+	small := &sizedEntity{TestEntity: TestEntity{id: 2, x: 35, y: 15}, radius: 1}
+	lg.Insert(big, big.x, big.y)
+	lg.Insert(small, small.x, small.y)
+
+	got := lg.QueryDistanceFilter(15, 15, 3)
+	if len(got) != 1 || got[0] != big {
+		t.Fatalf("expected only the large entity to reach the query, got %v", got)
+	}
+
+	lg.Remove(big)
+	if got := lg.Query(15, 15, 3); len(got) != 0 {
+		t.Fatalf("expected stale bounds to be tightened after removal, got %v", got)
+	}
+}
+
+func TestIndexesConcurrentQueries(t *testing.T) {
+	entities := distributions[1].generate(2000, rand.New(rand.NewPCG(5, 6)))
+
+	for _, ix := range indexes {
+		t.Run(ix.name, func(t *testing.T) {
+			index := ix.make()
+			for _, e := range entities {
+				index.Insert(e, e.x, e.y)
+			}
+			// removals loosen cell bounds, which a query must not repair
+			for _, e := range entities[:500] {
+				index.Remove(e)
+			}
+
+			// worked out by hand, since a query here would hide the race
+			const r = benchWorld / 3
+			var near []*TestEntity
+			for _, e := range entities[500:] {
+				dx, dy := e.x-benchWorld/2, e.y-benchWorld/2
+				if dx*dx+dy*dy <= r*r {
+					near = append(near, e)
+				}
+			}
+			want := testIDs(near)
+			var wg sync.WaitGroup
+			for range 8 {
+				wg.Go(func() {
+					for range 20 {
+						got := testIDs(index.QueryDistanceFilter(benchWorld/2, benchWorld/2, r))
+						if !slices.Equal(got, want) {
+							t.Errorf("expected %d entities, got %d", len(want), len(got))
+							return
+						}
+					}
+				})
+			}
+			wg.Wait()
+		})
+	}
+}
+
+// BenchmarkIndexes runs build, query and churn for every index over each
+// distribution. Compare with e.g.
+//
+//	go test -run xxx -bench Indexes/clustered
+func BenchmarkIndexes(b *testing.B) {
+	const n = 20000
+
+	for _, dist := range distributions {
+		entities := dist.generate(n, rand.New(rand.NewPCG(3, 4)))
+
+		for _, ix := range indexes {
+			prefix := fmt.Sprintf("%s/%s", dist.name, ix.name)
+
+			b.Run(prefix+"/build", func(b *testing.B) {
+				for i := 0; i < b.N; i++ {
+					index := ix.make()
+					for _, e := range entities {
+						index.Insert(e, e.x, e.y)
+					}
+				}
+			})
+
+			index := ix.make()
+			for _, e := range entities {
+				index.Insert(e, e.x, e.y)
+			}
+
+			b.Run(prefix+"/query", func(b *testing.B) {
+				b.ReportAllocs()
+				for i := 0; i < b.N; i++ {
+					q := entities[i%n]
+					index.QueryDistanceFilter(q.x, q.y, 30)
+				}
+			})
+
+			b.Run(prefix+"/update", func(b *testing.B) {
+				rng := rand.New(rand.NewPCG(5, 6))
+				for i := 0; i < b.N; i++ {
+					e := entities[i%n]
+					x := min(max(e.x+rng.NormFloat64()*5, 0), benchWorld-1)
+					y := min(max(e.y+rng.NormFloat64()*5, 0), benchWorld-1)
+					index.Update(e, x, y)
+					index.Update(e, e.x, e.y) // put it back so the scene stays stable
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,205 @@
+package spatialgrid
+
+import "math"
+
+// Sized is an Entity with a radius. A LooseGrid indexes sized entities by
+// their centre but loosens each cell's bounds to cover their full extent;
+// entities that don't implement it are treated as points.
+type Sized interface {
+	Entity
+	Radius() float64
+}
+
+// LooseGrid is a coarse uniform grid where every entity lives in exactly one
+// cell, chosen by its centre, and each cell tracks the bounding box of what
+// it actually holds. Queries test those boxes rather than the cell outlines,
+// so a few large cells can still reject most of a clustered world cheaply,
+// and entities with extent never need to be stored in more than one cell.
+// Bounds are kept up to date by the writes, so queries only read the grid
+// and may run concurrently with each other, though not with writes.
+type LooseGrid[E Entity] struct {
+	cellSize   float64
+	gridWidth  int
+	gridHeight int
+	cells      []looseCell[E]
+	maxRadius  float64 // largest entity radius ever inserted
+
+	locations map[int]location
+}
+
+type looseCell[E Entity] struct {
+	entries []looseEntry[E]
+
+	// bounds of the entries' extents, never tighter than they are
+	minX, minY, maxX, maxY float64
+}
+
+type looseEntry[E Entity] struct {
+	e         E
+	x, y, rad float64
+}
+
+// NewLooseGrid returns a loose grid over worldWidth x worldHeight. Positions
+// outside the world are clamped into the edge cells.
+func NewLooseGrid[E Entity](cellSize float64, worldWidth, worldHeight float64) *LooseGrid[E] {
+	gridWidth := max(1, int(worldWidth/cellSize))
+	gridHeight := max(1, int(worldHeight/cellSize))
+
+	return &LooseGrid[E]{
+		cellSize:   cellSize,
+		gridWidth:  gridWidth,
+		gridHeight: gridHeight,
+		cells:      make([]looseCell[E], gridWidth*gridHeight),
+		locations:  make(map[int]location),
+	}
+}
+
+func (lg *LooseGrid[E]) Len() int {
+	return len(lg.locations)
+}
+
+func (lg *LooseGrid[E]) cellCoords(x, y float64) (int, int) {
+	cx := min(max(int(x/lg.cellSize), 0), lg.gridWidth-1)
+	cy := min(max(int(y/lg.cellSize), 0), lg.gridHeight-1)
+	return cx, cy
+}
+
+// Insert adds e centred at (x, y). Inserting an entity that is already
+// present moves it instead of adding a duplicate.
+func (lg *LooseGrid[E]) Insert(e E, x, y float64) {
+	if _, ok := lg.locations[e.ID()]; ok {
+		lg.Update(e, x, y)
+		return
+	}
+	lg.insert(e, x, y)
+}
+
+func (lg *LooseGrid[E]) insert(e E, x, y float64) {
+	rad := 0.0
+	if s, ok := any(e).(Sized); ok {
+		rad = s.Radius()
+	}
+	lg.maxRadius = max(lg.maxRadius, rad)
+
+	cx, cy := lg.cellCoords(x, y)
+	idx := cx + cy*lg.gridWidth
+	cell := &lg.cells[idx]
+
+	if len(cell.entries) == 0 {
+		cell.minX, cell.minY = math.Inf(1), math.Inf(1)
+		cell.maxX, cell.maxY = math.Inf(-1), math.Inf(-1)
+	}
+	cell.grow(x, y, rad)
+
+	lg.locations[e.ID()] = location{key: CellKey{X: cx, Y: cy}, slot: len(cell.entries)}
+	cell.entries = append(cell.entries, looseEntry[E]{e: e, x: x, y: y, rad: rad})
+}
+
+// Remove takes e out of the grid. It's a no-op for entities not in it.
+func (lg *LooseGrid[E]) Remove(e E) {
+	loc, ok := lg.locations[e.ID()]
+	if !ok {
+		return
+	}
+	delete(lg.locations, e.ID())
+
+	cell := &lg.cells[loc.key.X+loc.key.Y*lg.gridWidth]
+	removed := cell.entries[loc.slot]
+	last := len(cell.entries) - 1
+
+	// swap since ordering doesn't matter in the cell
+	if loc.slot != last {
+		moved := cell.entries[last]
+		cell.entries[loc.slot] = moved
+		lg.locations[moved.e.ID()] = location{key: loc.key, slot: loc.slot}
+	}
+	cell.entries[last] = looseEntry[E]{}
+	cell.entries = cell.entries[:last]
+
+	// only an entry on the edge of the bounds can have been holding them
+	// out, so only then are they worth recomputing
+	if removed.x-removed.rad <= cell.minX || removed.y-removed.rad <= cell.minY ||
+		removed.x+removed.rad >= cell.maxX || removed.y+removed.rad >= cell.maxY {
+		cell.tighten()
+	}
+}
+
+// Update moves e to (x, y), inserting it if it isn't in the grid yet.
+func (lg *LooseGrid[E]) Update(e E, x, y float64) {
+	loc, ok := lg.locations[e.ID()]
+	if ok {
+		cx, cy := lg.cellCoords(x, y)
+		if loc.key == (CellKey{X: cx, Y: cy}) {
+			cell := &lg.cells[cx+cy*lg.gridWidth]
+			entry := &cell.entries[loc.slot]
+			entry.x, entry.y = x, y
+			// moving inwards leaves the bounds loose but still covering
+			cell.grow(x, y, entry.rad)
+			return
+		}
+		lg.Remove(e)
+	}
+	lg.insert(e, x, y)
+}
+
+// Query returns every entity in cells whose loose bounds overlap the
+// circle's bounding box.
+func (lg *LooseGrid[E]) Query(x, y, radius float64) []E {
+	var entities []E
+	lg.eachCell(x-radius, y-radius, x+radius, y+radius, func(cell *looseCell[E]) {
+		for _, entry := range cell.entries {
+			entities = append(entities, entry.e)
+		}
+	})
+	return entities
+}
+
+// QueryDistanceFilter returns entities whose extent reaches within radius of
+// (x, y): for point entities, those whose centre is within radius.
+func (lg *LooseGrid[E]) QueryDistanceFilter(x, y, radius float64) []E {
+	var result []E
+	lg.eachCell(x-radius, y-radius, x+radius, y+radius, func(cell *looseCell[E]) {
+		for _, entry := range cell.entries {
+			ex, ey := entry.e.Position()
+			dx, dy := x-ex, y-ey
+			reach := radius + entry.rad
+			if dx*dx+dy*dy <= reach*reach {
+				result = append(result, entry.e)
+			}
+		}
+	})
+	return result
+}
+
+func (lg *LooseGrid[E]) eachCell(minX, minY, maxX, maxY float64, fn func(cell *looseCell[E])) {
+	// a cell's loose bounds can reach maxRadius past its outline, so widen
+	// the candidate range by that much before testing the real bounds
+	loX, loY := lg.cellCoords(minX-lg.maxRadius, minY-lg.maxRadius)
+	hiX, hiY := lg.cellCoords(maxX+lg.maxRadius, maxY+lg.maxRadius)
+
+	for cy := loY; cy <= hiY; cy++ {
+		for cx := loX; cx <= hiX; cx++ {
+			cell := &lg.cells[cx+cy*lg.gridWidth]
+			if len(cell.entries) == 0 {
+				continue
+			}
+			if maxX < cell.minX || minX > cell.maxX || maxY < cell.minY || minY > cell.maxY {
+				continue
+			}
+			fn(cell)
+		}
+	}
+}
+
+func (c *looseCell[E]) grow(x, y, rad float64) {
+	c.minX, c.minY = min(c.minX, x-rad), min(c.minY, y-rad)
+	c.maxX, c.maxY = max(c.maxX, x+rad), max(c.maxY, y+rad)
+}
+
+func (c *looseCell[E]) tighten() {
+	c.minX, c.minY = math.Inf(1), math.Inf(1)
+	c.maxX, c.maxY = math.Inf(-1), math.Inf(-1)
+	for _, entry := range c.entries {
+		c.grow(entry.x, entry.y, entry.rad)
+	}
+}
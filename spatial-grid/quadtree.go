@@ -0,0 +1,246 @@
+package spatialgrid
+
+// Quadtree is a point quadtree over a fixed rectangle. Leaves split into four
+// once they hold more than capacity entities and merge back when a subtree
+// empties out, so dense clusters get fine nodes while open space stays
+// coarse. Positions outside the bounds are clamped onto the edge.
+type Quadtree[E Entity] struct {
+	root     *quadNode[E]
+	capacity int
+	maxDepth int
+
+	// leaf each entity sits in, by ID
+	leaves map[int]*quadNode[E]
+}
+
+type quadNode[E Entity] struct {
+	minX, minY, maxX, maxY float64
+	depth                  int
+	count                  int // entities in this subtree
+
+	entries  []quadEntry[E] // only used by leaves
+	children *[4]quadNode[E]
+	parent   *quadNode[E]
+}
+
+type quadEntry[E Entity] struct {
+	e    E
+	x, y float64 // position it was inserted at, needed to redistribute on split
+}
+
+// NewQuadtree returns a quadtree over [0, worldWidth] x [0, worldHeight].
+// Leaves hold up to capacity entities before splitting, down to maxDepth.
+func NewQuadtree[E Entity](worldWidth, worldHeight float64, capacity, maxDepth int) *Quadtree[E] {
+	return &Quadtree[E]{
+		root:     &quadNode[E]{maxX: worldWidth, maxY: worldHeight},
+		capacity: max(1, capacity),
+		maxDepth: maxDepth,
+		leaves:   make(map[int]*quadNode[E]),
+	}
+}
+
+func (qt *Quadtree[E]) Len() int {
+	return qt.root.count
+}
+
+// Insert adds e at (x, y). Inserting an entity that is already present moves
+// it instead of adding a duplicate.
+func (qt *Quadtree[E]) Insert(e E, x, y float64) {
+	if _, ok := qt.leaves[e.ID()]; ok {
+		qt.Update(e, x, y)
+		return
+	}
+	x, y = qt.clamp(x, y)
+	qt.insert(qt.root, quadEntry[E]{e: e, x: x, y: y})
+}
+
+func (qt *Quadtree[E]) insert(n *quadNode[E], entry quadEntry[E]) {
+	for n.children != nil {
+		n.count++
+		n = &n.children[n.quadrant(entry.x, entry.y)]
+	}
+
+	n.count++
+	n.entries = append(n.entries, entry)
+	qt.leaves[entry.e.ID()] = n
+
+	if len(n.entries) > qt.capacity && n.depth < qt.maxDepth {
+		qt.split(n)
+	}
+}
+
+func (qt *Quadtree[E]) split(n *quadNode[E]) {
+	midX := (n.minX + n.maxX) / 2
+	midY := (n.minY + n.maxY) / 2
+
+	n.children = &[4]quadNode[E]{
+		{minX: n.minX, minY: n.minY, maxX: midX, maxY: midY},
+		{minX: midX, minY: n.minY, maxX: n.maxX, maxY: midY},
+		{minX: n.minX, minY: midY, maxX: midX, maxY: n.maxY},
+		{minX: midX, minY: midY, maxX: n.maxX, maxY: n.maxY},
+	}
+	for i := range n.children {
+		n.children[i].depth = n.depth + 1
+		n.children[i].parent = n
+	}
+
+	entries := n.entries
+	n.entries = nil
+	n.count -= len(entries)
+	for _, entry := range entries {
+		// may split again if everything landed in one quadrant
+		qt.insert(n, entry)
+	}
+}
+
+// Remove takes e out of the tree. It's a no-op for entities not in it.
+func (qt *Quadtree[E]) Remove(e E) {
+	leaf, ok := qt.leaves[e.ID()]
+	if !ok {
+		return
+	}
+	delete(qt.leaves, e.ID())
+
+	for i, entry := range leaf.entries {
+		if entry.e.ID() == e.ID() {
+			// swap since ordering doesn't matter in the leaf
+			last := len(leaf.entries) - 1
+			leaf.entries[i] = leaf.entries[last]
+			leaf.entries[last] = quadEntry[E]{}
+			leaf.entries = leaf.entries[:last]
+			break
+		}
+	}
+	for n := leaf; n != nil; n = n.parent {
+		n.count--
+	}
+
+	// merge the highest ancestor that has emptied out enough, so a
+	// dispersing cluster doesn't leave a deep, sparse subtree behind
+	var merge *quadNode[E]
+	for n := leaf.parent; n != nil && n.count <= qt.capacity/2; n = n.parent {
+		merge = n
+	}
+	if merge != nil {
+		qt.collapse(merge)
+	}
+}
+
+func (qt *Quadtree[E]) collapse(n *quadNode[E]) {
+	entries := make([]quadEntry[E], 0, n.count)
+	var gather func(c *quadNode[E])
+	gather = func(c *quadNode[E]) {
+		if c.children == nil {
+			entries = append(entries, c.entries...)
+			return
+		}
+		for i := range c.children {
+			gather(&c.children[i])
+		}
+	}
+	gather(n)
+
+	n.children = nil
+	n.entries = entries
+	for _, entry := range entries {
+		qt.leaves[entry.e.ID()] = n
+	}
+}
+
+// Update moves e to (x, y), inserting it if it isn't in the tree yet. Moves
+// that stay inside the same leaf only rewrite the stored position.
+func (qt *Quadtree[E]) Update(e E, x, y float64) {
+	x, y = qt.clamp(x, y)
+
+	leaf, ok := qt.leaves[e.ID()]
+	if ok && leaf.contains(x, y) {
+		for i := range leaf.entries {
+			if leaf.entries[i].e.ID() == e.ID() {
+				leaf.entries[i].x, leaf.entries[i].y = x, y
+				return
+			}
+		}
+	}
+
+	qt.Remove(e)
+	qt.insert(qt.root, quadEntry[E]{e: e, x: x, y: y})
+}
+
+// Query returns every entity in leaves that overlap the circle's bounding
+// box.
+func (qt *Quadtree[E]) Query(x, y, radius float64) []E {
+	var entities []E
+	minX, minY, maxX, maxY := qt.box(x, y, radius)
+	qt.eachLeaf(qt.root, minX, minY, maxX, maxY, func(n *quadNode[E]) {
+		for _, entry := range n.entries {
+			entities = append(entities, entry.e)
+		}
+	})
+	return entities
+}
+
+func (qt *Quadtree[E]) QueryDistanceFilter(x, y, radius float64) []E {
+	var result []E
+	radiusSq := radius * radius
+
+	minX, minY, maxX, maxY := qt.box(x, y, radius)
+	qt.eachLeaf(qt.root, minX, minY, maxX, maxY, func(n *quadNode[E]) {
+		for _, entry := range n.entries {
+			ex, ey := entry.e.Position()
+			dx, dy := x-ex, y-ey
+			if dx*dx+dy*dy <= radiusSq {
+				result = append(result, entry.e)
+			}
+		}
+	})
+	return result
+}
+
+func (qt *Quadtree[E]) eachLeaf(n *quadNode[E], minX, minY, maxX, maxY float64, fn func(n *quadNode[E])) {
+	if n.count == 0 || maxX < n.minX || minX > n.maxX || maxY < n.minY || minY > n.maxY {
+		return
+	}
+	if n.children == nil {
+		fn(n)
+		return
+	}
+	for i := range n.children {
+		qt.eachLeaf(&n.children[i], minX, minY, maxX, maxY, fn)
+	}
+}
+
+func (qt *Quadtree[E]) clamp(x, y float64) (float64, float64) {
+	return min(max(x, qt.root.minX), qt.root.maxX), min(max(y, qt.root.minY), qt.root.maxY)
+}
+
+// box returns the circle's bounding box clamped like stored positions, so a
+// box reaching past the edge still covers the entities clamped onto it.
+func (qt *Quadtree[E]) box(x, y, radius float64) (minX, minY, maxX, maxY float64) {
+	minX, minY = qt.clamp(x-radius, y-radius)
+	maxX, maxY = qt.clamp(x+radius, y+radius)
+	return minX, minY, maxX, maxY
+}
+
+// quadrant picks the child a point belongs to; points on a midline go to the
+// higher side.
+func (n *quadNode[E]) quadrant(x, y float64) int {
+	q := 0
+	if x >= (n.minX+n.maxX)/2 {
+		q |= 1
+	}
+	if y >= (n.minY+n.maxY)/2 {
+		q |= 2
+	}
+	return q
+}
+
+// contains reports whether a point would be routed to n, matching the
+// half-open split used by quadrant.
+func (n *quadNode[E]) contains(x, y float64) bool {
+	for c, p := n, n.parent; p != nil; c, p = p, p.parent {
+		if &p.children[p.quadrant(x, y)] != c {
+			return false
+		}
+	}
+	return true
+}
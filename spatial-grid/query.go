@@ -0,0 +1,440 @@
+package spatialgrid
+
+import (
+	"math"
+	"slices"
+)
+
+// The Each* methods are the non-allocating forms of the queries. They call fn
+// for each match and stop as soon as fn returns false. fn must not modify the
+// hash.
+
+// EachInRadius calls fn for every entity within radius of (x, y).
+func (sh *SpatialHash[E]) EachInRadius(x, y, radius float64, fn func(e E) bool) {
+	sh.EachInRadius3D(x, y, 0, radius, fn)
+}
+
+// EachInRadius3D calls fn for every entity within radius of (x, y, z). On a
+// 2D hash z is ignored.
+func (sh *SpatialHash[E]) EachInRadius3D(x, y, z, radius float64, fn func(e E) bool) {
+	radiusSq := radius * radius
+	lo := sh.cellKey(x-radius, y-radius, z-radius)
+	hi := sh.cellKey(x+radius, y+radius, z+radius)
+
+	sh.eachCell(lo, hi, func(cell []E) bool {
+		for _, e := range cell {
+			if sh.distSq(e, x, y, z) <= radiusSq && !fn(e) {
+				return false
+			}
+		}
+		return true
+	})
+}
+
+// QueryBox returns every entity whose position lies inside the axis-aligned
+// box, edges included.
+func (sh *SpatialHash[E]) QueryBox(minX, minY, maxX, maxY float64) []E {
+	return sh.QueryBox3D(minX, minY, 0, maxX, maxY, 0)
+}
+
+// QueryBox3D is the 3D form of QueryBox. On a 2D hash the z bounds are
+// ignored.
+func (sh *SpatialHash[E]) QueryBox3D(minX, minY, minZ, maxX, maxY, maxZ float64) []E {
+	var result []E
+	sh.EachInBox3D(minX, minY, minZ, maxX, maxY, maxZ, func(e E) bool {
+		result = append(result, e)
+		return true
+	})
+	return result
+}
+
+func (sh *SpatialHash[E]) EachInBox(minX, minY, maxX, maxY float64, fn func(e E) bool) {
+	sh.EachInBox3D(minX, minY, 0, maxX, maxY, 0, fn)
+}
+
+func (sh *SpatialHash[E]) EachInBox3D(minX, minY, minZ, maxX, maxY, maxZ float64, fn func(e E) bool) {
+	lo := sh.cellKey(minX, minY, minZ)
+	hi := sh.cellKey(maxX, maxY, maxZ)
+
+	sh.eachCell(lo, hi, func(cell []E) bool {
+		for _, e := range cell {
+			x, y, z := position(e)
+			if x < minX || x > maxX || y < minY || y > maxY {
+				continue
+			}
+			if sh.is3D && (z < minZ || z > maxZ) {
+				continue
+			}
+			if !fn(e) {
+				return false
+			}
+		}
+		return true
+	})
+}
+
+// Nearest returns up to k entities closest to (x, y), nearest first.
+func (sh *SpatialHash[E]) Nearest(x, y float64, k int) []E {
+	return sh.Nearest3D(x, y, 0, k)
+}
+
+func (sh *SpatialHash[E]) Nearest3D(x, y, z float64, k int) []E {
+	result := make([]E, 0, min(k, sh.Len()))
+	sh.EachNearest3D(x, y, z, k, func(e E, _ float64) bool {
+		result = append(result, e)
+		return true
+	})
+	return result
+}
+
+func (sh *SpatialHash[E]) EachNearest(x, y float64, k int, fn func(e E, dist float64) bool) {
+	sh.EachNearest3D(x, y, 0, k, fn)
+}
+
+// EachNearest3D calls fn with up to k entities closest to (x, y, z), nearest
+// first, along with their distance. It searches rings of cells outward from
+// the query cell and stops once no unvisited ring can hold anything closer
+// than the current k-th candidate. Like the other queries it only reads the
+// hash, so concurrent calls are fine as long as nothing writes.
+func (sh *SpatialHash[E]) EachNearest3D(x, y, z float64, k int, fn func(e E, dist float64) bool) {
+	if k <= 0 || sh.Len() == 0 {
+		return
+	}
+
+	buf, _ := sh.nearest.Get().(*[]candidate[E])
+	if buf == nil {
+		buf = new([]candidate[E])
+	}
+	best := (*buf)[:0]
+	seen := 0
+	consider := func(cell []E) bool {
+		seen += len(cell)
+		for _, e := range cell {
+			best = pushCandidate(best, k, candidate[E]{e: e, distSq: sh.distSq(e, x, y, z)})
+		}
+		return true
+	}
+
+	center := sh.cellKey(x, y, z)
+	if sh.sparse == nil {
+		// a point outside the world searches from the nearest edge cell,
+		// where entities outside the world are stored too; clamping never
+		// brings a cell closer, so the ring bound below still holds
+		center = sh.clamp(center)
+	}
+	for r := 0; ; r++ {
+		if sh.sparse != nil && sh.ringCells(r) > len(sh.sparse) {
+			// rings are now bigger than the whole occupied set, so sweep
+			// every cell outside the rings already visited and finish
+			for key, cell := range sh.sparse {
+				if sh.ringOf(center, key) >= r {
+					consider(cell)
+				}
+			}
+			break
+		}
+
+		sh.eachRingCell(center, r, consider)
+
+		if seen == sh.Len() {
+			break
+		}
+		// anything in ring r+1 or beyond is at least r cells away
+		reach := float64(r) * sh.cellSize
+		if len(best) == k && best[0].distSq <= reach*reach {
+			break
+		}
+		// from an edge cell this many rings cover the whole grid
+		if sh.sparse == nil && r > max(sh.gridWidth, sh.gridHeight, sh.gridDepth) {
+			break
+		}
+	}
+
+	slices.SortFunc(best, func(a, b candidate[E]) int {
+		switch {
+		case a.distSq < b.distSq:
+			return -1
+		case a.distSq > b.distSq:
+			return 1
+		}
+		return 0
+	})
+
+	// keep the buffer for next time but drop the entity references
+	defer func() {
+		clear(best)
+		*buf = best[:0]
+		sh.nearest.Put(buf)
+	}()
+
+	for _, c := range best {
+		if !fn(c.e, math.Sqrt(c.distSq)) {
+			return
+		}
+	}
+}
+
+type candidate[E Entity] struct {
+	e      E
+	distSq float64
+}
+
+// pushCandidate keeps the k closest candidates as a max-heap on distance, so
+// the current k-th best is always at the root.
+func pushCandidate[E Entity](heap []candidate[E], k int, c candidate[E]) []candidate[E] {
+	if len(heap) < k {
+		heap = append(heap, c)
+		candidateBubbleUp(heap, len(heap)-1)
+		return heap
+	}
+	if c.distSq < heap[0].distSq {
+		heap[0] = c
+		candidateBubbleDown(heap, 0)
+	}
+	return heap
+}
+
+func candidateBubbleUp[E Entity](heap []candidate[E], idx int) {
+	for idx > 0 {
+		parent := (idx - 1) / 2
+		if heap[idx].distSq <= heap[parent].distSq {
+			return
+		}
+		heap[idx], heap[parent] = heap[parent], heap[idx]
+		idx = parent
+	}
+}
+
+func candidateBubbleDown[E Entity](heap []candidate[E], idx int) {
+	for {
+		left := 2*idx + 1
+		right := 2*idx + 2
+		largest := idx
+
+		if left < len(heap) && heap[left].distSq > heap[largest].distSq {
+			largest = left
+		}
+		if right < len(heap) && heap[right].distSq > heap[largest].distSq {
+			largest = right
+		}
+		if largest == idx {
+			return
+		}
+		heap[idx], heap[largest] = heap[largest], heap[idx]
+		idx = largest
+	}
+}
+
+// ringOf returns the Chebyshev distance in cells between two keys.
+func (sh *SpatialHash[E]) ringOf(center, key CellKey) int {
+	return max(abs(key.X-center.X), abs(key.Y-center.Y), abs(key.Z-center.Z))
+}
+
+// ringCells returns how many cells lie exactly r cells from a center cell.
+func (sh *SpatialHash[E]) ringCells(r int) int {
+	if r == 0 {
+		return 1
+	}
+	outer, inner := 2*r+1, 2*r-1
+	if sh.is3D {
+		return outer*outer*outer - inner*inner*inner
+	}
+	return outer*outer - inner*inner
+}
+
+// eachRingCell calls fn with every non-empty cell exactly r cells from
+// center, without walking the interior of the ring.
+func (sh *SpatialHash[E]) eachRingCell(center CellKey, r int, fn func(cell []E) bool) bool {
+	rz := 0
+	if sh.is3D {
+		rz = r
+	}
+
+	visit := func(key CellKey) bool {
+		if !sh.inBounds(key) {
+			return true
+		}
+		cell := sh.cell(key)
+		return len(cell) == 0 || fn(cell)
+	}
+
+	for dz := -rz; dz <= rz; dz++ {
+		for dy := -r; dy <= r; dy++ {
+			if abs(dz) == r || abs(dy) == r {
+				// a face of the ring: the whole row is on it
+				for dx := -r; dx <= r; dx++ {
+					if !visit(center.add(CellKey{X: dx, Y: dy, Z: dz})) {
+						return false
+					}
+				}
+				continue
+			}
+			// interior row: only its two ends are on the ring
+			if !visit(center.add(CellKey{X: -r, Y: dy, Z: dz})) {
+				return false
+			}
+			if r > 0 && !visit(center.add(CellKey{X: r, Y: dy, Z: dz})) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// QueryRay returns the entities in every cell the ray from (ox, oy) along
+// (dx, dy) passes through within maxDist, in the order the cells are crossed.
+// It's a broad phase: entities are returned for the cells they occupy, not
+// tested against the ray itself.
+func (sh *SpatialHash[E]) QueryRay(ox, oy, dx, dy, maxDist float64) []E {
+	return sh.QueryRay3D(ox, oy, 0, dx, dy, 0, maxDist)
+}
+
+func (sh *SpatialHash[E]) QueryRay3D(ox, oy, oz, dx, dy, dz, maxDist float64) []E {
+	var result []E
+	sh.EachAlongRay3D(ox, oy, oz, dx, dy, dz, maxDist, func(e E) bool {
+		result = append(result, e)
+		return true
+	})
+	return result
+}
+
+// QuerySegment is QueryRay over the segment from (x0, y0) to (x1, y1).
+func (sh *SpatialHash[E]) QuerySegment(x0, y0, x1, y1 float64) []E {
+	return sh.QueryRay(x0, y0, x1-x0, y1-y0, math.Hypot(x1-x0, y1-y0))
+}
+
+func (sh *SpatialHash[E]) EachAlongRay(ox, oy, dx, dy, maxDist float64, fn func(e E) bool) {
+	sh.EachAlongRay3D(ox, oy, 0, dx, dy, 0, maxDist, fn)
+}
+
+// EachAlongRay3D walks the cells crossed by the ray with a 3D DDA
+// (Amanatides & Woo), calling fn for each entity in them. The direction need
+// not be normalised. On a dense hash the ray is first clipped to the world
+// bounds; on a sparse hash maxDist must be finite.
+func (sh *SpatialHash[E]) EachAlongRay3D(ox, oy, oz, dx, dy, dz, maxDist float64, fn func(e E) bool) {
+	if !sh.is3D {
+		oz, dz = 0, 0
+	}
+
+	length := math.Sqrt(dx*dx + dy*dy + dz*dz)
+	if length == 0 || maxDist < 0 {
+		return
+	}
+	origin := [3]float64{ox, oy, oz}
+	dir := [3]float64{dx / length, dy / length, dz / length}
+
+	tStart, tEnd := 0.0, maxDist
+	if sh.sparse == nil {
+		upper := [3]float64{
+			float64(sh.gridWidth) * sh.cellSize,
+			float64(sh.gridHeight) * sh.cellSize,
+			float64(sh.gridDepth) * sh.cellSize,
+		}
+		if !sh.is3D {
+			upper[2] = math.Inf(1)
+		}
+
+		var hit bool
+		tStart, tEnd, hit = clipRay(origin, dir, upper, tStart, tEnd)
+		if !hit {
+			return
+		}
+	}
+
+	var (
+		cell   [3]int
+		step   [3]int
+		tMax   [3]float64
+		tDelta [3]float64
+	)
+	for axis := range 3 {
+		p := origin[axis] + dir[axis]*tStart
+		cell[axis] = int(math.Floor(p / sh.cellSize))
+		if sh.sparse == nil {
+			// entering exactly on the far wall would land one cell outside
+			cell[axis] = max(0, min(cell[axis], sh.gridDims()[axis]-1))
+		}
+
+		switch {
+		case dir[axis] > 0:
+			step[axis] = 1
+			tMax[axis] = tStart + (float64(cell[axis]+1)*sh.cellSize-p)/dir[axis]
+			tDelta[axis] = sh.cellSize / dir[axis]
+		case dir[axis] < 0:
+			step[axis] = -1
+			tMax[axis] = tStart + (float64(cell[axis])*sh.cellSize-p)/dir[axis]
+			tDelta[axis] = -sh.cellSize / dir[axis]
+		default:
+			tMax[axis] = math.Inf(1)
+			tDelta[axis] = math.Inf(1)
+		}
+	}
+
+	for {
+		key := CellKey{X: cell[0], Y: cell[1], Z: cell[2]}
+		if !sh.inBounds(key) {
+			return
+		}
+		for _, e := range sh.cell(key) {
+			if !fn(e) {
+				return
+			}
+		}
+
+		// step along whichever axis reaches its next cell boundary first
+		axis := 0
+		if tMax[1] < tMax[axis] {
+			axis = 1
+		}
+		if tMax[2] < tMax[axis] {
+			axis = 2
+		}
+		if tMax[axis] > tEnd {
+			return
+		}
+		cell[axis] += step[axis]
+		tMax[axis] += tDelta[axis]
+	}
+}
+
+// clipRay intersects the ray with the box [0, upper] using the slab method
+// and returns the parameter range inside it.
+func clipRay(origin, dir, upper [3]float64, tMin, tMax float64) (float64, float64, bool) {
+	for axis := range 3 {
+		if dir[axis] == 0 {
+			if origin[axis] < 0 || origin[axis] > upper[axis] {
+				return 0, 0, false
+			}
+			continue
+		}
+
+		t0 := (0 - origin[axis]) / dir[axis]
+		t1 := (upper[axis] - origin[axis]) / dir[axis]
+		if t0 > t1 {
+			t0, t1 = t1, t0
+		}
+		tMin = max(tMin, t0)
+		tMax = min(tMax, t1)
+		if tMin > tMax {
+			return 0, 0, false
+		}
+	}
+	return tMin, tMax, true
+}
+
+func (sh *SpatialHash[E]) gridDims() [3]int {
+	return [3]int{sh.gridWidth, sh.gridHeight, sh.gridDepth}
+}
+
+// distSq returns the squared distance from e's current position to (x, y, z),
+// ignoring z on a 2D hash.
+func (sh *SpatialHash[E]) distSq(e E, x, y, z float64) float64 {
+	ex, ey, ez := position(e)
+	dx := x - ex
+	dy := y - ey
+	dz := 0.0
+	if sh.is3D {
+		dz = z - ez
+	}
+	return dx*dx + dy*dy + dz*dz
+}
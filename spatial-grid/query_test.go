@@ -0,0 +1,339 @@
+package spatialgrid
+
+import (
+	"math"
+	"math/rand/v2"
+	"slices"
+	"sync"
+	"testing"
+)
+
+func randomEntities3D(n int, lo, hi float64, seed uint64) []*TestEntity3D {
+	rng := rand.New(rand.NewPCG(seed, seed))
+	span := hi - lo
+
+	entities := make([]*TestEntity3D, n)
+	for i := range entities {
+		entities[i] = &TestEntity3D{
+			id: i,
+			x:  lo + rng.Float64()*span,
+			y:  lo + rng.Float64()*span,
+			z:  lo + rng.Float64()*span,
+		}
+	}
+	return entities
+}
+
+func ids(entities []*TestEntity3D) []int {
+	out := make([]int, len(entities))
+	for i, e := range entities {
+		out[i] = e.id
+	}
+	slices.Sort(out)
+	return out
+}
+
+func hashes3D(entities []*TestEntity3D) map[string]*SpatialHash[*TestEntity3D] {
+	dense := NewSpatialHash3D[*TestEntity3D](10, 100, 100, 100)
+	sparse := NewSparseSpatialHash3D[*TestEntity3D](10)
+	for _, e := range entities {
+		dense.Insert3D(e, e.x, e.y, e.z)
+		sparse.Insert3D(e, e.x, e.y, e.z)
+	}
+	return map[string]*SpatialHash[*TestEntity3D]{"dense": dense, "sparse": sparse}
+}
+
+func TestQueryBoxMatchesBruteForce(t *testing.T) {
+	entities := randomEntities3D(2000, 0, 99.9, 1)
+
+	for name, sh := range hashes3D(entities) {
+		got := sh.QueryBox3D(20, 35, 10, 47.5, 80, 60)
+
+		var want []*TestEntity3D
+		for _, e := range entities {
+			if e.x >= 20 && e.x <= 47.5 && e.y >= 35 && e.y <= 80 && e.z >= 10 && e.z <= 60 {
+				want = append(want, e)
+			}
+		}
+
+		if !slices.Equal(ids(got), ids(want)) {
+			t.Errorf("%s: box query returned %d entities, want %d", name, len(got), len(want))
+		}
+	}
+}
+
+func TestQueryBox2D(t *testing.T) {
+	sh := NewSpatialHash[*TestEntity](10, 100, 100)
+	inside := &TestEntity{id: 1, x: 15, y: 15}
+	outside := &TestEntity{id: 2, x: 25, y: 15}
+	sh.Insert(inside, inside.x, inside.y)
+	sh.Insert(outside, outside.x, outside.y)
+
+	// both share the queried cell row, only one is inside the box
+	if got := sh.QueryBox(10, 10, 20, 20); len(got) != 1 || got[0] != inside {
+		t.Fatalf("expected only the inside entity, got %v", got)
+	}
+}
+
+func TestNearestMatchesBruteForce(t *testing.T) {
+	entities := randomEntities3D(2000, 0, 99.9, 2)
+
+	for name, sh := range hashes3D(entities) {
+		for _, q := range [][3]float64{{50, 50, 50}, {0, 0, 0}, {99, 1, 42}, {150, 150, 150}} {
+			got := sh.Nearest3D(q[0], q[1], q[2], 7)
+
+			want := slices.Clone(entities)
+			slices.SortFunc(want, func(a, b *TestEntity3D) int {
+				da := sh.distSq(a, q[0], q[1], q[2])
+				db := sh.distSq(b, q[0], q[1], q[2])
+				switch {
+				case da < db:
+					return -1
+				case da > db:
+					return 1
+				}
+				return 0
+			})
+
+			if len(got) != 7 {
+				t.Fatalf("%s %v: expected 7 results, got %d", name, q, len(got))
+			}
+			for i := range got {
+				if got[i] != want[i] {
+					t.Errorf("%s %v: result %d is #%d, want #%d", name, q, i, got[i].id, want[i].id)
+				}
+			}
+		}
+	}
+}
+
+func TestNearestSparseFarApart(t *testing.T) {
+	sh := NewSparseSpatialHash[*TestEntity](1)
+
+	near := &TestEntity{id: 1, x: 3, y: 0}
+	far := &TestEntity{id: 2, x: -1e7, y: 1e7}
+	sh.Insert(near, near.x, near.y)
+	sh.Insert(far, far.x, far.y)
+
+	// without falling back to a sweep this would walk ten million rings
+	got := sh.Nearest(0, 0, 5)
+	if len(got) != 2 || got[0] != near || got[1] != far {
+		t.Fatalf("expected [near far], got %v", got)
+	}
+}
+
+func TestNearestFromOutsideGrid(t *testing.T) {
+	sh := NewSpatialHash[*TestEntity](1, 10, 10)
+
+	a := &TestEntity{id: 1, x: 9.5, y: 9.5}
+	b := &TestEntity{id: 2, x: 0.5, y: 0.5}
+	sh.Insert(a, a.x, a.y)
+	sh.Insert(b, b.x, b.y)
+
+	// far enough out that rings around the point itself never reach the grid
+	got := sh.Nearest(100, 100, 2)
+	if len(got) != 2 || got[0] != a || got[1] != b {
+		t.Fatalf("expected [a b], got %v", got)
+	}
+}
+
+func TestConcurrentNearest(t *testing.T) {
+	entities := randomEntities3D(500, 0, 99.9, 9)
+
+	for name, sh := range hashes3D(entities) {
+		want := ids(sh.Nearest3D(50, 50, 50, 8))
+
+		var wg sync.WaitGroup
+		for range 8 {
+			wg.Go(func() {
+				for range 50 {
+					if got := ids(sh.Nearest3D(50, 50, 50, 8)); !slices.Equal(got, want) {
+						t.Errorf("%s: expected %v, got %v", name, want, got)
+						return
+					}
+				}
+			})
+		}
+		wg.Wait()
+	}
+}
+
+func TestEachNearestReportsDistance(t *testing.T) {
+	sh := NewSpatialHash[*TestEntity](10, 100, 100)
+	for i := range 5 {
+		e := &TestEntity{id: i, x: float64(10 + i*3), y: 50}
+		sh.Insert(e, e.x, e.y)
+	}
+
+	var dists []float64
+	sh.EachNearest(10, 46, 3, func(_ *TestEntity, dist float64) bool {
+		dists = append(dists, dist)
+		return true
+	})
+
+	want := []float64{4, 5, math.Hypot(6, 4)}
+	for i := range want {
+		if math.Abs(dists[i]-want[i]) > 1e-9 {
+			t.Fatalf("expected distances %v, got %v", want, dists)
+		}
+	}
+}
+
+func TestRayVisitsCellsInOrder(t *testing.T) {
+	sh := NewSpatialHash[*TestEntity](10, 100, 100)
+
+	// one entity per cell along the diagonal, plus one well off the ray
+	for i := range 10 {
+		c := float64(i*10 + 5)
+		sh.Insert(&TestEntity{id: i, x: c, y: c}, c, c)
+	}
+	sh.Insert(&TestEntity{id: 99, x: 85, y: 5}, 85, 5)
+
+	got := sh.QueryRay(1, 1, 1, 1, 1000)
+	if len(got) != 10 {
+		t.Fatalf("expected 10 diagonal entities, got %d", len(got))
+	}
+	for i, e := range got {
+		if e.id != i {
+			t.Fatalf("expected traversal order 0..9, got #%d at %d", e.id, i)
+		}
+	}
+
+	// ray starting outside the grid gets clipped to it
+	if got := sh.QueryRay(-50, 5, 1, 0, 1000); len(got) != 2 {
+		t.Fatalf("expected entities #0 and #99 along y=5, got %d", len(got))
+	}
+
+	// segment stops short of the far end
+	if got := sh.QuerySegment(5, 5, 25, 25); len(got) != 3 {
+		t.Fatalf("expected 3 entities along the segment, got %d", len(got))
+	}
+}
+
+func TestRayMatchesSampling(t *testing.T) {
+	entities := randomEntities3D(3000, 0, 99.9, 3)
+	rng := rand.New(rand.NewPCG(4, 4))
+
+	for name, sh := range hashes3D(entities) {
+		for range 20 {
+			o := [3]float64{rng.Float64() * 100, rng.Float64() * 100, rng.Float64() * 100}
+			d := [3]float64{rng.Float64() - 0.5, rng.Float64() - 0.5, rng.Float64() - 0.5}
+			n := math.Sqrt(d[0]*d[0] + d[1]*d[1] + d[2]*d[2])
+			const dist = 60.0
+
+			got := make(map[int]bool)
+			sh.EachAlongRay3D(o[0], o[1], o[2], d[0], d[1], d[2], dist, func(e *TestEntity3D) bool {
+				got[e.id] = true
+				return true
+			})
+
+			// every cell hit by a fine sampling of the ray must be visited
+			for s := 0.0; s <= dist; s += 0.01 {
+				p := [3]float64{o[0] + d[0]/n*s, o[1] + d[1]/n*s, o[2] + d[2]/n*s}
+				if min(p[0], p[1], p[2]) < 0 || max(p[0], p[1], p[2]) >= 100 {
+					// dense keys truncate, so don't let -0.5 alias cell 0
+					continue
+				}
+				key := sh.cellKey(p[0], p[1], p[2])
+				for _, e := range sh.cell(key) {
+					if !got[e.id] {
+						t.Fatalf("%s: ray missed #%d in cell %v", name, e.id, key)
+					}
+				}
+			}
+		}
+	}
+}
+
+func TestEachStopsEarly(t *testing.T) {
+	sh := NewSpatialHash[*TestEntity](10, 100, 100)
+	for i := range 50 {
+		sh.Insert(&TestEntity{id: i, x: 50, y: 50}, 50, 50)
+	}
+
+	calls := 0
+	sh.EachInRadius(50, 50, 10, func(*TestEntity) bool {
+		calls++
+		return calls < 3
+	})
+	if calls != 3 {
+		t.Fatalf("expected iteration to stop after 3 calls, got %d", calls)
+	}
+}
+
+// raceEnabled is set by race_test.go in -race builds.
+var raceEnabled bool
+
+func TestEachFormsDoNotAllocate(t *testing.T) {
+	entities := randomEntities3D(2000, 0, 99.9, 5)
+
+	for name, sh := range hashes3D(entities) {
+		count := 0
+		visit := func(*TestEntity3D) bool { count++; return true }
+		visitNearest := func(*TestEntity3D, float64) bool { count++; return true }
+
+		// warm the kNN scratch buffer
+		sh.EachNearest3D(50, 50, 50, 16, visitNearest)
+
+		checks := map[string]func(){
+			"radius":  func() { sh.EachInRadius3D(50, 50, 50, 20, visit) },
+			"box":     func() { sh.EachInBox3D(10, 10, 10, 40, 40, 40, visit) },
+			"nearest": func() { sh.EachNearest3D(50, 50, 50, 16, visitNearest) },
+			"ray":     func() { sh.EachAlongRay3D(0, 0, 0, 1, 1, 1, 150, visit) },
+		}
+		if raceEnabled {
+			// the race detector makes sync.Pool drop items at random
+			delete(checks, "nearest")
+		}
+		for query, fn := range checks {
+			if allocs := testing.AllocsPerRun(20, fn); allocs != 0 {
+				t.Errorf("%s %s: expected no allocations, got %.1f", name, query, allocs)
+			}
+		}
+	}
+}
+
+func BenchmarkQueryBox(b *testing.B) {
+	sh := NewSpatialHash[*TestEntity](10, 1000, 1000)
+	for i := 0; i < 10000; i++ {
+		x := float64(i%100) * 10
+		y := float64(i/100) * 10
+		sh.Insert(&TestEntity{id: i, x: x, y: y}, x, y)
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		sh.EachInBox(450, 450, 550, 550, func(*TestEntity) bool { return true })
+	}
+}
+
+func BenchmarkNearest(b *testing.B) {
+	sh := NewSpatialHash[*TestEntity](10, 1000, 1000)
+	for i := 0; i < 10000; i++ {
+		x := float64(i%100) * 10
+		y := float64(i/100) * 10
+		sh.Insert(&TestEntity{id: i, x: x, y: y}, x, y)
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		sh.EachNearest(503, 497, 8, func(*TestEntity, float64) bool { return true })
+	}
+}
+
+func BenchmarkRay(b *testing.B) {
+	sh := NewSpatialHash[*TestEntity](10, 1000, 1000)
+	for i := 0; i < 10000; i++ {
+		x := float64(i%100) * 10
+		y := float64(i/100) * 10
+		sh.Insert(&TestEntity{id: i, x: x, y: y}, x, y)
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		sh.EachAlongRay(0, 0, 3, 1, 1000, func(*TestEntity) bool { return true })
+	}
+}
@@ -0,0 +1,5 @@
+//go:build race
+
+package spatialgrid
+
+func init() { raceEnabled = true }
@@ -16,7 +16,7 @@ func (e *TestEntity) Position() (x, y float64) {
 }
 
 func BenchmarkInsert(b *testing.B) {
-	sh := NewSpatialHash(10, 1000, 1000)
+	sh := NewSpatialHash[*TestEntity](10, 1000, 1000)
 	e := TestEntity{id: 1, x: 50, y: 50}
 
 	b.ResetTimer()
@@ -26,7 +26,7 @@ func BenchmarkInsert(b *testing.B) {
 }
 
 func BenchmarkQuery(b *testing.B) {
-	sh := NewSpatialHash(10, 1000, 1000)
+	sh := NewSpatialHash[*TestEntity](10, 1000, 1000)
 
 	for i := 0; i < 10000; i++ {
 		x := float64(i%100) * 10
@@ -41,7 +41,7 @@ func BenchmarkQuery(b *testing.B) {
 }
 
 func BenchmarkQueryDistanceFilter(b *testing.B) {
-	sh := NewSpatialHash(10, 1000, 1000)
+	sh := NewSpatialHash[*TestEntity](10, 1000, 1000)
 
 	for i := 0; i < 10000; i++ {
 		x := float64(i%100) * 10
@@ -74,3 +74,285 @@ func BenchmarkBruteForce(b *testing.B) {
 		}
 	}
 }
+
+type TestEntity3D struct {
+	id      int
+	x, y, z float64
+}
+
+func (e *TestEntity3D) ID() int {
+	return e.id
+}
+
+func (e *TestEntity3D) Position() (x, y float64) {
+	return e.x, e.y
+}
+
+func (e *TestEntity3D) Position3D() (x, y, z float64) {
+	return e.x, e.y, e.z
+}
+
+func TestQueryDistanceFilter2D(t *testing.T) {
+	sh := NewSpatialHash[*TestEntity](10, 100, 100)
+
+	near := &TestEntity{id: 1, x: 52, y: 50}
+	far := &TestEntity{id: 2, x: 80, y: 80}
+	sh.Insert(near, near.x, near.y)
+	sh.Insert(far, far.x, far.y)
+
+	got := sh.QueryDistanceFilter(50, 50, 5)
+	if len(got) != 1 || got[0] != near {
+		t.Fatalf("expected only the near entity, got %v", got)
+	}
+}
+
+func TestQuery3DSeparatesHeight(t *testing.T) {
+	sh := NewSpatialHash3D[*TestEntity3D](10, 100, 100, 100)
+
+	ground := &TestEntity3D{id: 1, x: 50, y: 50, z: 0}
+	aloft := &TestEntity3D{id: 2, x: 50, y: 50, z: 90}
+	sh.Insert3D(ground, ground.x, ground.y, ground.z)
+	sh.Insert3D(aloft, aloft.x, aloft.y, aloft.z)
+
+	// same x/y, so only the z axis can tell them apart
+	if got := sh.Query3D(50, 50, 0, 5); len(got) != 1 || got[0] != ground {
+		t.Fatalf("expected only the ground entity near z=0, got %v", got)
+	}
+	if got := sh.QueryDistanceFilter3D(50, 50, 88, 5); len(got) != 1 || got[0] != aloft {
+		t.Fatalf("expected only the aloft entity near z=88, got %v", got)
+	}
+
+	aloft.z = 5
+	sh.Update3D(aloft, aloft.x, aloft.y, aloft.z)
+	if got := sh.QueryDistanceFilter3D(50, 50, 0, 10); len(got) != 2 {
+		t.Fatalf("expected both entities after descent, got %v", got)
+	}
+}
+
+func TestRemove3D(t *testing.T) {
+	sh := NewSpatialHash3D[*TestEntity3D](10, 100, 100, 100)
+
+	e := &TestEntity3D{id: 1, x: 20, y: 30, z: 40}
+	sh.Insert3D(e, e.x, e.y, e.z)
+	sh.Remove(e)
+
+	if got := sh.Query3D(20, 30, 40, 5); len(got) != 0 {
+		t.Fatalf("expected no entities after Remove, got %v", got)
+	}
+}
+
+func BenchmarkQuery3D(b *testing.B) {
+	sh := NewSpatialHash3D[*TestEntity3D](10, 200, 200, 200)
+
+	for i := 0; i < 10000; i++ {
+		x := float64(i%20) * 10
+		y := float64(i/20%20) * 10
+		z := float64(i/400) * 8
+		sh.Insert3D(&TestEntity3D{id: i, x: x, y: y, z: z}, x, y, z)
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		sh.QueryDistanceFilter3D(100, 100, 100, 30)
+	}
+}
+
+func TestSparseNegativeAndFarCoordinates(t *testing.T) {
+	sh := NewSparseSpatialHash[*TestEntity](10)
+
+	a := &TestEntity{id: 1, x: -3, y: -3}
+	b := &TestEntity{id: 2, x: 3, y: 3}
+	c := &TestEntity{id: 3, x: 1e9, y: -1e9}
+	for _, e := range []*TestEntity{a, b, c} {
+		sh.Insert(e, e.x, e.y)
+	}
+
+	// -3 and 3 straddle zero, so they must land in different cells
+	if sh.CellCount() != 3 {
+		t.Fatalf("expected 3 occupied cells, got %d", sh.CellCount())
+	}
+	if got := sh.QueryDistanceFilter(0, 0, 5); len(got) != 2 {
+		t.Fatalf("expected 2 entities around the origin, got %v", got)
+	}
+	if got := sh.QueryDistanceFilter(1e9, -1e9, 1); len(got) != 1 || got[0] != c {
+		t.Fatalf("expected the far entity, got %v", got)
+	}
+}
+
+func TestSparseReclaimsEmptyCells(t *testing.T) {
+	sh := NewSparseSpatialHash3D[*TestEntity3D](10)
+
+	e := &TestEntity3D{id: 1}
+	sh.Insert3D(e, 0, 0, 0)
+
+	// walk the entity through 100 cells; only the current one should remain
+	for i := 1; i <= 100; i++ {
+		x := float64(i) * 10
+		e.x, e.y, e.z = x, -x, x
+		sh.Update3D(e, e.x, e.y, e.z)
+	}
+
+	if sh.CellCount() != 1 {
+		t.Fatalf("expected 1 occupied cell, got %d", sh.CellCount())
+	}
+
+	sh.Remove(e)
+	if sh.CellCount() != 0 {
+		t.Fatalf("expected no occupied cells after Remove, got %d", sh.CellCount())
+	}
+}
+
+func TestSparseLargeRadiusQuery(t *testing.T) {
+	sh := NewSparseSpatialHash[*TestEntity](1)
+
+	for i := 0; i < 10; i++ {
+		e := &TestEntity{id: i, x: float64(i * 100), y: 0}
+		sh.Insert(e, e.x, e.y)
+	}
+
+	// radius spans millions of cells but only ten are occupied
+	if got := sh.Query(0, 0, 5000); len(got) != 10 {
+		t.Fatalf("expected all 10 entities, got %d", len(got))
+	}
+	if got := sh.QueryDistanceFilter(0, 0, 450); len(got) != 5 {
+		t.Fatalf("expected 5 entities within 450, got %d", len(got))
+	}
+}
+
+func BenchmarkSparseQuery(b *testing.B) {
+	sh := NewSparseSpatialHash[*TestEntity](10)
+
+	for i := 0; i < 10000; i++ {
+		x := float64(i%100)*10 - 500
+		y := float64(i/100)*10 - 500
+		sh.Insert(&TestEntity{id: i, x: x, y: y}, x, y)
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		sh.Query(0, 0, 50)
+	}
+}
+
+func TestRemoveAfterEntityMoved(t *testing.T) {
+	sh := NewSpatialHash[*TestEntity](10, 100, 100)
+
+	e := &TestEntity{id: 1, x: 5, y: 5}
+	sh.Insert(e, e.x, e.y)
+
+	// the caller moves the entity before telling the hash
+	e.x, e.y = 95, 95
+	sh.Remove(e)
+
+	if got := sh.Query(5, 5, 1); len(got) != 0 {
+		t.Fatalf("expected entity removed from its old cell, got %v", got)
+	}
+	if sh.Len() != 0 {
+		t.Fatalf("expected empty hash, Len = %d", sh.Len())
+	}
+}
+
+func TestUpdateAfterEntityMoved(t *testing.T) {
+	sh := NewSpatialHash[*TestEntity](10, 100, 100)
+
+	e := &TestEntity{id: 1, x: 5, y: 5}
+	sh.Insert(e, e.x, e.y)
+
+	e.x, e.y = 55, 55
+	sh.Update(e, e.x, e.y)
+
+	if got := sh.Query(5, 5, 1); len(got) != 0 {
+		t.Fatalf("expected nothing left in the old cell, got %v", got)
+	}
+	if got := sh.Query(55, 55, 1); len(got) != 1 {
+		t.Fatalf("expected entity in the new cell, got %v", got)
+	}
+}
+
+func TestInsertTwiceMoves(t *testing.T) {
+	sh := NewSpatialHash[*TestEntity](10, 100, 100)
+
+	e := &TestEntity{id: 1, x: 5, y: 5}
+	sh.Insert(e, 5, 5)
+	sh.Insert(e, 75, 75)
+
+	if sh.Len() != 1 {
+		t.Fatalf("expected 1 entity, got %d", sh.Len())
+	}
+	if got := sh.Query(5, 5, 1); len(got) != 0 {
+		t.Fatalf("expected old cell empty, got %v", got)
+	}
+}
+
+func TestRemoveKeepsSlotsConsistent(t *testing.T) {
+	sh := NewSparseSpatialHash[*TestEntity](100)
+
+	// every entity shares one cell, so each removal swaps another into place
+	entities := make([]*TestEntity, 50)
+	for i := range entities {
+		entities[i] = &TestEntity{id: i, x: float64(i), y: 0}
+		sh.Insert(entities[i], entities[i].x, 0)
+	}
+
+	for i := 0; i < len(entities); i += 3 {
+		sh.Remove(entities[i])
+	}
+	for i := 0; i < len(entities); i++ {
+		if i%3 != 0 {
+			sh.Remove(entities[i])
+		}
+	}
+
+	if sh.Len() != 0 || sh.CellCount() != 0 {
+		t.Fatalf("expected empty hash, Len = %d, cells = %d", sh.Len(), sh.CellCount())
+	}
+}
+
+func BenchmarkRemoveInsert(b *testing.B) {
+	sh := NewSpatialHash[*TestEntity](100, 1000, 1000)
+
+	// dense cells make a linear scan expensive
+	entities := make([]*TestEntity, 10000)
+	for i := range entities {
+		x := float64(i%10) * 100
+		y := float64(i/10%10) * 100
+		entities[i] = &TestEntity{id: i, x: x, y: y}
+		sh.Insert(entities[i], x, y)
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		e := entities[i%len(entities)]
+		sh.Remove(e)
+		sh.Insert(e, e.x, e.y)
+	}
+}
+
+func TestDenseClampsOutsideWorld(t *testing.T) {
+	sh := NewSpatialHash[*TestEntity](10, 100, 100)
+
+	// -5 used to truncate into cell 0 and 250 to index past the grid
+	inside := &TestEntity{id: 1, x: 5, y: 5}
+	below := &TestEntity{id: 2, x: -5, y: 5}
+	far := &TestEntity{id: 3, x: 250, y: -40}
+	for _, e := range []*TestEntity{inside, below, far} {
+		sh.Insert(e, e.x, e.y)
+	}
+
+	if got := sh.QueryDistanceFilter(-5, 5, 1); len(got) != 1 || got[0] != below {
+		t.Fatalf("expected the entity below zero, got %v", got)
+	}
+	if got := sh.QueryDistanceFilter(250, -40, 1); len(got) != 1 || got[0] != far {
+		t.Fatalf("expected the far entity, got %v", got)
+	}
+
+	far.x, far.y = 260, 300
+	sh.Update(far, far.x, far.y)
+	if got := sh.QueryDistanceFilter(260, 300, 1); len(got) != 1 || got[0] != far {
+		t.Fatalf("expected the moved entity, got %v", got)
+	}
+	sh.Remove(far)
+	if sh.Len() != 2 {
+		t.Fatalf("expected 2 entities after remove, got %d", sh.Len())
+	}
+}
@@ -1,105 +1,332 @@
 package spatialgrid
 
-type CellKey struct{ X, Y int }
+import (
+	"math"
+	"sync"
+)
 
-type SpatialHash struct {
+type CellKey struct{ X, Y, Z int }
+
+// grid is the cell geometry shared by the hashes: the cell size and, for the
+// dense ones, the world's extent in cells.
+type grid struct {
 	cellSize   float64
-	cells      [][]Entity // 1D array
-	gridWidth  int        // num of cells horizontally
-	gridHeight int        // num of cells vertically
+	gridWidth  int // num of cells horizontally
+	gridHeight int // num of cells vertically
+	gridDepth  int // num of cells along z, 1 for a 2D grid
+	is3D       bool
+}
+
+func newGrid(cellSize float64, worldWidth, worldHeight, worldDepth float64, is3D bool) grid {
+	return grid{
+		cellSize:   cellSize,
+		gridWidth:  int(worldWidth / cellSize),
+		gridHeight: int(worldHeight / cellSize),
+		gridDepth:  max(1, int(worldDepth/cellSize)),
+		is3D:       is3D,
+	}
+}
 
+// cellKey returns the cell containing (x, y, z), which may lie outside the
+// world. z is ignored on a 2D grid.
+func (g *grid) cellKey(x, y, z float64) CellKey {
+	key := CellKey{X: g.cellCoord(x), Y: g.cellCoord(y)}
+	if g.is3D {
+		key.Z = g.cellCoord(z)
+	}
+	return key
 }
 
-func NewSpatialHash(cellSize float64, worldWidth, worldHeight float64) *SpatialHash {
+func (g *grid) cellCoord(v float64) int {
+	// floor rather than truncate so negative coordinates land in the cell
+	// below zero instead of sharing cell 0
+	return int(math.Floor(v / g.cellSize))
+}
 
-	gridHeight := int(worldHeight / cellSize)
-	gridWidth := int(worldWidth / cellSize)
+func (g *grid) contains(key CellKey) bool {
+	return key.X >= 0 && key.X < g.gridWidth &&
+		key.Y >= 0 && key.Y < g.gridHeight &&
+		key.Z >= 0 && key.Z < g.gridDepth
+}
 
-	return &SpatialHash{
-		gridWidth:  gridWidth,
-		gridHeight: gridHeight,
-		cellSize:   cellSize,
-		cells:      make([][]Entity, gridWidth*gridHeight),
+// clamp moves key to the nearest cell inside the world. Dense hashes store
+// entities outside the world in the edge cells, and clamp query ranges the
+// same way so those entities are still found.
+func (g *grid) clamp(key CellKey) CellKey {
+	return CellKey{
+		X: min(max(key.X, 0), g.gridWidth-1),
+		Y: min(max(key.Y, 0), g.gridHeight-1),
+		Z: min(max(key.Z, 0), g.gridDepth-1),
+	}
+}
+
+// index returns the position of an in-world cell in a flat cell slice, x
+// fastest then y then z.
+func (g *grid) index(key CellKey) int {
+	return key.X + (key.Y+key.Z*g.gridHeight)*g.gridWidth
+}
+
+// SpatialHash buckets entities into uniform cells. A dense hash stores cells
+// in a flat slice sized to fixed world bounds, and keeps entities outside
+// them in the nearest edge cell; a sparse hash stores only the occupied cells
+// in a map keyed by CellKey, so coordinates can be negative or unbounded.
+type SpatialHash[E Entity] struct {
+	grid
+	cells [][]E // 1D array, see grid.index
+
+	sparse map[CellKey][]E // non-nil in sparse mode, empty cells are deleted
+
+	// where each entity was last put, by ID, so Remove and Update never
+	// depend on what Position reports now
+	locations map[int]location
+
+	nearest sync.Pool // *[]candidate[E] scratch heaps reused by EachNearest3D
+}
+
+type location struct {
+	key  CellKey
+	slot int // index within the cell's slice
+}
+
+// NewSpatialHash returns a 2D hash over a worldWidth x worldHeight area.
+func NewSpatialHash[E Entity](cellSize float64, worldWidth, worldHeight float64) *SpatialHash[E] {
+	return newSpatialHash[E](cellSize, worldWidth, worldHeight, 0, false)
+}
+
+// NewSpatialHash3D returns a hash over a worldWidth x worldHeight x worldDepth
+// volume split into uniform cubic cells.
+func NewSpatialHash3D[E Entity](cellSize float64, worldWidth, worldHeight, worldDepth float64) *SpatialHash[E] {
+	return newSpatialHash[E](cellSize, worldWidth, worldHeight, worldDepth, true)
+}
+
+// NewSparseSpatialHash returns an unbounded 2D hash that only allocates
+// cells as entities move into them.
+func NewSparseSpatialHash[E Entity](cellSize float64) *SpatialHash[E] {
+	return &SpatialHash[E]{
+		grid:      grid{cellSize: cellSize},
+		sparse:    make(map[CellKey][]E),
+		locations: make(map[int]location),
 	}
 }
 
-func (sh *SpatialHash) cellIndex(x, y float64) int {
-	cellX := int(x / sh.cellSize)
-	cellY := int(y / sh.cellSize)
-	return cellX + cellY*sh.gridWidth
+// NewSparseSpatialHash3D is the 3D form of NewSparseSpatialHash.
+func NewSparseSpatialHash3D[E Entity](cellSize float64) *SpatialHash[E] {
+	sh := NewSparseSpatialHash[E](cellSize)
+	sh.is3D = true
+	return sh
 }
 
-func (sh *SpatialHash) Insert(e Entity, x float64, y float64) {
-	cellIndex := sh.cellIndex(x, y)
-	sh.cells[cellIndex] = append(sh.cells[cellIndex], e)
+func newSpatialHash[E Entity](cellSize float64, worldWidth, worldHeight, worldDepth float64, is3D bool) *SpatialHash[E] {
+	g := newGrid(cellSize, worldWidth, worldHeight, worldDepth, is3D)
+	return &SpatialHash[E]{
+		grid:      g,
+		cells:     make([][]E, g.gridWidth*g.gridHeight*g.gridDepth),
+		locations: make(map[int]location),
+	}
 }
 
-func (sh *SpatialHash) Remove(e Entity) {
-	cellIndex := sh.cellIndex(e.Position())
-	entities := sh.cells[cellIndex]
+// placeKey returns the cell an entity at (x, y, z) is stored in.
+func (sh *SpatialHash[E]) placeKey(x, y, z float64) CellKey {
+	key := sh.cellKey(x, y, z)
+	if sh.sparse == nil && !sh.contains(key) {
+		key = sh.clamp(key)
+	}
+	return key
+}
 
-	for i, entity := range entities {
-		if entity.ID() == e.ID() {
-			// swap since ordering doesn't matter in the cell
-			entities[i] = entities[len(entities)-1]
-			sh.cells[cellIndex] = entities[:len(entities)-1]
+func (sh *SpatialHash[E]) inBounds(key CellKey) bool {
+	return sh.sparse != nil || sh.contains(key)
+}
+
+func (sh *SpatialHash[E]) cell(key CellKey) []E {
+	if sh.sparse != nil {
+		return sh.sparse[key]
+	}
+	return sh.cells[sh.index(key)]
+}
+
+func (sh *SpatialHash[E]) setCell(key CellKey, entities []E) {
+	if sh.sparse != nil {
+		if len(entities) == 0 {
+			// reclaim empty cells so roaming entities don't leave a trail
+			delete(sh.sparse, key)
 			return
 		}
+		sh.sparse[key] = entities
+		return
+	}
+	sh.cells[sh.index(key)] = entities
+}
+
+// CellCount returns how many cells are allocated: the whole grid for a dense
+// hash, only occupied cells for a sparse one.
+func (sh *SpatialHash[E]) CellCount() int {
+	if sh.sparse != nil {
+		return len(sh.sparse)
+	}
+	return len(sh.cells)
+}
+
+// Len returns the number of entities in the hash.
+func (sh *SpatialHash[E]) Len() int {
+	return len(sh.locations)
+}
+
+// Insert adds e at (x, y). Inserting an entity that is already present moves
+// it instead of adding a duplicate.
+func (sh *SpatialHash[E]) Insert(e E, x float64, y float64) {
+	sh.Insert3D(e, x, y, 0)
+}
+
+func (sh *SpatialHash[E]) Insert3D(e E, x, y, z float64) {
+	if _, ok := sh.locations[e.ID()]; ok {
+		sh.Update3D(e, x, y, z)
+		return
 	}
+	sh.insert(e, sh.placeKey(x, y, z))
+}
+
+func (sh *SpatialHash[E]) insert(e E, key CellKey) {
+	entities := sh.cell(key)
+	sh.locations[e.ID()] = location{key: key, slot: len(entities)}
+	sh.setCell(key, append(entities, e))
 }
 
-func (sh *SpatialHash) Update(e Entity, x float64, y float64) {
-	cellEntity := sh.cellIndex(e.Position())
-	potentialNewCell := sh.cellIndex(x, y)
-	if cellEntity != potentialNewCell {
-		sh.Remove(e)
-		sh.Insert(e, x, y)
+// Remove takes e out of the cell it was last inserted into, in O(1). It's
+// a no-op for entities not in the hash.
+func (sh *SpatialHash[E]) Remove(e E) {
+	loc, ok := sh.locations[e.ID()]
+	if !ok {
+		return
+	}
+	delete(sh.locations, e.ID())
+	sh.removeSlot(loc)
+}
+
+func (sh *SpatialHash[E]) removeSlot(loc location) {
+	entities := sh.cell(loc.key)
+	last := len(entities) - 1
+
+	// swap since ordering doesn't matter in the cell
+	if loc.slot != last {
+		moved := entities[last]
+		entities[loc.slot] = moved
+		sh.locations[moved.ID()] = location{key: loc.key, slot: loc.slot}
+	}
+	var zero E
+	entities[last] = zero
+	sh.setCell(loc.key, entities[:last])
+}
+
+func (sh *SpatialHash[E]) Update(e E, x float64, y float64) {
+	sh.Update3D(e, x, y, 0)
+}
+
+// Update3D moves e to (x, y, z). The old cell comes from the last Insert or
+// Update, so it's fine to call after the entity's own position has changed.
+// Entities not yet in the hash are inserted.
+func (sh *SpatialHash[E]) Update3D(e E, x, y, z float64) {
+	key := sh.placeKey(x, y, z)
+
+	loc, ok := sh.locations[e.ID()]
+	if !ok {
+		sh.insert(e, key)
+		return
+	}
+	if loc.key != key {
+		sh.removeSlot(loc)
+		sh.insert(e, key)
 	}
 
 }
 
 // All entities in cells that overlap the radius
-func (sh *SpatialHash) Query(x float64, y float64, radius float64) []Entity {
-	centerCellX := int(x / sh.cellSize)
-	centerCellY := int(y / sh.cellSize)
+func (sh *SpatialHash[E]) Query(x float64, y float64, radius float64) []E {
+	return sh.Query3D(x, y, 0, radius)
+}
+
+// Query3D returns all entities in cells that overlap the sphere. On a 2D hash
+// z is ignored and it behaves like Query.
+func (sh *SpatialHash[E]) Query3D(x, y, z, radius float64) []E {
+	center := sh.cellKey(x, y, z)
 
 	// how many  cells does this radius cover
 	cellRadius := int(radius/sh.cellSize) + 1
+	reach := CellKey{X: cellRadius, Y: cellRadius}
+	if sh.is3D {
+		reach.Z = cellRadius
+	}
+
+	var entities []E
+	sh.eachCell(center.sub(reach), center.add(reach), func(cell []E) bool {
+		entities = append(entities, cell...)
+		return true
+	})
+	return entities
+}
+
+func (sh *SpatialHash[E]) QueryDistanceFilter(x float64, y float64, radius float64) []E {
+	return sh.QueryDistanceFilter3D(x, y, 0, radius)
+}
 
-	var entities []Entity
-	for i := -cellRadius; i <= cellRadius; i++ {
-		for j := -cellRadius; j <= cellRadius; j++ {
-			cellX := centerCellX + i
-			cellY := centerCellY + j
+// QueryDistanceFilter3D is Query3D narrowed to entities whose current
+// position lies within radius. On a 2D hash only x and y are compared.
+func (sh *SpatialHash[E]) QueryDistanceFilter3D(x, y, z, radius float64) []E {
+	var result []E
+	sh.EachInRadius3D(x, y, z, radius, func(e E) bool {
+		result = append(result, e)
+		return true
+	})
+	return result
+}
 
-			// bounds check
-			if cellX < 0 || cellX >= sh.gridWidth || cellY < 0 || cellY >= sh.gridHeight {
-				continue
+// eachCell calls fn with every non-empty cell whose key lies in [lo, hi] on
+// all axes, stopping early if fn returns false. It reports whether it ran to
+// completion.
+func (sh *SpatialHash[E]) eachCell(lo, hi CellKey, fn func(cell []E) bool) bool {
+	if sh.sparse != nil {
+		// a big range over a sparse hash can span far more cells than are
+		// occupied, so walk the occupied ones instead
+		span := float64(hi.X-lo.X+1) * float64(hi.Y-lo.Y+1) * float64(hi.Z-lo.Z+1)
+		if span > float64(len(sh.sparse)) {
+			for key, cell := range sh.sparse {
+				if key.within(lo, hi) && !fn(cell) {
+					return false
+				}
 			}
+			return true
+		}
+	} else {
+		// clamped like placeKey, so ranges off the edge still reach the
+		// edge cells holding entities outside the world
+		lo, hi = sh.clamp(lo), sh.clamp(hi)
+	}
 
-			idx := cellX + cellY*sh.gridWidth
-			entities = append(entities, sh.cells[idx]...)
+	for cz := lo.Z; cz <= hi.Z; cz++ {
+		for cy := lo.Y; cy <= hi.Y; cy++ {
+			for cx := lo.X; cx <= hi.X; cx++ {
+				cell := sh.cell(CellKey{X: cx, Y: cy, Z: cz})
+				if len(cell) > 0 && !fn(cell) {
+					return false
+				}
+			}
 		}
 	}
-	return entities
+	return true
 }
 
-func (sh *SpatialHash) QueryDistanceFilter(x float64, y float64, radius float64) []Entity {
-	entities := sh.Query(x, y, radius)
-
-	var result []Entity
-	radiusSq := radius * radius
+func (k CellKey) add(o CellKey) CellKey { return CellKey{X: k.X + o.X, Y: k.Y + o.Y, Z: k.Z + o.Z} }
+func (k CellKey) sub(o CellKey) CellKey { return CellKey{X: k.X - o.X, Y: k.Y - o.Y, Z: k.Z - o.Z} }
 
-	for _, e := range entities {
-		ex, ey := e.Position()
-		dx := x - ex
-		dy := y - ey
-		distSq := dx*dx + dy*dy
+func (k CellKey) within(lo, hi CellKey) bool {
+	return k.X >= lo.X && k.X <= hi.X &&
+		k.Y >= lo.Y && k.Y <= hi.Y &&
+		k.Z >= lo.Z && k.Z <= hi.Z
+}
 
-		if distSq <= radiusSq {
-			result = append(result, e)
-		}
+func abs(n int) int {
+	if n < 0 {
+		return -n
 	}
-
-	return result
+	return n
 }